@@ -0,0 +1,250 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RepositoryMemory = "memory"
+	RepositorySqlite = "sqlite"
+	RepositoryWal    = "wal"
+)
+
+const (
+	IdUuid      = "uuid"
+	IdUuidV7    = "uuidv7"
+	IdUlid      = "ulid"
+	IdSnowflake = "snowflake"
+)
+
+type Config struct {
+	Addr        string            `yaml:"addr" validate:"required"`
+	GrpcAddr    string            `yaml:"grpc_addr" validate:"required"`
+	Repository  RepositoryConfig  `yaml:"repository"`
+	Id          IdConfig          `yaml:"id"`
+	Auth        AuthConfig        `yaml:"auth"`
+	ApiKeys     ApiKeysConfig     `yaml:"api_keys"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Contract    ContractConfig    `yaml:"contract"`
+}
+
+type RepositoryConfig struct {
+	Backend string       `yaml:"backend" validate:"oneof=memory sqlite wal"`
+	Sqlite  SqliteConfig `yaml:"sqlite"`
+	Wal     WalConfig    `yaml:"wal"`
+}
+
+// ApiKeysConfig selects the api key storage; the wal backend is not offered, as keys change rarely
+type ApiKeysConfig struct {
+	Backend string       `yaml:"backend" validate:"oneof=memory sqlite"`
+	Sqlite  SqliteConfig `yaml:"sqlite"`
+}
+
+// IdempotencyConfig sets how long idempotency keys of customer creation are remembered, and where; keys in
+// memory are per process and lost on restart, so only sqlite protects retries across restarts and instances
+type IdempotencyConfig struct {
+	Window  time.Duration `yaml:"window" validate:"gt=0"`
+	Backend string        `yaml:"backend" validate:"oneof=memory sqlite"`
+	Sqlite  SqliteConfig  `yaml:"sqlite"`
+}
+
+// ContractConfig sets which traffic is checked against the OpenAPI document; response checks are meant for
+// test environments, where a violation fails the request with a 500
+type ContractConfig struct {
+	ValidateRequests  bool `yaml:"validate_requests"`
+	ValidateResponses bool `yaml:"validate_responses"`
+}
+
+type SqliteConfig struct {
+	DataSourceName string `yaml:"data_source_name"`
+}
+
+type WalConfig struct {
+	Dir                string        `yaml:"dir"`
+	CompactionInterval time.Duration `yaml:"compaction_interval"`
+}
+
+type IdConfig struct {
+	Generator string          `yaml:"generator" validate:"oneof=uuid uuidv7 ulid snowflake"`
+	Snowflake SnowflakeConfig `yaml:"snowflake"`
+}
+
+type SnowflakeConfig struct {
+	NodeId int64 `yaml:"node_id" validate:"min=0,max=1023"`
+}
+
+// AuthConfig configures bearer token verification; an empty Issuer or Audience is not checked
+type AuthConfig struct {
+	JwksFile            string        `yaml:"jwks_file" validate:"required"`
+	JwksRefreshInterval time.Duration `yaml:"jwks_refresh_interval" validate:"min=0"`
+	Issuer              string        `yaml:"issuer"`
+	Audience            string        `yaml:"audience"`
+	Leeway              time.Duration `yaml:"leeway" validate:"min=0"`
+}
+
+func Default() Config {
+	return Config{
+		Addr:     ":8080",
+		GrpcAddr: ":9090",
+		Repository: RepositoryConfig{
+			Backend: RepositorySqlite,
+			Sqlite:  SqliteConfig{DataSourceName: "customers.db"},
+			Wal:     WalConfig{Dir: "data", CompactionInterval: time.Hour},
+		},
+		Id: IdConfig{Generator: IdUuid},
+		ApiKeys: ApiKeysConfig{
+			Backend: RepositorySqlite,
+			Sqlite:  SqliteConfig{DataSourceName: "api_keys.db"},
+		},
+		Auth: AuthConfig{
+			JwksFile:            "jwks.json",
+			JwksRefreshInterval: 30 * time.Second,
+			Leeway:              30 * time.Second,
+		},
+		Idempotency: IdempotencyConfig{
+			Window:  24 * time.Hour,
+			Backend: RepositorySqlite,
+			Sqlite:  SqliteConfig{DataSourceName: "idempotency.db"},
+		},
+		Contract: ContractConfig{ValidateRequests: true},
+	}
+}
+
+type setting struct {
+	flag string
+	env  string
+	// apply parses the raw value into the config
+	apply func(config *Config, value string) error
+	usage string
+}
+
+var settings = []setting{
+	{"addr", "APP_ADDR", setString(func(c *Config) *string { return &c.Addr }), "address the HTTP server listens on"},
+	{"grpc-addr", "APP_GRPC_ADDR", setString(func(c *Config) *string { return &c.GrpcAddr }), "address the gRPC server listens on"},
+	{"repository", "APP_REPOSITORY", setString(func(c *Config) *string { return &c.Repository.Backend }), "customer storage: memory, sqlite or wal"},
+	{"sqlite-dsn", "APP_SQLITE_DSN", setString(func(c *Config) *string { return &c.Repository.Sqlite.DataSourceName }), "sqlite data source name"},
+	{"wal-dir", "APP_WAL_DIR", setString(func(c *Config) *string { return &c.Repository.Wal.Dir }), "directory of the customer log and snapshots"},
+	{"wal-compaction-interval", "APP_WAL_COMPACTION_INTERVAL", setDuration(func(c *Config) *time.Duration { return &c.Repository.Wal.CompactionInterval }), "how often the customer log is compacted"},
+	{"id-generator", "APP_ID_GENERATOR", setString(func(c *Config) *string { return &c.Id.Generator }), "customer id generator: uuid, uuidv7, ulid or snowflake"},
+	{"snowflake-node-id", "APP_SNOWFLAKE_NODE_ID", setInt(func(c *Config) *int64 { return &c.Id.Snowflake.NodeId }), "node id of the snowflake generator, unique per instance"},
+	{"api-keys-repository", "APP_API_KEYS_REPOSITORY", setString(func(c *Config) *string { return &c.ApiKeys.Backend }), "api key storage: memory or sqlite"},
+	{"api-keys-sqlite-dsn", "APP_API_KEYS_SQLITE_DSN", setString(func(c *Config) *string { return &c.ApiKeys.Sqlite.DataSourceName }), "sqlite data source name of the api keys"},
+	{"jwks-file", "APP_JWKS_FILE", setString(func(c *Config) *string { return &c.Auth.JwksFile }), "JWKS file with the token verification keys"},
+	{"jwks-refresh-interval", "APP_JWKS_REFRESH_INTERVAL", setDuration(func(c *Config) *time.Duration { return &c.Auth.JwksRefreshInterval }), "how often the JWKS file is checked for rotated keys"},
+	{"jwt-issuer", "APP_JWT_ISSUER", setString(func(c *Config) *string { return &c.Auth.Issuer }), "required token issuer"},
+	{"jwt-audience", "APP_JWT_AUDIENCE", setString(func(c *Config) *string { return &c.Auth.Audience }), "required token audience"},
+	{"jwt-leeway", "APP_JWT_LEEWAY", setDuration(func(c *Config) *time.Duration { return &c.Auth.Leeway }), "tolerated clock skew in token expiry checks"},
+	{"idempotency-window", "APP_IDEMPOTENCY_WINDOW", setDuration(func(c *Config) *time.Duration { return &c.Idempotency.Window }), "how long idempotency keys of customer creation are remembered"},
+	{"idempotency-repository", "APP_IDEMPOTENCY_REPOSITORY", setString(func(c *Config) *string { return &c.Idempotency.Backend }), "idempotency key storage: memory, per process and lost on restart, or sqlite"},
+	{"idempotency-sqlite-dsn", "APP_IDEMPOTENCY_SQLITE_DSN", setString(func(c *Config) *string { return &c.Idempotency.Sqlite.DataSourceName }), "sqlite data source name of the idempotency keys"},
+	{"validate-requests", "APP_VALIDATE_REQUESTS", setBool(func(c *Config) *bool { return &c.Contract.ValidateRequests }), "reject requests that do not match the OpenAPI document"},
+	{"validate-responses", "APP_VALIDATE_RESPONSES", setBool(func(c *Config) *bool { return &c.Contract.ValidateResponses }), "fail responses that do not match the OpenAPI document, for test environments"},
+}
+
+func setString(field func(config *Config) *string) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+func setInt(field func(config *Config) *int64) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func setBool(field func(config *Config) *bool) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func setDuration(field func(config *Config) *time.Duration) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = duration
+		return nil
+	}
+}
+
+// Load builds the config from defaults, overridden in turn by the YAML file, environment variables and flags;
+// the file is given by the -config flag or the APP_CONFIG environment variable
+func Load(args []string, getenv func(string) string) (Config, error) {
+	flags := flag.NewFlagSet("app", flag.ContinueOnError)
+	configFile := flags.String("config", getenv("APP_CONFIG"), "optional YAML config file")
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		flagValues[s.flag] = flags.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	config := Default()
+	if *configFile != "" {
+		if err := loadFile(*configFile, &config); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err := s.apply(&config, value); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.apply(&config, *flagValues[s.flag]); err != nil {
+					flagErr = fmt.Errorf("-%s: %w", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return Config{}, flagErr
+	}
+
+	if err := validation.Validate(config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func loadFile(path string, config *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+	return nil
+}
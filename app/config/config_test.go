@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	// when
+	config, err := Load(nil, env(nil))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), config)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	// given
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte(`
+addr: ":9000"
+repository:
+  backend: wal
+  wal:
+    dir: /var/lib/customers
+    compaction_interval: 5m
+`), 0o644)
+
+	// and
+	environment := env(map[string]string{
+		"APP_CONFIG":     file,
+		"APP_ADDR":       ":9001",
+		"APP_WAL_DIR":    "/tmp/customers",
+		"APP_SQLITE_DSN": "",
+	})
+
+	// when
+	config, err := Load([]string{"-addr", ":9002"}, environment)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, ":9002", config.Addr, "Flag should override env and file")
+	assert.Equal(t, RepositoryWal, config.Repository.Backend, "File should override defaults")
+	assert.Equal(t, "/tmp/customers", config.Repository.Wal.Dir, "Env should override file")
+	assert.Equal(t, 5*time.Minute, config.Repository.Wal.CompactionInterval)
+	assert.Equal(t, "customers.db", config.Repository.Sqlite.DataSourceName, "Empty env should not override")
+}
+
+func TestLoad_ContractChecks(t *testing.T) {
+	// when
+	config, err := Load([]string{"-validate-requests=false"}, env(map[string]string{"APP_VALIDATE_RESPONSES": "true"}))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, ContractConfig{ValidateRequests: false, ValidateResponses: true}, config.Contract)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		environment map[string]string
+		file        string
+	}{
+		{
+			name: "unknown backend",
+			args: []string{"-repository", "postgres"},
+		},
+		{
+			name:        "bad duration",
+			environment: map[string]string{"APP_WAL_COMPACTION_INTERVAL": "often"},
+		},
+		{
+			name:        "snowflake node id out of range",
+			environment: map[string]string{"APP_ID_GENERATOR": "snowflake", "APP_SNOWFLAKE_NODE_ID": "1024"},
+		},
+		{
+			name:        "unsupported api keys backend",
+			environment: map[string]string{"APP_API_KEYS_REPOSITORY": "wal"},
+		},
+		{
+			name: "empty jwks file",
+			args: []string{"-jwks-file", ""},
+		},
+		{
+			name:        "negative jwt leeway",
+			environment: map[string]string{"APP_JWT_LEEWAY": "-1m"},
+		},
+		{
+			name: "zero idempotency window",
+			args: []string{"-idempotency-window", "0s"},
+		},
+		{
+			name: "unknown idempotency backend",
+			args: []string{"-idempotency-repository", "wal"},
+		},
+		{
+			name:        "bad bool",
+			environment: map[string]string{"APP_VALIDATE_RESPONSES": "sometimes"},
+		},
+		{
+			name: "unknown flag",
+			args: []string{"-port", "8080"},
+		},
+		{
+			name: "unknown file field",
+			file: "port: 8080\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := map[string]string{}
+			for key, value := range tt.environment {
+				environment[key] = value
+			}
+			if tt.file != "" {
+				file := filepath.Join(t.TempDir(), "config.yaml")
+				os.WriteFile(file, []byte(tt.file), 0o644)
+				environment["APP_CONFIG"] = file
+			}
+
+			_, err := Load(tt.args, env(environment))
+
+			assert.Error(t, err)
+		})
+	}
+}
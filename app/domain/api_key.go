@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"strings"
+	"time"
+)
+
+// api keys read "ak_<prefix>_<secret>"; the prefix identifies the key and is stored in clear, the secret only hashed
+const (
+	apiKeyMarker       = "ak_"
+	apiKeyPrefixBytes  = 10
+	apiKeySecretBytes  = 32
+	apiKeyPrefixLength = 16
+)
+
+var apiKeyPrefixEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type ApiKeyAlreadyExistsError struct {
+	Prefix string
+}
+
+func (e ApiKeyAlreadyExistsError) Error() string {
+	return fmt.Sprintf("api key %s already exists", e.Prefix)
+}
+
+type ApiKeyNotFoundError struct {
+	Prefix string
+}
+
+func (e ApiKeyNotFoundError) Error() string {
+	return fmt.Sprintf("api key %s not found", e.Prefix)
+}
+
+// InvalidApiKeyError does not say which part of the key was wrong beyond what the caller already knows
+type InvalidApiKeyError struct {
+	Reason string
+}
+
+func (e InvalidApiKeyError) Error() string {
+	return fmt.Sprintf("invalid api key: %s", e.Reason)
+}
+
+// ApiKey is bound to the tenant it was created in and, like a customer, only ever visible within it
+type ApiKey struct {
+	Tenant TenantId
+	Prefix string   `validate:"len=16"`
+	Name   string   `validate:"min=1,max=100"`
+	Scopes []string `validate:"min=1,dive,scope"`
+	// Hash is the SHA-256 of the secret; secrets are random, so a slow password hash buys nothing
+	Hash       []byte `validate:"len=32"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+func (key ApiKey) usableAt(now time.Time) error {
+	if key.RevokedAt != nil {
+		return InvalidApiKeyError{Reason: "revoked"}
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return InvalidApiKeyError{Reason: "expired"}
+	}
+	return nil
+}
+
+type CreateApiKeyCommand struct {
+	Tenant    TenantId
+	Name      string   `validate:"min=1,max=100"`
+	Scopes    []string `validate:"min=1,dive,scope"`
+	ExpiresAt *time.Time
+}
+
+type ApiKeyRepository interface {
+	CreateApiKey(key ApiKey) error
+	GetApiKey(prefix string) (ApiKey, bool)
+	// ListApiKeys returns all keys, revoked ones included, oldest first
+	ListApiKeys() []ApiKey
+	// TouchApiKey and RevokeApiKey change a single field, so a late last-used update cannot undo a revocation
+	TouchApiKey(prefix string, usedAt time.Time) bool
+	// RevokeApiKey keeps the time of the first revocation
+	RevokeApiKey(prefix string, revokedAt time.Time) bool
+}
+
+type ApiKeyService struct {
+	repository ApiKeyRepository
+	now        func() time.Time
+}
+
+func NewApiKeyService(repository ApiKeyRepository) ApiKeyService {
+	return ApiKeyService{repository: repository, now: time.Now}
+}
+
+// clock returns the current time in UTC, the zone every stored time is in
+func (service ApiKeyService) clock() time.Time {
+	return service.now().UTC()
+}
+
+// CreateApiKey returns the stored key together with the full key, which cannot be recovered later
+func (service ApiKeyService) CreateApiKey(command CreateApiKeyCommand) (ApiKey, string, error) {
+	if err := validation.Validate(command); err != nil {
+		return ApiKey{}, "", err
+	}
+	now := service.clock()
+	var expiresAt *time.Time
+	if command.ExpiresAt != nil {
+		if !command.ExpiresAt.After(now) {
+			return ApiKey{}, "", validation.InvalidInput{Err: errors.New("expiry must be in the future")}
+		}
+		utc := command.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+	prefixBytes := make([]byte, apiKeyPrefixBytes)
+	secretBytes := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return ApiKey{}, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return ApiKey{}, "", err
+	}
+	prefix := strings.ToLower(apiKeyPrefixEncoding.EncodeToString(prefixBytes))
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+	hash := sha256.Sum256([]byte(secret))
+	key := ApiKey{
+		Tenant:    command.Tenant,
+		Prefix:    prefix,
+		Name:      command.Name,
+		Scopes:    command.Scopes,
+		Hash:      hash[:],
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err := validation.Validate(key); err != nil {
+		return ApiKey{}, "", err
+	}
+	if err := service.repository.CreateApiKey(key); err != nil {
+		return ApiKey{}, "", err
+	}
+	return key, apiKeyMarker + prefix + "_" + secret, nil
+}
+
+// GetApiKey, ListApiKeys and RevokeApiKey treat keys of other tenants as if they did not exist
+func (service ApiKeyService) GetApiKey(tenant TenantId, prefix string) (ApiKey, bool) {
+	key, found := service.repository.GetApiKey(prefix)
+	if !found || key.Tenant != tenant {
+		return ApiKey{}, false
+	}
+	return key, true
+}
+
+func (service ApiKeyService) ListApiKeys(tenant TenantId) []ApiKey {
+	keys := []ApiKey{}
+	for _, key := range service.repository.ListApiKeys() {
+		if key.Tenant == tenant {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (service ApiKeyService) RevokeApiKey(tenant TenantId, prefix string) error {
+	if _, found := service.GetApiKey(tenant, prefix); !found {
+		return ApiKeyNotFoundError{Prefix: prefix}
+	}
+	if !service.repository.RevokeApiKey(prefix, service.clock()) {
+		return ApiKeyNotFoundError{Prefix: prefix}
+	}
+	return nil
+}
+
+// AuthenticateApiKey returns the key matching the full key if it is neither revoked nor expired,
+// recording its use
+func (service ApiKeyService) AuthenticateApiKey(fullKey string) (ApiKey, error) {
+	prefix, secret, found := strings.Cut(strings.TrimPrefix(fullKey, apiKeyMarker), "_")
+	if !strings.HasPrefix(fullKey, apiKeyMarker) || !found || len(prefix) != apiKeyPrefixLength {
+		return ApiKey{}, InvalidApiKeyError{Reason: "malformed"}
+	}
+	key, found := service.repository.GetApiKey(prefix)
+	hash := sha256.Sum256([]byte(secret))
+	if !found || subtle.ConstantTimeCompare(hash[:], key.Hash) != 1 {
+		return ApiKey{}, InvalidApiKeyError{Reason: "unknown key"}
+	}
+	now := service.clock()
+	if err := key.usableAt(now); err != nil {
+		return ApiKey{}, err
+	}
+	service.repository.TouchApiKey(prefix, now)
+	key.LastUsedAt = &now
+	return key, nil
+}
@@ -0,0 +1,203 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ApiKeyInMemoryRepository struct {
+	Data map[string]ApiKey
+}
+
+func newApiKeyInMemoryRepository() ApiKeyRepository {
+	return &ApiKeyInMemoryRepository{Data: map[string]ApiKey{}}
+}
+
+func (repo ApiKeyInMemoryRepository) CreateApiKey(key ApiKey) error {
+	if _, ok := repo.Data[key.Prefix]; ok {
+		return ApiKeyAlreadyExistsError{Prefix: key.Prefix}
+	}
+	repo.Data[key.Prefix] = key
+	return nil
+}
+
+func (repo ApiKeyInMemoryRepository) GetApiKey(prefix string) (ApiKey, bool) {
+	key, ok := repo.Data[prefix]
+	return key, ok
+}
+
+func (repo ApiKeyInMemoryRepository) ListApiKeys() []ApiKey {
+	keys := []ApiKey{}
+	for _, key := range repo.Data {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (repo ApiKeyInMemoryRepository) TouchApiKey(prefix string, usedAt time.Time) bool {
+	key, ok := repo.Data[prefix]
+	if ok {
+		key.LastUsedAt = &usedAt
+		repo.Data[prefix] = key
+	}
+	return ok
+}
+
+func (repo ApiKeyInMemoryRepository) RevokeApiKey(prefix string, revokedAt time.Time) bool {
+	key, ok := repo.Data[prefix]
+	if ok && key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		repo.Data[prefix] = key
+	}
+	return ok
+}
+
+func newApiKeyServiceAt(now *time.Time) ApiKeyService {
+	service := NewApiKeyService(newApiKeyInMemoryRepository())
+	service.now = func() time.Time { return *now }
+	return service
+}
+
+func TestApiKeyService_CreateAndAuthenticate(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := newApiKeyServiceAt(&now)
+
+	// when
+	created, fullKey, err := service.CreateApiKey(CreateApiKeyCommand{Tenant: acme, Name: "billing", Scopes: []string{"customers:read"}})
+
+	// then
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(fullKey, "ak_"+created.Prefix+"_"))
+	assert.NotContains(t, string(created.Hash), strings.TrimPrefix(fullKey, "ak_"+created.Prefix+"_"), "Secret should only be stored hashed")
+
+	// when
+	now = now.Add(time.Hour)
+	authenticated, err := service.AuthenticateApiKey(fullKey)
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, created.Prefix, authenticated.Prefix)
+	stored, _ := service.GetApiKey(acme, created.Prefix)
+	assert.Equal(t, &now, stored.LastUsedAt)
+}
+
+func TestApiKeyService_AuthenticateRejects(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+
+	tests := []struct {
+		name           string
+		prepare        func(service ApiKeyService, fullKey string) string
+		expectedReason string
+	}{
+		{
+			name:           "malformed key",
+			prepare:        func(service ApiKeyService, fullKey string) string { return "not-a-key" },
+			expectedReason: "malformed",
+		},
+		{
+			name: "wrong secret",
+			prepare: func(service ApiKeyService, fullKey string) string {
+				last := "x"
+				if strings.HasSuffix(fullKey, last) {
+					last = "y"
+				}
+				return fullKey[:len(fullKey)-1] + last
+			},
+			expectedReason: "unknown key",
+		},
+		{
+			name: "revoked key",
+			prepare: func(service ApiKeyService, fullKey string) string {
+				service.RevokeApiKey(acme, strings.Split(fullKey, "_")[1])
+				return fullKey
+			},
+			expectedReason: "revoked",
+		},
+		{
+			name: "expired key",
+			prepare: func(service ApiKeyService, fullKey string) string {
+				now = expiresAt
+				return fullKey
+			},
+			expectedReason: "expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			service := newApiKeyServiceAt(&now)
+			_, fullKey, err := service.CreateApiKey(CreateApiKeyCommand{Tenant: acme, Name: "billing", Scopes: []string{"customers:read"}, ExpiresAt: &expiresAt})
+			require.NoError(t, err)
+
+			// when
+			_, err = service.AuthenticateApiKey(tt.prepare(service, fullKey))
+
+			// then
+			assert.Equal(t, InvalidApiKeyError{Reason: tt.expectedReason}, err)
+		})
+	}
+}
+
+func TestApiKeyService_CreateInvalid(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		command CreateApiKeyCommand
+	}{
+		{name: "no tenant", command: CreateApiKeyCommand{Name: "billing", Scopes: []string{"customers:read"}}},
+		{name: "empty name", command: CreateApiKeyCommand{Tenant: acme, Name: "", Scopes: []string{"customers:read"}}},
+		{name: "no scopes", command: CreateApiKeyCommand{Tenant: acme, Name: "billing"}},
+		{name: "scope with space", command: CreateApiKeyCommand{Tenant: acme, Name: "billing", Scopes: []string{"customers:read customers:write"}}},
+		{name: "expiry in the past", command: CreateApiKeyCommand{Tenant: acme, Name: "billing", Scopes: []string{"customers:read"}, ExpiresAt: &past}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newApiKeyServiceAt(&now)
+
+			_, _, err := service.CreateApiKey(tt.command)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestApiKeyService_RevokeNonExistent(t *testing.T) {
+	now := time.Now()
+	service := newApiKeyServiceAt(&now)
+
+	err := service.RevokeApiKey(acme, "aaaaaaaaaaaaaaaa")
+
+	assert.Equal(t, ApiKeyNotFoundError{Prefix: "aaaaaaaaaaaaaaaa"}, err)
+}
+
+func TestApiKeyService_TenantIsolation(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := newApiKeyServiceAt(&now)
+	created, _, err := service.CreateApiKey(CreateApiKeyCommand{Tenant: acme, Name: "billing", Scopes: []string{"customers:read"}})
+	require.NoError(t, err)
+	globex := TenantId{Raw: "globex"}
+
+	// when
+	_, found := service.GetApiKey(globex, created.Prefix)
+	listed := service.ListApiKeys(globex)
+	err = service.RevokeApiKey(globex, created.Prefix)
+
+	// then
+	assert.False(t, found)
+	assert.Empty(t, listed)
+	assert.Equal(t, ApiKeyNotFoundError{Prefix: created.Prefix}, err)
+	stored, _ := service.GetApiKey(acme, created.Prefix)
+	assert.Nil(t, stored.RevokedAt, "Key should not be revoked from another tenant")
+}
@@ -1,8 +1,10 @@
 package domain
 
 import (
+	"errors"
 	"fmt"
 	"go-chi-gorilla-wire-workshop/app/validation"
+	"time"
 )
 
 type CustomerAlreadyExistsError struct {
@@ -13,22 +15,71 @@ func (e CustomerAlreadyExistsError) Error() string {
 	return fmt.Sprintf("customer with ID %s already exists", e.Id)
 }
 
+type CustomerNotFoundError struct {
+	Id CustomerId
+}
+
+func (e CustomerNotFoundError) Error() string {
+	return fmt.Sprintf("customer with ID %s not found", e.Id.Raw)
+}
+
+// CustomerVersionMismatchError is returned when a customer changed since the version a mutation was based on
+type CustomerVersionMismatchError struct {
+	Id       CustomerId
+	Expected int64
+	Actual   int64
+}
+
+func (e CustomerVersionMismatchError) Error() string {
+	return fmt.Sprintf("customer with ID %s is at version %d, not %d", e.Id.Raw, e.Actual, e.Expected)
+}
+
+// AnyVersion lets a mutation apply to whatever version of the customer is current
+const AnyVersion int64 = 0
+
+// Customer belongs to exactly one tenant and is only ever visible within it
 type Customer struct {
-	Id   CustomerId
-	Name string `validate:"min=1,max=30"`
-	Age  int    `validate:"min=1,max=200"`
+	Tenant TenantId
+	Id     CustomerId
+	Name   string `validate:"customername"`
+	Age    int    `validate:"customerage"`
+	// Version starts at 1 and grows by one with every change
+	Version int64
+	// CreatedAt and UpdatedAt are in UTC; customers stored before they were tracked may have them zero
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type CreateCustomerCommand struct {
-	Name string `validate:"min=1,max=30"`
-	Age  int    `validate:"min=1,max=200"`
+	Name string `validate:"customername"`
+	Age  int    `validate:"customerage"`
+}
+
+func (c CreateCustomerCommand) toCustomer(tenant TenantId, id CustomerId) (Customer, error) {
+	customer := Customer{
+		Tenant:  tenant,
+		Id:      id,
+		Name:    c.Name,
+		Age:     c.Age,
+		Version: 1,
+	}
+	if err := validation.Validate(customer); err != nil {
+		return Customer{}, err
+	}
+	return customer, nil
+}
+
+type UpdateCustomerCommand struct {
+	Name string `validate:"customername"`
+	Age  int    `validate:"customerage"`
 }
 
-func (c CreateCustomerCommand) toCustomer(id CustomerId) (Customer, error) {
+func (c UpdateCustomerCommand) toCustomer(tenant TenantId, id CustomerId) (Customer, error) {
 	customer := Customer{
-		Id:   id,
-		Name: c.Name,
-		Age:  c.Age,
+		Tenant: tenant,
+		Id:     id,
+		Name:   c.Name,
+		Age:    c.Age,
 	}
 	if err := validation.Validate(customer); err != nil {
 		return Customer{}, err
@@ -36,34 +87,213 @@ func (c CreateCustomerCommand) toCustomer(id CustomerId) (Customer, error) {
 	return customer, nil
 }
 
-type CustomerId struct {
-	Raw string `validate:"min=1"`
+type PatchCustomerCommand struct {
+	Name *string `validate:"omitnil,customername"`
+	Age  *int    `validate:"omitnil,customerage"`
 }
 
+// applyTo validates only the patched fields, so customers stored before a rule was tightened can still be
+// patched without renaming them
+func (c PatchCustomerCommand) applyTo(customer Customer) (Customer, error) {
+	if err := validation.Validate(c); err != nil {
+		return Customer{}, err
+	}
+	if c.Name != nil {
+		customer.Name = *c.Name
+	}
+	if c.Age != nil {
+		customer.Age = *c.Age
+	}
+	return customer, nil
+}
+
+// CustomerRepository scopes every call by tenant: customers of other tenants behave as if they did not exist,
+// and the same id may be used by several tenants; errors other than the domain ones are failures of the storage
 type CustomerRepository interface {
 	CreateCustomer(customer Customer) (CustomerId, error)
-	GetCustomer(id CustomerId) (Customer, bool)
+	GetCustomer(tenant TenantId, id CustomerId) (Customer, bool, error)
+	// ListCustomers returns at most limit customers matching the query and placed after the cursor in query order
+	ListCustomers(tenant TenantId, query CustomerQuery, after CustomerCursor, limit int) ([]Customer, error)
+	// UpdateCustomer replaces the customer if it is still at expectedVersion, atomically with the check;
+	// customer.Version is the version it is stored at
+	UpdateCustomer(customer Customer, expectedVersion int64) error
+	// DeleteCustomer removes the customer if it is still at expectedVersion, atomically with the check
+	DeleteCustomer(tenant TenantId, id CustomerId, expectedVersion int64) error
 }
 
 type CustomerService struct {
-	repository CustomerRepository
-	idService  IdService
+	repository        CustomerRepository
+	idService         IdService
+	idempotency       IdempotencyRepository
+	idempotencyWindow IdempotencyWindow
+	now               func() time.Time
 }
 
-func NewCustomerService(repository CustomerRepository, idService IdService) CustomerService {
-	return CustomerService{repository: repository, idService: idService}
+func NewCustomerService(repository CustomerRepository, idService IdService, idempotency IdempotencyRepository, idempotencyWindow IdempotencyWindow) CustomerService {
+	return CustomerService{
+		repository:        repository,
+		idService:         idService,
+		idempotency:       idempotency,
+		idempotencyWindow: idempotencyWindow,
+		now:               time.Now,
+	}
 }
 
-func (service CustomerService) CreateCustomer(command CreateCustomerCommand) (CustomerId, error) {
+func (service CustomerService) CreateCustomer(tenant TenantId, command CreateCustomerCommand) (CustomerId, error) {
 	id := service.idService.GenerateId()
-	customerId := CustomerId{Raw: id}
-	customer, err := command.toCustomer(customerId)
+	customerId := NewCustomerId(id)
+	customer, err := command.toCustomer(tenant, customerId)
 	if err != nil {
 		return CustomerId{}, err
 	}
+	customer.CreatedAt = service.clock()
+	customer.UpdatedAt = customer.CreatedAt
 	return service.repository.CreateCustomer(customer)
 }
 
-func (service CustomerService) GetCustomer(id CustomerId) (Customer, bool) {
-	return service.repository.GetCustomer(id)
+// clock returns the current time in UTC, the zone every stored time is in
+func (service CustomerService) clock() time.Time {
+	return service.now().UTC()
+}
+
+// CreateCustomerIdempotently creates at most one customer per key within the idempotency window; a retry with
+// the same command returns the customer created first, reporting it as replayed. The key is only leased while
+// the create runs, and released when it fails or panics
+func (service CustomerService) CreateCustomerIdempotently(tenant TenantId, key string, command CreateCustomerCommand) (customerId CustomerId, replayed bool, err error) {
+	if err := validateIdempotencyKey(key); err != nil {
+		return CustomerId{}, false, err
+	}
+	now := service.clock()
+	reservation := IdempotencyRecord{
+		Tenant:      tenant,
+		Key:         key,
+		Fingerprint: fingerprintOf(command),
+		ExpiresAt:   now.Add(idempotencyLease),
+	}
+	existing, reserved, err := service.idempotency.ReserveIdempotencyKey(reservation, now)
+	if err != nil {
+		return CustomerId{}, false, err
+	}
+	if !reserved {
+		switch {
+		case existing.Fingerprint != reservation.Fingerprint:
+			return CustomerId{}, false, IdempotencyKeyReusedError{Key: key}
+		case !existing.completed():
+			return CustomerId{}, false, IdempotencyKeyInProgressError{Key: key}
+		default:
+			return existing.CustomerId, true, nil
+		}
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			service.idempotency.ReleaseIdempotencyKey(tenant, key)
+			panic(recovered)
+		}
+	}()
+	customerId, err = service.CreateCustomer(tenant, command)
+	if err != nil {
+		return CustomerId{}, false, errors.Join(err, service.idempotency.ReleaseIdempotencyKey(tenant, key))
+	}
+	reservation.CustomerId = customerId
+	reservation.ExpiresAt = now.Add(time.Duration(service.idempotencyWindow))
+	if err := service.idempotency.CompleteIdempotencyKey(reservation); err != nil {
+		return CustomerId{}, false, err
+	}
+	return customerId, false, nil
+}
+
+func (service CustomerService) GetCustomer(tenant TenantId, id CustomerId) (Customer, bool, error) {
+	return service.repository.GetCustomer(tenant, id)
+}
+
+func (service CustomerService) ListCustomers(tenant TenantId, query CustomerQuery, request CustomerPageRequest) (CustomerPage, error) {
+	if err := validation.Validate(query); err != nil {
+		return CustomerPage{}, err
+	}
+	if err := validation.Validate(request); err != nil {
+		return CustomerPage{}, err
+	}
+	cursor, err := DecodeCustomerCursor(request.Cursor)
+	if err != nil {
+		return CustomerPage{}, err
+	}
+	// one extra customer tells whether there is a next page
+	customers, err := service.repository.ListCustomers(tenant, query, cursor, request.Limit+1)
+	if err != nil {
+		return CustomerPage{}, err
+	}
+	if len(customers) <= request.Limit {
+		return CustomerPage{Items: customers}, nil
+	}
+	items := customers[:request.Limit]
+	next := CustomerCursor{After: items[len(items)-1]}
+	return CustomerPage{Items: items, NextCursor: &next}, nil
+}
+
+// UpdateCustomer replaces the customer if it is at expectedVersion, or at any version given AnyVersion
+func (service CustomerService) UpdateCustomer(tenant TenantId, id CustomerId, expectedVersion int64, command UpdateCustomerCommand) (Customer, error) {
+	customer, err := command.toCustomer(tenant, id)
+	if err != nil {
+		return Customer{}, err
+	}
+	current, err := service.currentAt(tenant, id, expectedVersion)
+	if err != nil {
+		return Customer{}, err
+	}
+	customer.CreatedAt = current.CreatedAt
+	return service.replace(current, customer)
+}
+
+// PatchCustomer changes the customer if it is at expectedVersion, or at any version given AnyVersion
+func (service CustomerService) PatchCustomer(tenant TenantId, id CustomerId, expectedVersion int64, command PatchCustomerCommand) (Customer, error) {
+	current, err := service.currentAt(tenant, id, expectedVersion)
+	if err != nil {
+		return Customer{}, err
+	}
+	customer, err := command.applyTo(current)
+	if err != nil {
+		return Customer{}, err
+	}
+	return service.replace(current, customer)
+}
+
+// currentAt returns the stored customer, provided it is at expectedVersion
+func (service CustomerService) currentAt(tenant TenantId, id CustomerId, expectedVersion int64) (Customer, error) {
+	current, found, err := service.repository.GetCustomer(tenant, id)
+	if err != nil {
+		return Customer{}, err
+	}
+	if !found {
+		return Customer{}, CustomerNotFoundError{Id: id}
+	}
+	if expectedVersion != AnyVersion && current.Version != expectedVersion {
+		return Customer{}, CustomerVersionMismatchError{Id: id, Expected: expectedVersion, Actual: current.Version}
+	}
+	return current, nil
+}
+
+// replace stores the customer as the next version of current; the repository rejects it if current changed
+// in the meantime
+func (service CustomerService) replace(current Customer, customer Customer) (Customer, error) {
+	customer.Version = current.Version + 1
+	customer.UpdatedAt = service.clock()
+	if err := service.repository.UpdateCustomer(customer, current.Version); err != nil {
+		return Customer{}, err
+	}
+	return customer, nil
+}
+
+// DeleteCustomer removes the customer if it is at expectedVersion, or at any version given AnyVersion
+func (service CustomerService) DeleteCustomer(tenant TenantId, id CustomerId, expectedVersion int64) error {
+	if expectedVersion == AnyVersion {
+		current, found, err := service.repository.GetCustomer(tenant, id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return CustomerNotFoundError{Id: id}
+		}
+		expectedVersion = current.Version
+	}
+	return service.repository.DeleteCustomer(tenant, id, expectedVersion)
 }
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+const (
+	customerIdPrefix = "cus_"
+	// checksumAlphabet is Crockford's base32, lowercased
+	checksumAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+	checksumLength   = 4
+	maxBodyLength    = 64
+)
+
+type InvalidCustomerIdError struct {
+	Raw    string
+	Reason string
+}
+
+func (e InvalidCustomerIdError) Error() string {
+	return fmt.Sprintf("invalid customer id %q: %s", e.Raw, e.Reason)
+}
+
+// CustomerId looks like cus_<body><checksum>, where body is the generated id and the checksum is the last
+// four characters; the checksum catches mistyped ids before they reach storage
+type CustomerId struct {
+	Raw string `validate:"min=1"`
+}
+
+func NewCustomerId(body string) CustomerId {
+	return CustomerId{Raw: customerIdPrefix + body + checksum(body)}
+}
+
+func ParseCustomerId(raw string) (CustomerId, error) {
+	rest, found := strings.CutPrefix(raw, customerIdPrefix)
+	if !found {
+		return CustomerId{}, InvalidCustomerIdError{Raw: raw, Reason: fmt.Sprintf("missing prefix %q", customerIdPrefix)}
+	}
+	if len(rest) <= checksumLength || len(rest) > maxBodyLength+checksumLength {
+		return CustomerId{}, InvalidCustomerIdError{Raw: raw, Reason: "wrong length"}
+	}
+	body, sum := rest[:len(rest)-checksumLength], rest[len(rest)-checksumLength:]
+	for _, char := range body {
+		if !isBodyChar(char) {
+			return CustomerId{}, InvalidCustomerIdError{Raw: raw, Reason: fmt.Sprintf("unexpected character %q", char)}
+		}
+	}
+	if checksum(body) != sum {
+		return CustomerId{}, InvalidCustomerIdError{Raw: raw, Reason: "checksum mismatch"}
+	}
+	return CustomerId{Raw: raw}, nil
+}
+
+func (id CustomerId) String() string {
+	return id.Raw
+}
+
+func (id CustomerId) MarshalText() ([]byte, error) {
+	return []byte(id.Raw), nil
+}
+
+func (id *CustomerId) UnmarshalText(text []byte) error {
+	parsed, err := ParseCustomerId(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+func isBodyChar(char rune) bool {
+	return char >= '0' && char <= '9' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char == '-'
+}
+
+func checksum(body string) string {
+	sum := crc32.ChecksumIEEE([]byte(body))
+	encoded := make([]byte, checksumLength)
+	for i := checksumLength - 1; i >= 0; i-- {
+		encoded[i] = checksumAlphabet[sum&31]
+		sum >>= 5
+	}
+	return string(encoded)
+}
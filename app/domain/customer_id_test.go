@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCustomerId(t *testing.T) {
+	valid := NewCustomerId("01J9Z3K6TQ3V5XW0ZB9G6R4M2N")
+
+	tests := []struct {
+		name      string
+		raw       string
+		expectErr bool
+	}{
+		{
+			name:      "generated id",
+			raw:       valid.Raw,
+			expectErr: false,
+		},
+		{
+			name:      "uuid body",
+			raw:       NewCustomerId("0190b6c2-9f39-7c1e-8d5c-6b2a8e0f4d11").Raw,
+			expectErr: false,
+		},
+		{
+			name:      "missing prefix",
+			raw:       valid.Raw[len("cus_"):],
+			expectErr: true,
+		},
+		{
+			name:      "wrong checksum",
+			raw:       valid.Raw[:len(valid.Raw)-4] + "0000",
+			expectErr: true,
+		},
+		{
+			name:      "mistyped body",
+			raw:       "cus_11J9Z3K6TQ3V5XW0ZB9G6R4M2N" + valid.Raw[len(valid.Raw)-4:],
+			expectErr: true,
+		},
+		{
+			name:      "only checksum",
+			raw:       "cus_abcd",
+			expectErr: true,
+		},
+		{
+			name:      "unexpected character",
+			raw:       NewCustomerId("a/b").Raw,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := ParseCustomerId(tt.raw)
+			if tt.expectErr {
+				assert.IsType(t, InvalidCustomerIdError{}, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.raw, id.Raw)
+			}
+		})
+	}
+}
+
+func TestCustomerId_Text(t *testing.T) {
+	// given
+	id := NewCustomerId("1")
+
+	// when
+	encoded, _ := json.Marshal(map[CustomerId]CustomerId{id: id})
+
+	// then
+	assert.Equal(t, `{"`+id.Raw+`":"`+id.Raw+`"}`, string(encoded))
+
+	// and
+	var decoded map[CustomerId]CustomerId
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, id, decoded[id])
+
+	// and
+	var malformed CustomerId
+	assert.Error(t, malformed.UnmarshalText([]byte("cus_1zzzz")))
+}
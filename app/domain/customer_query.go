@@ -0,0 +1,187 @@
+package domain
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"math"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type InvalidCursorError struct {
+	Cursor string
+}
+
+func (e InvalidCursorError) Error() string {
+	return fmt.Sprintf("invalid cursor %q", e.Cursor)
+}
+
+type CustomerSortField string
+
+const (
+	CustomerSortById   CustomerSortField = "id"
+	CustomerSortByName CustomerSortField = "name"
+	CustomerSortByAge  CustomerSortField = "age"
+)
+
+type CustomerSort struct {
+	Field      CustomerSortField `validate:"oneof=id name age"`
+	Descending bool
+}
+
+// CustomerFilter narrows a listing; nil criteria are not applied
+type CustomerFilter struct {
+	Name       *string
+	NamePrefix *string
+	Age        *int
+	AgeGt      *int
+	AgeGte     *int
+	AgeLt      *int
+	AgeLte     *int
+}
+
+func init() {
+	err := validation.RegisterRule(validation.Rule{
+		Tag: "agerange",
+		Messages: map[string]string{
+			"en": "{0} bounds exclude every value",
+			"pl": "granice {0} wykluczają każdą wartość",
+			"es": "los límites de {0} excluyen todos los valores",
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	validation.RegisterStructRule(validateCustomerFilter, CustomerFilter{})
+}
+
+// validateCustomerFilter rejects age criteria that no customer can match, e.g. age_gte=65&age_lt=18
+func validateCustomerFilter(sl validator.StructLevel) {
+	filter := sl.Current().Interface().(CustomerFilter)
+	lower, upper := math.MinInt, math.MaxInt
+	if filter.Age != nil {
+		lower, upper = *filter.Age, *filter.Age
+	}
+	// no age is above MaxInt or below MinInt, and stepping past them would wrap around
+	empty := filter.AgeGt != nil && *filter.AgeGt == math.MaxInt || filter.AgeLt != nil && *filter.AgeLt == math.MinInt
+	if filter.AgeGt != nil && *filter.AgeGt < math.MaxInt {
+		lower = max(lower, *filter.AgeGt+1)
+	}
+	if filter.AgeGte != nil {
+		lower = max(lower, *filter.AgeGte)
+	}
+	if filter.AgeLt != nil && *filter.AgeLt > math.MinInt {
+		upper = min(upper, *filter.AgeLt-1)
+	}
+	if filter.AgeLte != nil {
+		upper = min(upper, *filter.AgeLte)
+	}
+	if empty || lower > upper {
+		sl.ReportError(filter.Age, "age", "Age", "agerange", "")
+	}
+}
+
+func (f CustomerFilter) Matches(customer Customer) bool {
+	switch {
+	case f.Name != nil && customer.Name != *f.Name:
+		return false
+	case f.NamePrefix != nil && !strings.HasPrefix(customer.Name, *f.NamePrefix):
+		return false
+	case f.Age != nil && customer.Age != *f.Age:
+		return false
+	case f.AgeGt != nil && customer.Age <= *f.AgeGt:
+		return false
+	case f.AgeGte != nil && customer.Age < *f.AgeGte:
+		return false
+	case f.AgeLt != nil && customer.Age >= *f.AgeLt:
+		return false
+	case f.AgeLte != nil && customer.Age > *f.AgeLte:
+		return false
+	}
+	return true
+}
+
+type CustomerQuery struct {
+	Filter CustomerFilter
+	Sort   []CustomerSort `validate:"dive"`
+}
+
+// Compare orders customers by the query sort fields; ascending id breaks ties, so the order is total
+func (q CustomerQuery) Compare(a, b Customer) int {
+	for _, sort := range q.Sort {
+		result := compareCustomersBy(sort.Field, a, b)
+		if sort.Descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return compareCustomersBy(CustomerSortById, a, b)
+}
+
+func compareCustomersBy(field CustomerSortField, a, b Customer) int {
+	switch field {
+	case CustomerSortByName:
+		return strings.Compare(a.Name, b.Name)
+	case CustomerSortByAge:
+		return cmp.Compare(a.Age, b.Age)
+	default:
+		return strings.Compare(a.Id.Raw, b.Id.Raw)
+	}
+}
+
+// CustomerCursor marks the last customer of the previous page; the next page starts right after it in query order,
+// so customers created in the meantime never shift the pages already handed out
+type CustomerCursor struct {
+	After Customer
+}
+
+type customerCursorToken struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func (c CustomerCursor) IsZero() bool {
+	return c.After.Id.Raw == ""
+}
+
+// Precedes tells whether the customer belongs to a page after the cursor
+func (c CustomerCursor) Precedes(query CustomerQuery, customer Customer) bool {
+	return c.IsZero() || query.Compare(c.After, customer) < 0
+}
+
+func (c CustomerCursor) Encode() string {
+	raw, _ := json.Marshal(customerCursorToken{Id: c.After.Id.Raw, Name: c.After.Name, Age: c.After.Age})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCustomerCursor(token string) (CustomerCursor, error) {
+	if token == "" {
+		return CustomerCursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return CustomerCursor{}, InvalidCursorError{Cursor: token}
+	}
+	var decoded customerCursorToken
+	if err := json.Unmarshal(raw, &decoded); err != nil || decoded.Id == "" {
+		return CustomerCursor{}, InvalidCursorError{Cursor: token}
+	}
+	return CustomerCursor{After: Customer{Id: CustomerId{Raw: decoded.Id}, Name: decoded.Name, Age: decoded.Age}}, nil
+}
+
+type CustomerPageRequest struct {
+	Cursor string
+	Limit  int `validate:"min=1,max=100"`
+}
+
+type CustomerPage struct {
+	Items      []Customer
+	NextCursor *CustomerCursor
+}
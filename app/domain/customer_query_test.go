@@ -0,0 +1,166 @@
+package domain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-chi-gorilla-wire-workshop/app/validation"
+)
+
+func TestCustomerFilter_Matches(t *testing.T) {
+	prefix := "Jo"
+	eighteen := 18
+	sixtyFive := 65
+	customer := Customer{Id: CustomerId{Raw: "1"}, Name: "John Doe", Age: 30}
+
+	tests := []struct {
+		name     string
+		filter   CustomerFilter
+		expected bool
+	}{
+		{
+			name:     "empty filter",
+			filter:   CustomerFilter{},
+			expected: true,
+		},
+		{
+			name:     "matching prefix and age range",
+			filter:   CustomerFilter{NamePrefix: &prefix, AgeGte: &eighteen, AgeLt: &sixtyFive},
+			expected: true,
+		},
+		{
+			name:     "age below lower bound",
+			filter:   CustomerFilter{AgeLt: &eighteen},
+			expected: false,
+		},
+		{
+			name:     "exact age mismatch",
+			filter:   CustomerFilter{Age: &sixtyFive},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.Matches(customer))
+		})
+	}
+}
+
+func TestCustomerQuery_Compare(t *testing.T) {
+	older := Customer{Id: CustomerId{Raw: "1"}, Name: "Bob", Age: 40}
+	younger := Customer{Id: CustomerId{Raw: "2"}, Name: "Alice", Age: 20}
+	sameAge := Customer{Id: CustomerId{Raw: "3"}, Name: "Alice", Age: 40}
+
+	// when
+	query := CustomerQuery{Sort: []CustomerSort{{Field: CustomerSortByAge, Descending: true}, {Field: CustomerSortByName}}}
+
+	// then
+	assert.Negative(t, query.Compare(older, younger), "Older customer should come first")
+	assert.Negative(t, query.Compare(sameAge, older), "Same age should be ordered by name")
+	assert.Negative(t, CustomerQuery{}.Compare(older, younger), "Default order should be by id")
+}
+
+func TestCustomerCursor_EncodeDecode(t *testing.T) {
+	// given
+	cursor := CustomerCursor{After: Customer{Id: CustomerId{Raw: "1"}, Name: "John Doe", Age: 30}}
+
+	// when
+	decoded, err := DecodeCustomerCursor(cursor.Encode())
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+}
+
+func TestCustomerQuery_AgeRangeValidation(t *testing.T) {
+	eighteen := 18
+	thirty := 30
+	sixtyFive := 65
+	maxInt := math.MaxInt
+	minInt := math.MinInt
+
+	tests := []struct {
+		name      string
+		filter    CustomerFilter
+		expectErr bool
+	}{
+		{
+			name:      "open range",
+			filter:    CustomerFilter{AgeGte: &eighteen},
+			expectErr: false,
+		},
+		{
+			name:      "bounded range",
+			filter:    CustomerFilter{AgeGte: &eighteen, AgeLt: &sixtyFive},
+			expectErr: false,
+		},
+		{
+			name:      "single value range",
+			filter:    CustomerFilter{AgeGte: &thirty, AgeLte: &thirty},
+			expectErr: false,
+		},
+		{
+			name:      "lower bound above upper bound",
+			filter:    CustomerFilter{AgeGte: &sixtyFive, AgeLt: &eighteen},
+			expectErr: true,
+		},
+		{
+			name:      "exclusive bounds leave no value",
+			filter:    CustomerFilter{AgeGt: &thirty, AgeLt: &thirty},
+			expectErr: true,
+		},
+		{
+			name:      "exact age outside range",
+			filter:    CustomerFilter{Age: &sixtyFive, AgeLte: &thirty},
+			expectErr: true,
+		},
+		{
+			name:      "inclusive bounds at the int limits",
+			filter:    CustomerFilter{AgeGte: &maxInt, AgeLte: &maxInt},
+			expectErr: false,
+		},
+		{
+			name:      "exclusive bounds around the int limits",
+			filter:    CustomerFilter{AgeGt: &minInt, AgeLt: &maxInt},
+			expectErr: false,
+		},
+		{
+			name:      "above the largest int",
+			filter:    CustomerFilter{AgeGt: &maxInt},
+			expectErr: true,
+		},
+		{
+			name:      "above the largest int with an upper bound",
+			filter:    CustomerFilter{AgeGt: &maxInt, AgeLte: &maxInt},
+			expectErr: true,
+		},
+		{
+			name:      "below the smallest int",
+			filter:    CustomerFilter{AgeLt: &minInt},
+			expectErr: true,
+		},
+		{
+			name:      "below the smallest int with a lower bound",
+			filter:    CustomerFilter{AgeGte: &minInt, AgeLt: &minInt},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.Validate(CustomerQuery{Filter: tt.filter})
+			if tt.expectErr {
+				var invalidInput validation.InvalidInput
+				require.ErrorAs(t, err, &invalidInput)
+				assert.Equal(t, []validation.FieldError{
+					{Field: "filter.age", Rule: "agerange", Message: "age bounds exclude every value"},
+				}, invalidInput.FieldErrors(validation.DefaultTranslator()))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package domain
 
 import (
 	"github.com/stretchr/testify/assert"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
 )
 
 type IdMockRepository struct {
@@ -13,31 +16,96 @@ func (m *IdMockRepository) GetId() string {
 	return m.ReturnedId
 }
 
+type IdSequenceRepository struct {
+	next int
+}
+
+func (m *IdSequenceRepository) GetId() string {
+	m.next++
+	return strconv.Itoa(m.next)
+}
+
+var acme = TenantId{Raw: "acme"}
+
+type customerKey struct {
+	Tenant TenantId
+	Id     CustomerId
+}
+
 type CustomerInMemoryRepository struct {
-	Data map[CustomerId]Customer
+	Data map[customerKey]Customer
 }
 
 func newCustomerInMemoryRepository() CustomerRepository {
 	return &CustomerInMemoryRepository{
-		Data: map[CustomerId]Customer{},
+		Data: map[customerKey]Customer{},
 	}
 }
 
 func (repo CustomerInMemoryRepository) CreateCustomer(customer Customer) (CustomerId, error) {
-	id := customer.Id
-	if _, ok := repo.Data[id]; ok {
-		return CustomerId{}, CustomerAlreadyExistsError{Id: id}
+	key := customerKey{Tenant: customer.Tenant, Id: customer.Id}
+	if _, ok := repo.Data[key]; ok {
+		return CustomerId{}, CustomerAlreadyExistsError{Id: customer.Id}
 	}
-	repo.Data[id] = customer
-	return id, nil
+	repo.Data[key] = customer
+	return customer.Id, nil
 }
 
-func (repo CustomerInMemoryRepository) GetCustomer(id CustomerId) (Customer, bool) {
-	value, ok := repo.Data[id]
+func (repo CustomerInMemoryRepository) GetCustomer(tenant TenantId, id CustomerId) (Customer, bool, error) {
+	value, ok := repo.Data[customerKey{Tenant: tenant, Id: id}]
 	if !ok {
-		return Customer{}, false
+		return Customer{}, false, nil
+	}
+	return value, true, nil
+}
+
+func (repo CustomerInMemoryRepository) ListCustomers(tenant TenantId, query CustomerQuery, after CustomerCursor, limit int) ([]Customer, error) {
+	customers := []Customer{}
+	for _, customer := range repo.Data {
+		if customer.Tenant == tenant && query.Filter.Matches(customer) && after.Precedes(query, customer) {
+			customers = append(customers, customer)
+		}
+	}
+	slices.SortFunc(customers, query.Compare)
+	if len(customers) > limit {
+		customers = customers[:limit]
 	}
-	return value, true
+	return customers, nil
+}
+
+func (repo CustomerInMemoryRepository) UpdateCustomer(customer Customer, expectedVersion int64) error {
+	key := customerKey{Tenant: customer.Tenant, Id: customer.Id}
+	current, ok := repo.Data[key]
+	if !ok {
+		return CustomerNotFoundError{Id: customer.Id}
+	}
+	if current.Version != expectedVersion {
+		return CustomerVersionMismatchError{Id: customer.Id, Expected: expectedVersion, Actual: current.Version}
+	}
+	repo.Data[key] = customer
+	return nil
+}
+
+func (repo CustomerInMemoryRepository) DeleteCustomer(tenant TenantId, id CustomerId, expectedVersion int64) error {
+	key := customerKey{Tenant: tenant, Id: id}
+	current, ok := repo.Data[key]
+	if !ok {
+		return CustomerNotFoundError{Id: id}
+	}
+	if current.Version != expectedVersion {
+		return CustomerVersionMismatchError{Id: id, Expected: expectedVersion, Actual: current.Version}
+	}
+	delete(repo.Data, key)
+	return nil
+}
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newCustomerService returns a service whose clock stands still at testNow
+func newCustomerService(repository CustomerRepository, idService IdService) CustomerService {
+	service := NewCustomerService(repository, idService, newIdempotencyInMemoryRepository(), DefaultIdempotencyWindow)
+	service.now = func() time.Time { return testNow }
+	return service
 }
 
 func TestCustomerService_CreateCustomer(t *testing.T) {
@@ -47,7 +115,7 @@ func TestCustomerService_CreateCustomer(t *testing.T) {
 		ReturnedId: "1",
 	}
 	idService := NewIdService(idRepository)
-	service := NewCustomerService(customerRepository, idService)
+	service := newCustomerService(customerRepository, idService)
 
 	// and
 	command := CreateCustomerCommand{
@@ -56,10 +124,10 @@ func TestCustomerService_CreateCustomer(t *testing.T) {
 	}
 
 	// when
-	customerId, _ := service.CreateCustomer(command)
+	customerId, _ := service.CreateCustomer(acme, command)
 
 	// then
-	assert.Equal(t, idRepository.ReturnedId, customerId.Raw, "Customer ID should be 'mock-id'")
+	assert.Equal(t, NewCustomerId(idRepository.ReturnedId), customerId, "Customer ID should be built from the generated id")
 }
 
 func TestCustomerService_CreateExistingCustomer(t *testing.T) {
@@ -69,7 +137,7 @@ func TestCustomerService_CreateExistingCustomer(t *testing.T) {
 		ReturnedId: "1",
 	}
 	idService := NewIdService(idRepository)
-	service := NewCustomerService(customerRepository, idService)
+	service := newCustomerService(customerRepository, idService)
 
 	// and
 	command := CreateCustomerCommand{
@@ -78,10 +146,10 @@ func TestCustomerService_CreateExistingCustomer(t *testing.T) {
 	}
 
 	// and
-	customerId, _ := service.CreateCustomer(command)
+	customerId, _ := service.CreateCustomer(acme, command)
 
 	// when
-	_, err := service.CreateCustomer(command)
+	_, err := service.CreateCustomer(acme, command)
 
 	// then
 	assert.Error(t, err, "Creating customer with same id should produce an error")
@@ -95,7 +163,7 @@ func TestCustomerService_GetExistingCustomer(t *testing.T) {
 		ReturnedId: "1",
 	}
 	idService := NewIdService(idRepository)
-	service := NewCustomerService(customerRepository, idService)
+	service := newCustomerService(customerRepository, idService)
 
 	// and
 	command := CreateCustomerCommand{
@@ -104,17 +172,21 @@ func TestCustomerService_GetExistingCustomer(t *testing.T) {
 	}
 
 	// and
-	customerId, _ := service.CreateCustomer(command)
+	customerId, _ := service.CreateCustomer(acme, command)
 
 	// when
-	customer, found := service.GetCustomer(customerId)
+	customer, found, _ := service.GetCustomer(acme, customerId)
 
 	// then
 	assert.True(t, found, "Customer should be found")
 	expectedCustomer := Customer{
-		Id:   customerId,
-		Name: command.Name,
-		Age:  command.Age,
+		Tenant:    acme,
+		Id:        customerId,
+		Name:      command.Name,
+		Age:       command.Age,
+		Version:   1,
+		CreatedAt: testNow,
+		UpdatedAt: testNow,
 	}
 	assert.Equal(t, expectedCustomer, customer, "Returned customer should match mock data")
 }
@@ -126,11 +198,304 @@ func TestCustomerService_GetNotExistingCustomer(t *testing.T) {
 		ReturnedId: "1",
 	}
 	idService := NewIdService(idRepository)
-	service := NewCustomerService(customerRepository, idService)
+	service := newCustomerService(customerRepository, idService)
 
 	// when
-	_, found := service.GetCustomer(CustomerId{Raw: "not-existing"})
+	_, found, _ := service.GetCustomer(acme, CustomerId{Raw: "not-existing"})
 
 	// then
 	assert.False(t, found, "Customer should not be found")
 }
+
+func TestCustomerService_ListCustomers(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idService := NewIdService(&IdSequenceRepository{})
+	service := newCustomerService(customerRepository, idService)
+
+	// and
+	for i := 0; i < 5; i++ {
+		service.CreateCustomer(acme, CreateCustomerCommand{Name: "John Doe", Age: 30 + i})
+	}
+
+	// when
+	firstPage, err := service.ListCustomers(acme, CustomerQuery{}, CustomerPageRequest{Limit: 3})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []CustomerId{NewCustomerId("1"), NewCustomerId("2"), NewCustomerId("3")}, customerIds(firstPage.Items))
+	assert.Equal(t, &CustomerCursor{After: firstPage.Items[2]}, firstPage.NextCursor)
+
+	// when
+	secondPage, err := service.ListCustomers(acme, CustomerQuery{}, CustomerPageRequest{Cursor: firstPage.NextCursor.Encode(), Limit: 3})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []CustomerId{NewCustomerId("4"), NewCustomerId("5")}, customerIds(secondPage.Items))
+	assert.Nil(t, secondPage.NextCursor, "Last page should not have a next cursor")
+}
+
+func TestCustomerService_ListCustomersWithInvalidCursor(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idService := NewIdService(&IdSequenceRepository{})
+	service := newCustomerService(customerRepository, idService)
+
+	// when
+	_, err := service.ListCustomers(acme, CustomerQuery{}, CustomerPageRequest{Cursor: "not-a-cursor", Limit: 3})
+
+	// then
+	assert.Equal(t, InvalidCursorError{Cursor: "not-a-cursor"}, err)
+}
+
+func TestCustomerService_UpdateExistingCustomer(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idRepository := &IdMockRepository{
+		ReturnedId: "1",
+	}
+	idService := NewIdService(idRepository)
+	service := newCustomerService(customerRepository, idService)
+
+	// and
+	customerId, _ := service.CreateCustomer(acme, CreateCustomerCommand{Name: "John Doe", Age: 30})
+
+	// when
+	updated, err := service.UpdateCustomer(acme, customerId, 1, UpdateCustomerCommand{Name: "Jane Doe", Age: 31})
+
+	// then
+	assert.NoError(t, err)
+	expectedCustomer := Customer{Tenant: acme, Id: customerId, Name: "Jane Doe", Age: 31, Version: 2, CreatedAt: testNow, UpdatedAt: testNow}
+	assert.Equal(t, expectedCustomer, updated)
+	customer, _, _ := service.GetCustomer(acme, customerId)
+	assert.Equal(t, expectedCustomer, customer, "Stored customer should be replaced")
+}
+
+func TestCustomerService_UpdateNotExistingCustomer(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idRepository := &IdMockRepository{
+		ReturnedId: "1",
+	}
+	idService := NewIdService(idRepository)
+	service := newCustomerService(customerRepository, idService)
+
+	// and
+	customerId := CustomerId{Raw: "not-existing"}
+
+	// when
+	_, err := service.UpdateCustomer(acme, customerId, 1, UpdateCustomerCommand{Name: "Jane Doe", Age: 31})
+
+	// then
+	assert.Equal(t, CustomerNotFoundError{Id: customerId}, err, "Error should be of type CustomerNotFoundError")
+}
+
+func TestCustomerService_PatchExistingCustomer(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idRepository := &IdMockRepository{
+		ReturnedId: "1",
+	}
+	idService := NewIdService(idRepository)
+	service := newCustomerService(customerRepository, idService)
+
+	// and
+	customerId, _ := service.CreateCustomer(acme, CreateCustomerCommand{Name: "John Doe", Age: 30})
+
+	// and
+	age := 31
+
+	// when
+	patched, err := service.PatchCustomer(acme, customerId, 1, PatchCustomerCommand{Age: &age})
+
+	// then
+	assert.NoError(t, err)
+	expectedCustomer := Customer{Tenant: acme, Id: customerId, Name: "John Doe", Age: 31, Version: 2, CreatedAt: testNow, UpdatedAt: testNow}
+	assert.Equal(t, expectedCustomer, patched, "Only patched fields should change")
+	customer, _, _ := service.GetCustomer(acme, customerId)
+	assert.Equal(t, expectedCustomer, customer)
+}
+
+func TestCustomerService_PatchNotExistingCustomer(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idRepository := &IdMockRepository{
+		ReturnedId: "1",
+	}
+	idService := NewIdService(idRepository)
+	service := newCustomerService(customerRepository, idService)
+
+	// and
+	customerId := CustomerId{Raw: "not-existing"}
+	name := "Jane Doe"
+
+	// when
+	_, err := service.PatchCustomer(acme, customerId, 1, PatchCustomerCommand{Name: &name})
+
+	// then
+	assert.Equal(t, CustomerNotFoundError{Id: customerId}, err, "Error should be of type CustomerNotFoundError")
+}
+
+func TestCustomerService_DeleteExistingCustomer(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idRepository := &IdMockRepository{
+		ReturnedId: "1",
+	}
+	idService := NewIdService(idRepository)
+	service := newCustomerService(customerRepository, idService)
+
+	// and
+	command := CreateCustomerCommand{
+		Name: "John Doe",
+		Age:  30,
+	}
+
+	// and
+	customerId, _ := service.CreateCustomer(acme, command)
+
+	// when
+	err := service.DeleteCustomer(acme, customerId, 1)
+
+	// then
+	assert.NoError(t, err, "Deleting existing customer should not produce an error")
+	_, found, _ := service.GetCustomer(acme, customerId)
+	assert.False(t, found, "Deleted customer should not be found")
+}
+
+func TestCustomerService_DeleteNotExistingCustomer(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idRepository := &IdMockRepository{
+		ReturnedId: "1",
+	}
+	idService := NewIdService(idRepository)
+	service := newCustomerService(customerRepository, idService)
+
+	// and
+	customerId := CustomerId{Raw: "not-existing"}
+
+	// when
+	err := service.DeleteCustomer(acme, customerId, 1)
+
+	// then
+	assert.Equal(t, CustomerNotFoundError{Id: customerId}, err, "Error should be of type CustomerNotFoundError")
+}
+
+func TestCustomerService_MutateStaleVersion(t *testing.T) {
+	name := "Johnny"
+	tests := []struct {
+		name   string
+		mutate func(service CustomerService, customerId CustomerId) error
+	}{
+		{
+			name: "update",
+			mutate: func(service CustomerService, customerId CustomerId) error {
+				_, err := service.UpdateCustomer(acme, customerId, 1, UpdateCustomerCommand{Name: "Johnny", Age: 32})
+				return err
+			},
+		},
+		{
+			name: "patch",
+			mutate: func(service CustomerService, customerId CustomerId) error {
+				_, err := service.PatchCustomer(acme, customerId, 1, PatchCustomerCommand{Name: &name})
+				return err
+			},
+		},
+		{
+			name: "delete",
+			mutate: func(service CustomerService, customerId CustomerId) error {
+				return service.DeleteCustomer(acme, customerId, 1)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			service := newCustomerService(newCustomerInMemoryRepository(), NewIdService(&IdSequenceRepository{}))
+			customerId, _ := service.CreateCustomer(acme, CreateCustomerCommand{Name: "John Doe", Age: 30})
+			service.UpdateCustomer(acme, customerId, 1, UpdateCustomerCommand{Name: "Jane Doe", Age: 31})
+
+			// when
+			err := tt.mutate(service, customerId)
+
+			// then
+			assert.Equal(t, CustomerVersionMismatchError{Id: customerId, Expected: 1, Actual: 2}, err)
+			customer, _, _ := service.GetCustomer(acme, customerId)
+			assert.Equal(t, Customer{Tenant: acme, Id: customerId, Name: "Jane Doe", Age: 31, Version: 2, CreatedAt: testNow, UpdatedAt: testNow}, customer, "Stale mutation should not be applied")
+		})
+	}
+}
+
+func TestCustomerService_UpdateAnyVersion(t *testing.T) {
+	// given
+	service := newCustomerService(newCustomerInMemoryRepository(), NewIdService(&IdSequenceRepository{}))
+	customerId, _ := service.CreateCustomer(acme, CreateCustomerCommand{Name: "John Doe", Age: 30})
+	service.UpdateCustomer(acme, customerId, 1, UpdateCustomerCommand{Name: "Jane Doe", Age: 31})
+
+	// when
+	updated, err := service.UpdateCustomer(acme, customerId, AnyVersion, UpdateCustomerCommand{Name: "Johnny", Age: 32})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+}
+
+func TestCustomerService_Times(t *testing.T) {
+	// given
+	now := testNow
+	service := newCustomerService(newCustomerInMemoryRepository(), NewIdService(&IdSequenceRepository{}))
+	service.now = func() time.Time { return now }
+	customerId, _ := service.CreateCustomer(acme, CreateCustomerCommand{Name: "John Doe", Age: 30})
+	createdAt := now
+
+	// when
+	now = now.Add(time.Hour)
+	updated, _ := service.UpdateCustomer(acme, customerId, 1, UpdateCustomerCommand{Name: "Jane Doe", Age: 31})
+	now = now.Add(time.Hour)
+	age := 32
+	patched, _ := service.PatchCustomer(acme, customerId, 2, PatchCustomerCommand{Age: &age})
+
+	// then
+	assert.Equal(t, createdAt, updated.CreatedAt, "Creation time should be kept")
+	assert.Equal(t, createdAt.Add(time.Hour), updated.UpdatedAt)
+	assert.Equal(t, createdAt, patched.CreatedAt)
+	assert.Equal(t, createdAt.Add(2*time.Hour), patched.UpdatedAt)
+}
+
+func TestCustomerService_TenantIsolation(t *testing.T) {
+	// given
+	customerRepository := newCustomerInMemoryRepository()
+	idRepository := &IdMockRepository{
+		ReturnedId: "1",
+	}
+	idService := NewIdService(idRepository)
+	service := newCustomerService(customerRepository, idService)
+	globex := TenantId{Raw: "globex"}
+
+	// and
+	customerId, _ := service.CreateCustomer(acme, CreateCustomerCommand{Name: "John Doe", Age: 30})
+
+	// when
+	_, found, _ := service.GetCustomer(globex, customerId)
+	page, _ := service.ListCustomers(globex, CustomerQuery{}, CustomerPageRequest{Limit: 10})
+	_, updateErr := service.UpdateCustomer(globex, customerId, AnyVersion, UpdateCustomerCommand{Name: "Jane Doe", Age: 31})
+	deleteErr := service.DeleteCustomer(globex, customerId, AnyVersion)
+
+	// then
+	assert.False(t, found, "Customer should not be visible to another tenant")
+	assert.Empty(t, page.Items)
+	assert.Equal(t, CustomerNotFoundError{Id: customerId}, updateErr)
+	assert.Equal(t, CustomerNotFoundError{Id: customerId}, deleteErr)
+	customer, _, _ := service.GetCustomer(acme, customerId)
+	assert.Equal(t, "John Doe", customer.Name, "Customer should stay untouched")
+}
+
+func customerIds(customers []Customer) []CustomerId {
+	ids := []CustomerId{}
+	for _, customer := range customers {
+		ids = append(ids, customer.Id)
+	}
+	return ids
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,6 +69,14 @@ func FuzzCreateCustomerCommand_Validation(f *testing.F) {
 
 		command := CreateCustomerCommand{Name: name, Age: age}
 		err := validation.Validate(command)
+		// arbitrary strings are mostly not person names, which is the only rule left to fail
+		var invalidInput validation.InvalidInput
+		if errors.As(err, &invalidInput) {
+			for _, fieldErr := range invalidInput.FieldErrors(validation.DefaultTranslator()) {
+				assert.Equal(t, "personname", fieldErr.Rule)
+			}
+			return
+		}
 		assert.NoError(t, err)
 	})
 }
@@ -80,32 +89,37 @@ func TestCustomer_Validation(t *testing.T) {
 	}{
 		{
 			name:      "valid customer",
-			customer:  Customer{Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 25},
+			customer:  Customer{Tenant: acme, Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 25},
 			expectErr: false,
 		},
 		{
 			name:      "empty id",
-			customer:  Customer{Id: CustomerId{Raw: ""}, Name: "John Doe", Age: 25},
+			customer:  Customer{Tenant: acme, Id: CustomerId{Raw: ""}, Name: "John Doe", Age: 25},
+			expectErr: true,
+		},
+		{
+			name:      "no tenant",
+			customer:  Customer{Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 25},
 			expectErr: true,
 		},
 		{
 			name:      "empty name",
-			customer:  Customer{Id: CustomerId{Raw: "123"}, Name: "", Age: 25},
+			customer:  Customer{Tenant: acme, Id: CustomerId{Raw: "123"}, Name: "", Age: 25},
 			expectErr: true,
 		},
 		{
 			name:      "name too long",
-			customer:  Customer{Id: CustomerId{Raw: "123"}, Name: "John Doe with a very long name that exceeds 30 characters", Age: 25},
+			customer:  Customer{Tenant: acme, Id: CustomerId{Raw: "123"}, Name: "John Doe with a very long name that exceeds 30 characters", Age: 25},
 			expectErr: true,
 		},
 		{
 			name:      "age too low",
-			customer:  Customer{Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 0},
+			customer:  Customer{Tenant: acme, Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 0},
 			expectErr: true,
 		},
 		{
 			name:      "age too high",
-			customer:  Customer{Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 201},
+			customer:  Customer{Tenant: acme, Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 201},
 			expectErr: true,
 		},
 	}
@@ -145,7 +159,7 @@ func TestCreateCustomerCommand_toCustomer(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			customer, err := tt.command.toCustomer(tt.customerId)
+			customer, err := tt.command.toCustomer(acme, tt.customerId)
 			if tt.expectErr {
 				assert.Error(t, err)
 				assert.Equal(t, Customer{}, customer)
@@ -158,3 +172,106 @@ func TestCreateCustomerCommand_toCustomer(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateCustomerCommand_toCustomer(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   UpdateCustomerCommand
+		expectErr bool
+	}{
+		{
+			name:      "valid command",
+			command:   UpdateCustomerCommand{Name: "John Doe", Age: 25},
+			expectErr: false,
+		},
+		{
+			name:      "empty name",
+			command:   UpdateCustomerCommand{Name: "", Age: 25},
+			expectErr: true,
+		},
+		{
+			name:      "age too high",
+			command:   UpdateCustomerCommand{Name: "John Doe", Age: 201},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			customerId := CustomerId{Raw: "123"}
+			customer, err := tt.command.toCustomer(acme, customerId)
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Equal(t, Customer{}, customer)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, Customer{Tenant: acme, Id: customerId, Name: tt.command.Name, Age: tt.command.Age}, customer)
+			}
+		})
+	}
+}
+
+func TestPatchCustomerCommand_applyTo(t *testing.T) {
+	emptyName := ""
+	newName := "Jane Doe"
+	tooHighAge := 201
+	newAge := 40
+	original := Customer{Tenant: acme, Id: CustomerId{Raw: "123"}, Name: "John Doe", Age: 25}
+
+	tests := []struct {
+		name string
+		// original defaults to the customer above
+		original  Customer
+		command   PatchCustomerCommand
+		expected  Customer
+		expectErr bool
+	}{
+		{
+			name:     "empty patch",
+			command:  PatchCustomerCommand{},
+			expected: original,
+		},
+		{
+			name:     "name only",
+			command:  PatchCustomerCommand{Name: &newName},
+			expected: Customer{Tenant: acme, Id: original.Id, Name: newName, Age: original.Age},
+		},
+		{
+			name:     "both fields",
+			command:  PatchCustomerCommand{Name: &newName, Age: &newAge},
+			expected: Customer{Tenant: acme, Id: original.Id, Name: newName, Age: newAge},
+		},
+		{
+			name:      "empty name",
+			command:   PatchCustomerCommand{Name: &emptyName},
+			expectErr: true,
+		},
+		{
+			name:      "age too high",
+			command:   PatchCustomerCommand{Age: &tooHighAge},
+			expectErr: true,
+		},
+		{
+			name:     "age of a customer named before names were restricted",
+			original: Customer{Tenant: acme, Id: original.Id, Name: "John Doe Jr. 2", Age: 25},
+			command:  PatchCustomerCommand{Age: &newAge},
+			expected: Customer{Tenant: acme, Id: original.Id, Name: "John Doe Jr. 2", Age: newAge},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.original == (Customer{}) {
+				tt.original = original
+			}
+			customer, err := tt.command.applyTo(tt.original)
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Equal(t, Customer{}, customer)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, customer)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyWindow is how long a create remembers its idempotency key; a retry after it creates anew
+type IdempotencyWindow time.Duration
+
+const DefaultIdempotencyWindow = IdempotencyWindow(24 * time.Hour)
+
+// idempotencyLease is how long a create in progress holds its key; a retry after it takes the key over, so a
+// create that never completes, e.g. because the process died, does not block the key for the whole window
+const idempotencyLease = time.Minute
+
+type InvalidIdempotencyKeyError struct {
+	Key    string
+	Reason string
+}
+
+func (e InvalidIdempotencyKeyError) Error() string {
+	return fmt.Sprintf("invalid idempotency key: %s", e.Reason)
+}
+
+// IdempotencyKeyReusedError is returned when a key is sent again with a different request
+type IdempotencyKeyReusedError struct {
+	Key string
+}
+
+func (e IdempotencyKeyReusedError) Error() string {
+	return fmt.Sprintf("idempotency key %q was already used for a different request", e.Key)
+}
+
+// IdempotencyKeyInProgressError is returned when a key is sent again before its first request has completed
+type IdempotencyKeyInProgressError struct {
+	Key string
+}
+
+func (e IdempotencyKeyInProgressError) Error() string {
+	return fmt.Sprintf("a request with idempotency key %q is still in progress", e.Key)
+}
+
+// IdempotencyRecord ties a client's key to the request sent with it and, once created, the customer;
+// keys are scoped by tenant, so tenants cannot observe each other's keys
+type IdempotencyRecord struct {
+	Tenant TenantId
+	Key    string
+	// Fingerprint is the SHA-256 of the command, telling a retry from a different request under the same key
+	Fingerprint [sha256.Size]byte
+	// CustomerId is zero while the create is in progress
+	CustomerId CustomerId
+	// ExpiresAt ends the lease of a create in progress, and the idempotency window once it completed
+	ExpiresAt time.Time
+}
+
+func (record IdempotencyRecord) completed() bool {
+	return record.CustomerId.Raw != ""
+}
+
+// IdempotencyRepository reports failures of its storage as errors, like CustomerRepository
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey stores the record unless an unexpired record of the same tenant and key exists,
+	// which it returns instead; expired records are replaced
+	ReserveIdempotencyKey(record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error)
+	// CompleteIdempotencyKey replaces the reserved record by its completed version, expiry included
+	CompleteIdempotencyKey(record IdempotencyRecord) error
+	// ReleaseIdempotencyKey drops a reservation whose create failed, so a retry can go ahead
+	ReleaseIdempotencyKey(tenant TenantId, key string) error
+}
+
+func validateIdempotencyKey(key string) error {
+	if key == "" || len(key) > MaxIdempotencyKeyLength {
+		return InvalidIdempotencyKeyError{Key: key, Reason: "wrong length"}
+	}
+	for _, char := range key {
+		if char < 0x20 || char > 0x7e {
+			return InvalidIdempotencyKeyError{Key: key, Reason: "only printable ASCII characters are allowed"}
+		}
+	}
+	return nil
+}
+
+func fingerprintOf(command CreateCustomerCommand) [sha256.Size]byte {
+	encoded, _ := json.Marshal(command)
+	return sha256.Sum256(encoded)
+}
@@ -0,0 +1,232 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type idempotencyRecordKey struct {
+	Tenant TenantId
+	Key    string
+}
+
+type IdempotencyInMemoryRepository struct {
+	Data map[idempotencyRecordKey]IdempotencyRecord
+}
+
+func newIdempotencyInMemoryRepository() IdempotencyRepository {
+	return &IdempotencyInMemoryRepository{Data: map[idempotencyRecordKey]IdempotencyRecord{}}
+}
+
+func (repo IdempotencyInMemoryRepository) ReserveIdempotencyKey(record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error) {
+	key := idempotencyRecordKey{Tenant: record.Tenant, Key: record.Key}
+	if existing, ok := repo.Data[key]; ok && now.Before(existing.ExpiresAt) {
+		return existing, false, nil
+	}
+	repo.Data[key] = record
+	return record, true, nil
+}
+
+func (repo IdempotencyInMemoryRepository) CompleteIdempotencyKey(record IdempotencyRecord) error {
+	repo.Data[idempotencyRecordKey{Tenant: record.Tenant, Key: record.Key}] = record
+	return nil
+}
+
+func (repo IdempotencyInMemoryRepository) ReleaseIdempotencyKey(tenant TenantId, key string) error {
+	delete(repo.Data, idempotencyRecordKey{Tenant: tenant, Key: key})
+	return nil
+}
+
+// panickingCustomerRepository panics on the first create, as a bug behind the service would
+type panickingCustomerRepository struct {
+	CustomerRepository
+	panicked *bool
+}
+
+func (repo panickingCustomerRepository) CreateCustomer(customer Customer) (CustomerId, error) {
+	if !*repo.panicked {
+		*repo.panicked = true
+		panic("storage bug")
+	}
+	return repo.CustomerRepository.CreateCustomer(customer)
+}
+
+func newIdempotentCustomerServiceAt(now *time.Time) (CustomerService, IdempotencyRepository) {
+	idempotency := newIdempotencyInMemoryRepository()
+	service := NewCustomerService(newCustomerInMemoryRepository(), NewIdService(&IdSequenceRepository{}), idempotency, IdempotencyWindow(time.Hour))
+	service.now = func() time.Time { return *now }
+	return service, idempotency
+}
+
+func TestCustomerService_CreateCustomerIdempotently(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := newIdempotentCustomerServiceAt(&now)
+	command := CreateCustomerCommand{Name: "John Doe", Age: 30}
+
+	// when
+	created, createReplayed, createErr := service.CreateCustomerIdempotently(acme, "key-1", command)
+	retried, retryReplayed, retryErr := service.CreateCustomerIdempotently(acme, "key-1", command)
+
+	// then
+	require.NoError(t, createErr)
+	require.NoError(t, retryErr)
+	assert.False(t, createReplayed)
+	assert.True(t, retryReplayed)
+	assert.Equal(t, created, retried, "Retry should return the customer created first")
+	page, _ := service.ListCustomers(acme, CustomerQuery{}, CustomerPageRequest{Limit: 10})
+	assert.Len(t, page.Items, 1, "Retry should not create another customer")
+}
+
+func TestCustomerService_CreateCustomerIdempotentlyRejects(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	command := CreateCustomerCommand{Name: "John Doe", Age: 30}
+
+	tests := []struct {
+		name        string
+		prepare     func(service CustomerService, idempotency IdempotencyRepository)
+		key         string
+		expectedErr error
+	}{
+		{
+			name: "key reused for another command",
+			prepare: func(service CustomerService, idempotency IdempotencyRepository) {
+				service.CreateCustomerIdempotently(acme, "key-1", CreateCustomerCommand{Name: "Jane Doe", Age: 31})
+			},
+			key:         "key-1",
+			expectedErr: IdempotencyKeyReusedError{Key: "key-1"},
+		},
+		{
+			name: "key in progress",
+			prepare: func(service CustomerService, idempotency IdempotencyRepository) {
+				idempotency.ReserveIdempotencyKey(IdempotencyRecord{Tenant: acme, Key: "key-1", Fingerprint: fingerprintOf(command), ExpiresAt: now.Add(time.Hour)}, now)
+			},
+			key:         "key-1",
+			expectedErr: IdempotencyKeyInProgressError{Key: "key-1"},
+		},
+		{
+			name:        "empty key",
+			prepare:     func(service CustomerService, idempotency IdempotencyRepository) {},
+			key:         "",
+			expectedErr: InvalidIdempotencyKeyError{Key: "", Reason: "wrong length"},
+		},
+		{
+			name:        "too long key",
+			prepare:     func(service CustomerService, idempotency IdempotencyRepository) {},
+			key:         strings.Repeat("k", 256),
+			expectedErr: InvalidIdempotencyKeyError{Key: strings.Repeat("k", 256), Reason: "wrong length"},
+		},
+		{
+			name:        "key with control character",
+			prepare:     func(service CustomerService, idempotency IdempotencyRepository) {},
+			key:         "key\n1",
+			expectedErr: InvalidIdempotencyKeyError{Key: "key\n1", Reason: "only printable ASCII characters are allowed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			now := now
+			service, idempotency := newIdempotentCustomerServiceAt(&now)
+			tt.prepare(service, idempotency)
+
+			// when
+			_, _, err := service.CreateCustomerIdempotently(acme, tt.key, command)
+
+			// then
+			assert.Equal(t, tt.expectedErr, err)
+		})
+	}
+}
+
+func TestCustomerService_CreateCustomerIdempotentlyAfterWindow(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := newIdempotentCustomerServiceAt(&now)
+	first, _, _ := service.CreateCustomerIdempotently(acme, "key-1", CreateCustomerCommand{Name: "John Doe", Age: 30})
+
+	// when
+	now = now.Add(time.Hour)
+	second, replayed, err := service.CreateCustomerIdempotently(acme, "key-1", CreateCustomerCommand{Name: "Jane Doe", Age: 31})
+
+	// then
+	assert.NoError(t, err, "Expired key should be usable again")
+	assert.False(t, replayed)
+	assert.NotEqual(t, first, second)
+}
+
+func TestCustomerService_CreateCustomerIdempotentlyPerTenant(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := newIdempotentCustomerServiceAt(&now)
+	first, _, _ := service.CreateCustomerIdempotently(acme, "key-1", CreateCustomerCommand{Name: "John Doe", Age: 30})
+
+	// when
+	second, replayed, err := service.CreateCustomerIdempotently(TenantId{Raw: "globex"}, "key-1", CreateCustomerCommand{Name: "John Doe", Age: 30})
+
+	// then
+	assert.NoError(t, err)
+	assert.False(t, replayed, "Keys of another tenant should not be replayed")
+	assert.NotEqual(t, first, second)
+}
+
+func TestCustomerService_CreateCustomerIdempotentlyReleasesFailedKey(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := newIdempotentCustomerServiceAt(&now)
+
+	// when
+	_, _, invalidErr := service.CreateCustomerIdempotently(acme, "key-1", CreateCustomerCommand{Name: "", Age: 30})
+	_, replayed, err := service.CreateCustomerIdempotently(acme, "key-1", CreateCustomerCommand{Name: "John Doe", Age: 30})
+
+	// then
+	assert.Error(t, invalidErr)
+	assert.NoError(t, err, "A failed create should not hold on to the key")
+	assert.False(t, replayed)
+}
+
+func TestCustomerService_CreateCustomerIdempotentlyReleasesKeyOnPanic(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, _ := newIdempotentCustomerServiceAt(&now)
+	service.repository = panickingCustomerRepository{CustomerRepository: service.repository, panicked: new(bool)}
+	command := CreateCustomerCommand{Name: "John Doe", Age: 30}
+
+	// when
+	assert.Panics(t, func() { service.CreateCustomerIdempotently(acme, "key-1", command) })
+	_, replayed, err := service.CreateCustomerIdempotently(acme, "key-1", command)
+
+	// then
+	assert.NoError(t, err, "A panicking create should not hold on to the key")
+	assert.False(t, replayed)
+}
+
+func TestCustomerService_CreateCustomerIdempotentlyTakesOverAbandonedKey(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service, idempotency := newIdempotentCustomerServiceAt(&now)
+	command := CreateCustomerCommand{Name: "John Doe", Age: 30}
+	// a create that never completed, e.g. because the process died
+	idempotency.ReserveIdempotencyKey(IdempotencyRecord{Tenant: acme, Key: "key-1", Fingerprint: fingerprintOf(command), ExpiresAt: now.Add(idempotencyLease)}, now)
+
+	// when
+	_, _, inProgressErr := service.CreateCustomerIdempotently(acme, "key-1", command)
+	now = now.Add(idempotencyLease)
+	_, replayed, err := service.CreateCustomerIdempotently(acme, "key-1", command)
+
+	// then
+	assert.Equal(t, IdempotencyKeyInProgressError{Key: "key-1"}, inProgressErr)
+	assert.NoError(t, err, "Retry after the lease should take the key over")
+	assert.False(t, replayed)
+
+	// and
+	now = now.Add(30 * time.Minute)
+	_, replayed, err = service.CreateCustomerIdempotently(acme, "key-1", command)
+	assert.NoError(t, err)
+	assert.True(t, replayed, "Completed key should be kept for the whole window")
+}
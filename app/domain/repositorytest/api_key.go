@@ -0,0 +1,155 @@
+package repositorytest
+
+import (
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RunApiKey checks that an ApiKeyRepository implementation honours the repository contract; newRepository is
+// called for every case and must return an empty repository
+func RunApiKey(t *testing.T, newRepository func(t *testing.T) domain.ApiKeyRepository) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(24 * time.Hour)
+	key := domain.ApiKey{
+		Tenant:    domain.TenantId{Raw: "acme"},
+		Prefix:    "aaaaaaaaaaaaaaaa",
+		Name:      "billing",
+		Scopes:    []string{"customers:read", "customers:write"},
+		Hash:      make([]byte, 32),
+		CreatedAt: createdAt,
+		ExpiresAt: &expiresAt,
+	}
+
+	t.Run("Create And Get Api Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+
+		// when
+		err := repository.CreateApiKey(key)
+
+		// then
+		assert.NoError(t, err)
+
+		// and
+		stored, found := repository.GetApiKey(key.Prefix)
+		assert.True(t, found)
+		assert.Equal(t, key, stored)
+	})
+
+	t.Run("Create Existing Api Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateApiKey(key)
+
+		// when
+		other := key
+		other.Name = "crm"
+		err := repository.CreateApiKey(other)
+
+		// then
+		assert.Equal(t, domain.ApiKeyAlreadyExistsError{Prefix: key.Prefix}, err)
+		stored, _ := repository.GetApiKey(key.Prefix)
+		assert.Equal(t, "billing", stored.Name, "Existing api key should not be overwritten")
+	})
+
+	t.Run("Get Non-Existent Api Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+
+		// when
+		_, found := repository.GetApiKey("bbbbbbbbbbbbbbbb")
+
+		// then
+		assert.False(t, found)
+	})
+
+	t.Run("List Api Keys Oldest First", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		newer := key
+		newer.Prefix = "0000000000000000"
+		newer.CreatedAt = createdAt.Add(time.Minute)
+		repository.CreateApiKey(newer)
+		repository.CreateApiKey(key)
+
+		// when
+		keys := repository.ListApiKeys()
+
+		// then
+		assert.Equal(t, []domain.ApiKey{key, newer}, keys)
+	})
+
+	t.Run("Touch Api Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateApiKey(key)
+		usedAt := createdAt.Add(time.Hour)
+
+		// when
+		touched := repository.TouchApiKey(key.Prefix, usedAt)
+
+		// then
+		assert.True(t, touched)
+		stored, _ := repository.GetApiKey(key.Prefix)
+		assert.Equal(t, &usedAt, stored.LastUsedAt)
+	})
+
+	t.Run("Revoke Api Key Keeps First Revocation", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateApiKey(key)
+		revokedAt := createdAt.Add(time.Hour)
+
+		// when
+		first := repository.RevokeApiKey(key.Prefix, revokedAt)
+		second := repository.RevokeApiKey(key.Prefix, revokedAt.Add(time.Hour))
+
+		// then
+		assert.True(t, first)
+		assert.True(t, second)
+		stored, _ := repository.GetApiKey(key.Prefix)
+		assert.Equal(t, &revokedAt, stored.RevokedAt)
+	})
+
+	t.Run("Touch And Revoke Non-Existent Api Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+
+		// when
+		touched := repository.TouchApiKey(key.Prefix, createdAt)
+		revoked := repository.RevokeApiKey(key.Prefix, createdAt)
+
+		// then
+		assert.False(t, touched)
+		assert.False(t, revoked)
+	})
+
+	t.Run("Concurrent Touches Do Not Undo Revocation", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateApiKey(key)
+		revokedAt := createdAt.Add(time.Hour)
+
+		// when
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				repository.TouchApiKey(key.Prefix, createdAt.Add(time.Duration(i)*time.Second))
+			}(i)
+		}
+		repository.RevokeApiKey(key.Prefix, revokedAt)
+		wg.Wait()
+
+		// then
+		stored, _ := repository.GetApiKey(key.Prefix)
+		assert.Equal(t, &revokedAt, stored.RevokedAt, fmt.Sprintf("Revocation lost, last used at %v", stored.LastUsedAt))
+		assert.NotNil(t, stored.LastUsedAt)
+	})
+}
@@ -0,0 +1,321 @@
+// Package repositorytest provides conformance suites for the domain repository interfaces.
+package repositorytest
+
+import (
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run checks that a CustomerRepository implementation honours the repository contract; newRepository is called
+// for every case and must return an empty repository
+func Run(t *testing.T, newRepository func(t *testing.T) domain.CustomerRepository) {
+	tenant := domain.TenantId{Raw: "acme"}
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	john := domain.Customer{Tenant: tenant, Id: domain.CustomerId{Raw: "1"}, Name: "John Doe", Age: 30, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt}
+
+	t.Run("Create And Get Customer", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+
+		// when
+		id, err := repository.CreateCustomer(john)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, john.Id, id)
+
+		// and
+		customer, found := get(t, repository, tenant, id)
+		assert.True(t, found)
+		assert.Equal(t, john, customer)
+	})
+
+	t.Run("Create Existing Customer", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateCustomer(john)
+
+		// when
+		_, err := repository.CreateCustomer(domain.Customer{Tenant: tenant, Id: john.Id, Name: "Jane Doe", Age: 31})
+
+		// then
+		assert.Equal(t, domain.CustomerAlreadyExistsError{Id: john.Id}, err)
+		customer, _ := get(t, repository, tenant, john.Id)
+		assert.Equal(t, john, customer, "Existing customer should not be overwritten")
+	})
+
+	t.Run("Get Non-Existent Customer", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+
+		// when
+		_, found := get(t, repository, tenant, domain.CustomerId{Raw: "not-existing"})
+
+		// then
+		assert.False(t, found)
+	})
+
+	t.Run("Update Customer", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateCustomer(john)
+		updated := domain.Customer{Tenant: tenant, Id: john.Id, Name: "Jane Doe", Age: 31, Version: 2, CreatedAt: createdAt, UpdatedAt: updatedAt}
+
+		// when
+		err := repository.UpdateCustomer(updated, john.Version)
+
+		// then
+		assert.NoError(t, err)
+		customer, _ := get(t, repository, tenant, john.Id)
+		assert.Equal(t, updated, customer)
+	})
+
+	t.Run("Update Non-Existent Customer", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+
+		// when
+		err := repository.UpdateCustomer(john, john.Version)
+
+		// then
+		assert.Equal(t, domain.CustomerNotFoundError{Id: john.Id}, err)
+		_, found := get(t, repository, tenant, john.Id)
+		assert.False(t, found, "Update should not create a customer")
+	})
+
+	t.Run("Delete Customer", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateCustomer(john)
+
+		// when
+		err := repository.DeleteCustomer(tenant, john.Id, john.Version)
+
+		// then
+		assert.NoError(t, err)
+		_, found := get(t, repository, tenant, john.Id)
+		assert.False(t, found)
+		assert.Equal(t, domain.CustomerNotFoundError{Id: john.Id}, repository.DeleteCustomer(tenant, john.Id, john.Version), "Second delete should find nothing")
+	})
+
+	t.Run("Update Customer At Another Version", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateCustomer(john)
+		repository.UpdateCustomer(domain.Customer{Tenant: tenant, Id: john.Id, Name: "Jane Doe", Age: 31, Version: 2, CreatedAt: createdAt, UpdatedAt: updatedAt}, 1)
+
+		// when
+		err := repository.UpdateCustomer(domain.Customer{Tenant: tenant, Id: john.Id, Name: "Johnny", Age: 32, Version: 2, CreatedAt: createdAt, UpdatedAt: updatedAt}, 1)
+
+		// then
+		assert.Equal(t, domain.CustomerVersionMismatchError{Id: john.Id, Expected: 1, Actual: 2}, err)
+		customer, _ := get(t, repository, tenant, john.Id)
+		assert.Equal(t, "Jane Doe", customer.Name, "Stale update should not be applied")
+	})
+
+	t.Run("Delete Customer At Another Version", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateCustomer(john)
+
+		// when
+		err := repository.DeleteCustomer(tenant, john.Id, 2)
+
+		// then
+		assert.Equal(t, domain.CustomerVersionMismatchError{Id: john.Id, Expected: 2, Actual: 1}, err)
+		_, found := get(t, repository, tenant, john.Id)
+		assert.True(t, found, "Stale delete should not be applied")
+	})
+
+	t.Run("Concurrent Updates At The Same Version", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateCustomer(john)
+		const attempts = 50
+
+		// when
+		var wg sync.WaitGroup
+		errs := make(chan error, attempts)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- repository.UpdateCustomer(domain.Customer{Tenant: tenant, Id: john.Id, Name: "John Doe", Age: i + 1, Version: 2, CreatedAt: createdAt, UpdatedAt: updatedAt}, 1)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		// then
+		succeeded := 0
+		for err := range errs {
+			if err == nil {
+				succeeded++
+			} else {
+				assert.Equal(t, domain.CustomerVersionMismatchError{Id: john.Id, Expected: 1, Actual: 2}, err)
+			}
+		}
+		assert.Equal(t, 1, succeeded, "Exactly one update should win")
+	})
+
+	t.Run("List Customers", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		customers := []domain.Customer{
+			{Tenant: tenant, Id: domain.CustomerId{Raw: "1"}, Name: "John", Age: 30, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			{Tenant: tenant, Id: domain.CustomerId{Raw: "2"}, Name: "Joanna", Age: 30, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			{Tenant: tenant, Id: domain.CustomerId{Raw: "3"}, Name: "Josh", Age: 50, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			{Tenant: tenant, Id: domain.CustomerId{Raw: "4"}, Name: "Jordan", Age: 70, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			{Tenant: tenant, Id: domain.CustomerId{Raw: "5"}, Name: "Alice", Age: 40, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+			{Tenant: tenant, Id: domain.CustomerId{Raw: "6"}, Name: "Jo%", Age: 40, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt},
+		}
+		for _, customer := range customers {
+			repository.CreateCustomer(customer)
+		}
+
+		// and
+		prefix := "Jo"
+		seventy := 70
+		query := domain.CustomerQuery{
+			Filter: domain.CustomerFilter{NamePrefix: &prefix, AgeLt: &seventy},
+			Sort: []domain.CustomerSort{
+				{Field: domain.CustomerSortByAge, Descending: true},
+				{Field: domain.CustomerSortByName},
+			},
+		}
+
+		// when
+		firstPage := list(t, repository, tenant, query, domain.CustomerCursor{}, 2)
+		secondPage := list(t, repository, tenant, query, domain.CustomerCursor{After: firstPage[1]}, 2)
+		thirdPage := list(t, repository, tenant, query, domain.CustomerCursor{After: secondPage[1]}, 2)
+
+		// then
+		assert.Equal(t, []domain.Customer{customers[2], customers[5]}, firstPage)
+		assert.Equal(t, []domain.Customer{customers[1], customers[0]}, secondPage)
+		assert.Empty(t, thirdPage)
+	})
+
+	t.Run("Tenant Isolation", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		repository.CreateCustomer(john)
+		other := domain.TenantId{Raw: "globex"}
+		otherJohn := domain.Customer{Tenant: other, Id: john.Id, Name: "Other John", Age: 40, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt}
+
+		// when
+		_, err := repository.CreateCustomer(otherJohn)
+
+		// then
+		assert.NoError(t, err, "The same id should be free in another tenant")
+
+		// and
+		customer, _ := get(t, repository, other, john.Id)
+		assert.Equal(t, otherJohn, customer)
+		assert.Equal(t, []domain.Customer{otherJohn}, list(t, repository, other, domain.CustomerQuery{}, domain.CustomerCursor{}, 10))
+
+		// when
+		deleteErr := repository.DeleteCustomer(other, john.Id, 1)
+		err = repository.UpdateCustomer(domain.Customer{Tenant: other, Id: john.Id, Name: "Jane Doe", Age: 31, Version: 2, CreatedAt: createdAt, UpdatedAt: updatedAt}, 1)
+
+		// then
+		assert.NoError(t, deleteErr)
+		assert.Equal(t, domain.CustomerNotFoundError{Id: john.Id}, err)
+		customer, found := get(t, repository, tenant, john.Id)
+		assert.True(t, found)
+		assert.Equal(t, john, customer, "Other tenant should not touch the customer")
+
+		// and
+		_, found = get(t, repository, domain.TenantId{Raw: "initech"}, john.Id)
+		assert.False(t, found)
+	})
+	t.Run("Concurrent Creates", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		const customers = 50
+
+		// when
+		var wg sync.WaitGroup
+		errs := make(chan error, customers)
+		for i := 0; i < customers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := repository.CreateCustomer(domain.Customer{Tenant: tenant, Id: domain.CustomerId{Raw: fmt.Sprintf("%03d", i)}, Name: "John Doe", Age: 30, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt})
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		// then
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+		listed := list(t, repository, tenant, domain.CustomerQuery{}, domain.CustomerCursor{}, customers+1)
+		assert.Len(t, listed, customers, "Every concurrently created customer should be stored")
+	})
+
+	t.Run("Concurrent Creates With The Same Id", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		const attempts = 50
+
+		// when
+		var wg sync.WaitGroup
+		errs := make(chan error, attempts)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := repository.CreateCustomer(domain.Customer{Tenant: tenant, Id: john.Id, Name: "John Doe", Age: i + 1, Version: 1, CreatedAt: createdAt, UpdatedAt: createdAt})
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		// then
+		succeeded := 0
+		for err := range errs {
+			if err == nil {
+				succeeded++
+			} else {
+				assert.Equal(t, domain.CustomerAlreadyExistsError{Id: john.Id}, err)
+			}
+		}
+		assert.Equal(t, 1, succeeded, "Exactly one create should win")
+	})
+
+	t.Run("Delete Non-Existent Customer", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+
+		// when
+		err := repository.DeleteCustomer(tenant, domain.CustomerId{Raw: "not-existing"}, 1)
+
+		// then
+		assert.Equal(t, domain.CustomerNotFoundError{Id: domain.CustomerId{Raw: "not-existing"}}, err)
+	})
+}
+
+// get and list fail the test on storage errors, which no case expects
+func get(t *testing.T, repository domain.CustomerRepository, tenant domain.TenantId, id domain.CustomerId) (domain.Customer, bool) {
+	t.Helper()
+	customer, found, err := repository.GetCustomer(tenant, id)
+	require.NoError(t, err)
+	return customer, found
+}
+
+func list(t *testing.T, repository domain.CustomerRepository, tenant domain.TenantId, query domain.CustomerQuery, after domain.CustomerCursor, limit int) []domain.Customer {
+	t.Helper()
+	customers, err := repository.ListCustomers(tenant, query, after, limit)
+	require.NoError(t, err)
+	return customers
+}
@@ -0,0 +1,153 @@
+package repositorytest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RunIdempotency checks that an IdempotencyRepository implementation honours the repository contract;
+// newRepository is called for every case and must return an empty repository
+func RunIdempotency(t *testing.T, newRepository func(t *testing.T) domain.IdempotencyRepository) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	record := domain.IdempotencyRecord{
+		Tenant:      domain.TenantId{Raw: "acme"},
+		Key:         "key-1",
+		Fingerprint: sha256.Sum256([]byte("John Doe")),
+		ExpiresAt:   now.Add(time.Hour),
+	}
+
+	t.Run("Reserve Taken Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		reserve(t, repository, record, now)
+		completed := record
+		completed.CustomerId = domain.CustomerId{Raw: "1"}
+		assert.NoError(t, repository.CompleteIdempotencyKey(completed))
+
+		// when
+		existing, reserved := reserve(t, repository, record, now.Add(time.Minute))
+
+		// then
+		assert.False(t, reserved)
+		assert.Equal(t, completed, existing)
+	})
+
+	t.Run("Complete Key Extends Its Expiry", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		leased := record
+		leased.ExpiresAt = now.Add(time.Minute)
+		reserve(t, repository, leased, now)
+		completed := record
+		completed.CustomerId = domain.CustomerId{Raw: "1"}
+		assert.NoError(t, repository.CompleteIdempotencyKey(completed))
+
+		// when
+		existing, reserved := reserve(t, repository, record, now.Add(2*time.Minute))
+
+		// then
+		assert.False(t, reserved, "Completed key should outlive the lease it was reserved with")
+		assert.Equal(t, completed, existing)
+	})
+
+	t.Run("Reserve Key In Progress", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		reserve(t, repository, record, now)
+
+		// when
+		existing, reserved := reserve(t, repository, record, now.Add(time.Minute))
+
+		// then
+		assert.False(t, reserved)
+		assert.Equal(t, record, existing)
+	})
+
+	t.Run("Reserve Same Key In Another Tenant", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		reserve(t, repository, record, now)
+		other := record
+		other.Tenant = domain.TenantId{Raw: "globex"}
+
+		// when
+		_, reserved := reserve(t, repository, other, now)
+
+		// then
+		assert.True(t, reserved, "Keys should be scoped by tenant")
+	})
+
+	t.Run("Reserve Expired Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		reserve(t, repository, record, now)
+		later := now.Add(time.Hour)
+		renewed := record
+		renewed.ExpiresAt = later.Add(time.Hour)
+
+		// when
+		stored, reserved := reserve(t, repository, renewed, later)
+
+		// then
+		assert.True(t, reserved)
+		assert.Equal(t, renewed, stored)
+	})
+
+	t.Run("Reserve Released Key", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		reserve(t, repository, record, now)
+
+		// when
+		assert.NoError(t, repository.ReleaseIdempotencyKey(record.Tenant, record.Key))
+		_, reserved := reserve(t, repository, record, now)
+
+		// then
+		assert.True(t, reserved)
+	})
+
+	t.Run("Concurrent Reservations", func(t *testing.T) {
+		// given
+		repository := newRepository(t)
+		const attempts = 50
+
+		// when
+		var wg sync.WaitGroup
+		results := make(chan bool, attempts)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				attempt := record
+				attempt.CustomerId = domain.CustomerId{Raw: fmt.Sprint(i)}
+				_, reserved := reserve(t, repository, attempt, now)
+				results <- reserved
+			}(i)
+		}
+		wg.Wait()
+		close(results)
+
+		// then
+		reservations := 0
+		for reserved := range results {
+			if reserved {
+				reservations++
+			}
+		}
+		assert.Equal(t, 1, reservations, "Exactly one reservation should win")
+	})
+}
+
+// reserve asserts rather than requires no error, as it is also called from the goroutines of a case
+func reserve(t *testing.T, repository domain.IdempotencyRepository, record domain.IdempotencyRecord, now time.Time) (domain.IdempotencyRecord, bool) {
+	t.Helper()
+	stored, reserved, err := repository.ReserveIdempotencyKey(record, now)
+	assert.NoError(t, err)
+	return stored, reserved
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"fmt"
+)
+
+const MaxTenantIdLength = 64
+
+// DefaultTenant owns the customers stored before tenants were introduced
+var DefaultTenant = TenantId{Raw: "default"}
+
+type InvalidTenantIdError struct {
+	Raw    string
+	Reason string
+}
+
+func (e InvalidTenantIdError) Error() string {
+	return fmt.Sprintf("invalid tenant id %q: %s", e.Raw, e.Reason)
+}
+
+// TenantId names the business unit a customer belongs to; ids are lowercase letters, digits, hyphens and
+// underscores, starting with a letter or digit
+type TenantId struct {
+	Raw string `validate:"min=1"`
+}
+
+func ParseTenantId(raw string) (TenantId, error) {
+	if raw == "" || len(raw) > MaxTenantIdLength {
+		return TenantId{}, InvalidTenantIdError{Raw: raw, Reason: "wrong length"}
+	}
+	for i, char := range raw {
+		if !isTenantChar(char) || i == 0 && (char == '-' || char == '_') {
+			return TenantId{}, InvalidTenantIdError{Raw: raw, Reason: fmt.Sprintf("unexpected character %q", char)}
+		}
+	}
+	return TenantId{Raw: raw}, nil
+}
+
+func (id TenantId) IsZero() bool {
+	return id.Raw == ""
+}
+
+func (id TenantId) String() string {
+	return id.Raw
+}
+
+func isTenantChar(char rune) bool {
+	return char >= '0' && char <= '9' || char >= 'a' && char <= 'z' || char == '-' || char == '_'
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTenantId(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		expectErr bool
+	}{
+		{name: "letters", raw: "acme", expectErr: false},
+		{name: "digits, hyphens and underscores", raw: "acme-eu_2", expectErr: false},
+		{name: "longest", raw: strings.Repeat("a", 64), expectErr: false},
+		{name: "empty", raw: "", expectErr: true},
+		{name: "too long", raw: strings.Repeat("a", 65), expectErr: true},
+		{name: "uppercase", raw: "Acme", expectErr: true},
+		{name: "leading hyphen", raw: "-acme", expectErr: true},
+		{name: "slash", raw: "acme/eu", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, err := ParseTenantId(tt.raw)
+			if tt.expectErr {
+				assert.IsType(t, InvalidTenantIdError{}, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, TenantId{Raw: tt.raw}, tenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway/auth"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const ScopeApiKeysAdmin = "api-keys:admin"
+
+// knownScopes are the scopes api keys can be granted, i.e. the scopes the routes require
+var knownScopes = []string{ScopeCustomersRead, ScopeCustomersWrite, ScopeCustomersDelete, ScopeApiKeysAdmin}
+
+func init() {
+	err := validation.RegisterRule(validation.Rule{
+		Tag:   "knownscope",
+		Alias: "oneof=" + strings.Join(knownScopes, " "),
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type CreateApiKeyApiInput struct {
+	Name      string     `json:"name" validate:"min=1,max=100"`
+	Scopes    []string   `json:"scopes" validate:"min=1,dive,knownscope"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type ApiKeyApiOutput struct {
+	Id         string     `json:"id"`
+	Tenant     string     `json:"tenant"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// CreatedApiKeyApiOutput is the only response carrying the full key
+type CreatedApiKeyApiOutput struct {
+	ApiKeyApiOutput
+	Key string `json:"key"`
+}
+
+type ApiKeyListApiOutput struct {
+	Items []ApiKeyApiOutput `json:"items"`
+}
+
+func newApiKeyApiOutput(key domain.ApiKey) ApiKeyApiOutput {
+	return ApiKeyApiOutput{
+		Id:         key.Prefix,
+		Tenant:     key.Tenant.Raw,
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+func (apiInput CreateApiKeyApiInput) toCommand(tenant domain.TenantId) (domain.CreateApiKeyCommand, error) {
+	if err := validation.Validate(apiInput); err != nil {
+		return domain.CreateApiKeyCommand{}, err
+	}
+	return domain.CreateApiKeyCommand{
+		Tenant:    tenant,
+		Name:      apiInput.Name,
+		Scopes:    apiInput.Scopes,
+		ExpiresAt: apiInput.ExpiresAt,
+	}, nil
+}
+
+// requireGrantable rejects scopes the caller does not hold itself, so no key can grant more than its creator
+func requireGrantable(r *http.Request, scopes []string) error {
+	principal, _ := auth.PrincipalFrom(r.Context())
+	for _, scope := range scopes {
+		if !principal.HasScope(scope) {
+			return auth.InsufficientScopeError{Scope: scope}
+		}
+	}
+	return nil
+}
+
+// apiKeyVerifier lets the auth middleware accept keys of the ApiKeyService
+type apiKeyVerifier struct {
+	service domain.ApiKeyService
+}
+
+func (verifier apiKeyVerifier) VerifyApiKey(key string) (auth.Principal, error) {
+	apiKey, err := verifier.service.AuthenticateApiKey(key)
+	var invalidApiKeyErr domain.InvalidApiKeyError
+	if errors.As(err, &invalidApiKeyErr) {
+		return auth.Principal{}, auth.UnauthenticatedError{Reason: invalidApiKeyErr.Error()}
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return auth.Principal{Subject: "api-key:" + apiKey.Prefix, Tenant: apiKey.Tenant.Raw, Scopes: apiKey.Scopes}, nil
+}
+
+// apiKeyRouteScopes is the authorization policy of ApiKeyRouter, keyed by method and pattern under the base url
+var apiKeyRouteScopes = map[string]string{
+	"POST /":       ScopeApiKeysAdmin,
+	"GET /":        ScopeApiKeysAdmin,
+	"GET /{id}":    ScopeApiKeysAdmin,
+	"DELETE /{id}": ScopeApiKeysAdmin,
+}
+
+func ApiKeyRouter(service domain.ApiKeyService, r chi.Router) {
+	baseUrl := "/api-keys"
+	r.Route(baseUrl, func(r chi.Router) {
+		routes := authorizedRoutes{router: r, scopes: apiKeyRouteScopes}
+		// keys are created in, and managed within, the tenant of the caller, resolved as for customers
+		routes.handle(http.MethodPost, "/", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			var apiInput CreateApiKeyApiInput
+			if err := json.NewDecoder(r.Body).Decode(&apiInput); err != nil {
+				writeError(w, r, malformedRequestError{Err: err})
+				return
+			}
+			command, err := apiInput.toCommand(tenant)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if err := requireGrantable(r, command.Scopes); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			apiKey, key, err := service.CreateApiKey(command)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			w.Header().Set("Location", fmt.Sprintf("%s/%s", baseUrl, apiKey.Prefix))
+			// the key is shown once and must not end up in caches
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(CreatedApiKeyApiOutput{ApiKeyApiOutput: newApiKeyApiOutput(apiKey), Key: key})
+		})
+
+		routes.handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			keys := service.ListApiKeys(tenant)
+			items := make([]ApiKeyApiOutput, 0, len(keys))
+			for _, key := range keys {
+				items = append(items, newApiKeyApiOutput(key))
+			}
+			json.NewEncoder(w).Encode(ApiKeyListApiOutput{Items: items})
+		})
+
+		routes.handle(http.MethodGet, "/{id}", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			prefix := chi.URLParam(r, "id")
+			apiKey, found := service.GetApiKey(tenant, prefix)
+			if !found {
+				writeError(w, r, domain.ApiKeyNotFoundError{Prefix: prefix})
+				return
+			}
+			json.NewEncoder(w).Encode(newApiKeyApiOutput(apiKey))
+		})
+
+		// revoked keys are kept, so their use stays auditable
+		routes.handle(http.MethodDelete, "/{id}", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if err := service.RevokeApiKey(tenant, chi.URLParam(r, "id")); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+}
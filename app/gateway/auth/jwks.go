@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwk is the subset of RFC 7517 members needed for the supported algorithms
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// K is the symmetric key of an "oct" key
+	K string `json:"k"`
+	// N and E are the modulus and exponent of an "RSA" key
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X and Y are the curve and point of an "EC" key
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// verificationKey is a parsed jwk together with the only algorithm it may verify
+type verificationKey struct {
+	alg string
+	key any
+}
+
+// JwksFile holds the keys of a local JWKS file; the file is re-read whenever it changes, so keys are rotated
+// by adding the new key, switching the issuer over and removing the old key once its tokens have expired
+type JwksFile struct {
+	path string
+	// refreshInterval bounds how often the file is checked for changes
+	refreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]verificationKey
+	modTime     time.Time
+	size        int64
+	lastChecked time.Time
+}
+
+func NewJwksFile(path string, refreshInterval time.Duration) (*JwksFile, error) {
+	file := &JwksFile{path: path, refreshInterval: refreshInterval}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.load(info); err != nil {
+		return nil, err
+	}
+	file.lastChecked = time.Now()
+	return file, nil
+}
+
+// key returns the key with the given id; an empty id is only accepted when the file holds a single key
+func (file *JwksFile) key(kid string) (verificationKey, error) {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	file.refresh()
+	if kid == "" && len(file.keys) == 1 {
+		for _, key := range file.keys {
+			return key, nil
+		}
+	}
+	key, found := file.keys[kid]
+	if !found {
+		return verificationKey{}, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// refresh reloads the file if it changed since the last load; a file that cannot be read, e.g. one that is
+// being rewritten, leaves the current keys in place
+func (file *JwksFile) refresh() {
+	if time.Since(file.lastChecked) < file.refreshInterval {
+		return
+	}
+	file.lastChecked = time.Now()
+	info, err := os.Stat(file.path)
+	if err != nil {
+		slog.Warn("checking jwks file", "path", file.path, "error", err)
+		return
+	}
+	if info.ModTime().Equal(file.modTime) && info.Size() == file.size {
+		return
+	}
+	if err := file.load(info); err != nil {
+		slog.Warn("reloading jwks file", "path", file.path, "error", err)
+	}
+}
+
+func (file *JwksFile) load(info os.FileInfo) error {
+	content, err := os.ReadFile(file.path)
+	if err != nil {
+		return err
+	}
+	var set jwks
+	if err := json.Unmarshal(content, &set); err != nil {
+		return fmt.Errorf("reading jwks file %s: %w", file.path, err)
+	}
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for i, key := range set.Keys {
+		// keys for encryption cannot verify signatures
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		parsed, err := parseJwk(key)
+		if err != nil {
+			return fmt.Errorf("reading jwks file %s: key %d: %w", file.path, i, err)
+		}
+		if _, duplicate := keys[key.Kid]; duplicate {
+			return fmt.Errorf("reading jwks file %s: key id %q repeated", file.path, key.Kid)
+		}
+		keys[key.Kid] = parsed
+	}
+	file.keys = keys
+	file.modTime = info.ModTime()
+	file.size = info.Size()
+	return nil
+}
+
+func parseJwk(key jwk) (verificationKey, error) {
+	switch key.Kty {
+	case "oct":
+		secret, err := decodeSegment(key.K)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		return newVerificationKey(key.Alg, "HS256", secret)
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return verificationKey{}, fmt.Errorf("rsa exponent out of range")
+		}
+		return newVerificationKey(key.Alg, "RS256", &rsa.PublicKey{N: n, E: int(e.Int64())})
+	case "EC":
+		if key.Crv != "P-256" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return verificationKey{}, fmt.Errorf("point is not on curve P-256")
+		}
+		return newVerificationKey(key.Alg, "ES256", &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+// newVerificationKey pins the key to the algorithm implied by its type, so a token cannot pick another one
+func newVerificationKey(declared string, implied string, key any) (verificationKey, error) {
+	if declared != "" && declared != implied {
+		return verificationKey{}, fmt.Errorf("unsupported algorithm %q", declared)
+	}
+	return verificationKey{alg: implied, key: key}, nil
+}
+
+func decodeSegment(value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing key material")
+	}
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := decodeSegment(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtClaims carries the granted scopes as a space-separated "scope" claim, as in RFC 9068,
+// and the tenant of the caller, if bound to one
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Scope  string `json:"scope"`
+	Tenant string `json:"tenant_id"`
+}
+
+type TokenVerifier interface {
+	Verify(token string) (Principal, error)
+}
+
+// JwtOptions configures the registered claims checks; an empty Issuer or Audience is not checked
+type JwtOptions struct {
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew between the issuer and this service in exp and nbf checks
+	Leeway time.Duration
+}
+
+// JwtVerifier accepts HS256, RS256 and ES256 tokens signed with a key of the JWKS file; tokens must expire
+type JwtVerifier struct {
+	keys   *JwksFile
+	parser *jwt.Parser
+}
+
+func NewJwtVerifier(keys *JwksFile, options JwtOptions) TokenVerifier {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(options.Leeway),
+	}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+	if options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.Audience))
+	}
+	return &JwtVerifier{keys: keys, parser: jwt.NewParser(parserOptions...)}
+}
+
+func (verifier *JwtVerifier) Verify(token string) (Principal, error) {
+	var claims jwtClaims
+	if _, err := verifier.parser.ParseWithClaims(token, &claims, verifier.keyFor); err != nil {
+		return Principal{}, UnauthenticatedError{Reason: err.Error()}
+	}
+	if claims.Subject == "" {
+		return Principal{}, UnauthenticatedError{Reason: "token has no subject"}
+	}
+	return Principal{Subject: claims.Subject, Tenant: claims.Tenant, Scopes: strings.Fields(claims.Scope)}, nil
+}
+
+func (verifier *JwtVerifier) keyFor(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := verifier.keys.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, errors.New("token algorithm does not match the key")
+	}
+	return key.key, nil
+}
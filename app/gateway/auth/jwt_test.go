@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    any
+	public jwk
+}
+
+func newHmacKey(kid string) signingKey {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return signingKey{kid: kid, method: jwt.SigningMethodHS256, key: secret,
+		public: jwk{Kty: "oct", Kid: kid, K: encode(secret)}}
+}
+
+func newRsaKey(t *testing.T, kid string) signingKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodRS256, key: key,
+		public: jwk{Kty: "RSA", Kid: kid, Alg: "RS256", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}}
+}
+
+func newEcdsaKey(t *testing.T, kid string) signingKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodES256, key: key,
+		public: jwk{Kty: "EC", Kid: kid, Crv: "P-256", X: encode(key.X.FillBytes(make([]byte, 32))), Y: encode(key.Y.FillBytes(make([]byte, 32)))}}
+}
+
+func encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func writeJwks(t *testing.T, path string, keys ...signingKey) {
+	set := jwks{Keys: []jwk{}}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key.public)
+	}
+	content, err := json.Marshal(set)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+}
+
+func sign(t *testing.T, key signingKey, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	signed, err := token.SignedString(key.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "user-1",
+		Issuer:    "https://issuer.example.com",
+		Audience:  jwt.ClaimStrings{"customers"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func newVerifier(t *testing.T, keys ...signingKey) (TokenVerifier, string) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJwks(t, path, keys...)
+	file, err := NewJwksFile(path, 0)
+	require.NoError(t, err)
+	return NewJwtVerifier(file, JwtOptions{Issuer: "https://issuer.example.com", Audience: "customers"}), path
+}
+
+func TestJwtVerifier_Algorithms(t *testing.T) {
+	keys := []signingKey{newHmacKey("hmac"), newRsaKey(t, "rsa"), newEcdsaKey(t, "ecdsa")}
+	verifier, _ := newVerifier(t, keys...)
+
+	for _, key := range keys {
+		t.Run(key.method.Alg(), func(t *testing.T) {
+			// given
+			claims := jwtClaims{RegisteredClaims: validClaims(), Scope: "customers:read customers:write", Tenant: "acme"}
+
+			// when
+			principal, err := verifier.Verify(sign(t, key, claims))
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, Principal{Subject: "user-1", Tenant: "acme", Scopes: []string{"customers:read", "customers:write"}}, principal)
+		})
+	}
+}
+
+func TestJwtVerifier_RejectsInvalidClaims(t *testing.T) {
+	key := newHmacKey("hmac")
+	verifier, _ := newVerifier(t, key)
+
+	tests := []struct {
+		name   string
+		modify func(claims *jwt.RegisteredClaims)
+	}{
+		{
+			name: "expired",
+			modify: func(claims *jwt.RegisteredClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			},
+		},
+		{
+			name:   "without expiry",
+			modify: func(claims *jwt.RegisteredClaims) { claims.ExpiresAt = nil },
+		},
+		{
+			name:   "not yet valid",
+			modify: func(claims *jwt.RegisteredClaims) { claims.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) },
+		},
+		{
+			name:   "other issuer",
+			modify: func(claims *jwt.RegisteredClaims) { claims.Issuer = "https://evil.example.com" },
+		},
+		{
+			name:   "other audience",
+			modify: func(claims *jwt.RegisteredClaims) { claims.Audience = jwt.ClaimStrings{"billing"} },
+		},
+		{
+			name:   "without subject",
+			modify: func(claims *jwt.RegisteredClaims) { claims.Subject = "" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			claims := validClaims()
+			tt.modify(&claims)
+
+			// when
+			_, err := verifier.Verify(sign(t, key, claims))
+
+			// then
+			assert.ErrorAs(t, err, &UnauthenticatedError{})
+		})
+	}
+}
+
+func TestJwtVerifier_RejectsForgedTokens(t *testing.T) {
+	rsaKey := newRsaKey(t, "rsa")
+	verifier, _ := newVerifier(t, rsaKey, newHmacKey("hmac"))
+
+	t.Run("unsigned", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims())
+		token.Header["kid"] = "rsa"
+		unsigned, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(unsigned)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("hmac with the rsa key id", func(t *testing.T) {
+		forged := signingKey{kid: "rsa", method: jwt.SigningMethodHS256, key: rsaKey.key.(*rsa.PrivateKey).N.Bytes()}
+
+		_, err := verifier.Verify(sign(t, forged, validClaims()))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		_, err := verifier.Verify(sign(t, newHmacKey("other"), validClaims()))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("signed with another key", func(t *testing.T) {
+		_, err := verifier.Verify(sign(t, newHmacKey("hmac"), validClaims()))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestJwksFile_Rotation(t *testing.T) {
+	// given
+	oldKey := newEcdsaKey(t, "2024-01")
+	newKey := newEcdsaKey(t, "2024-02")
+	verifier, path := newVerifier(t, oldKey)
+
+	// when
+	writeJwks(t, path, oldKey, newKey)
+
+	// then
+	_, err := verifier.Verify(sign(t, oldKey, validClaims()))
+	assert.NoError(t, err, "Old key should be accepted during rotation")
+	_, err = verifier.Verify(sign(t, newKey, validClaims()))
+	assert.NoError(t, err, "New key should be picked up without restart")
+
+	// when
+	writeJwks(t, path, newKey)
+
+	// then
+	_, err = verifier.Verify(sign(t, oldKey, validClaims()))
+	assert.Error(t, err, "Removed key should be rejected")
+}
+
+func TestJwksFile_KeepsKeysWhenReloadFails(t *testing.T) {
+	// given
+	key := newHmacKey("hmac")
+	verifier, path := newVerifier(t, key)
+
+	// when
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [`), 0o644))
+
+	// then
+	_, err := verifier.Verify(sign(t, key, validClaims()))
+	assert.NoError(t, err)
+}
+
+func TestNewJwksFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "malformed json", content: `{"keys": [`},
+		{name: "unsupported key type", content: `{"keys": [{"kty": "OKP", "kid": "1", "x": "AA"}]}`},
+		{name: "unsupported curve", content: `{"keys": [{"kty": "EC", "kid": "1", "crv": "P-384", "x": "AA", "y": "AA"}]}`},
+		{name: "algorithm not matching key type", content: `{"keys": [{"kty": "oct", "kid": "1", "alg": "RS256", "k": "AA"}]}`},
+		{name: "repeated key id", content: `{"keys": [{"kty": "oct", "kid": "1", "k": "AA"}, {"kty": "oct", "kid": "1", "k": "AB"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			_, err := NewJwksFile(path, 0)
+
+			assert.Error(t, err)
+		})
+	}
+}
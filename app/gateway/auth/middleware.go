@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+type ApiKeyVerifier interface {
+	VerifyApiKey(key string) (Principal, error)
+}
+
+// Middleware authenticates requests with an API key in the X-API-Key header or else a bearer token, and puts
+// the principal on the request context; failures are passed to onError, which renders them in the caller's
+// error format
+func Middleware(tokens TokenVerifier, apiKeys ApiKeyVerifier, onError func(w http.ResponseWriter, r *http.Request, err error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, challenge, err := authenticate(r.Header, tokens, apiKeys)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", challenge)
+				onError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// AuthenticateHeader verifies the credentials of headers as Middleware does, for transports other than HTTP
+// that carry headers, such as gRPC metadata
+func AuthenticateHeader(header http.Header, tokens TokenVerifier, apiKeys ApiKeyVerifier) (Principal, error) {
+	principal, _, err := authenticate(header, tokens, apiKeys)
+	return principal, err
+}
+
+// authenticate also returns the WWW-Authenticate challenge of a failure, which names the bearer scheme only,
+// as API keys have no registered one
+func authenticate(header http.Header, tokens TokenVerifier, apiKeys ApiKeyVerifier) (Principal, string, error) {
+	if key := header.Get(apiKeyHeader); key != "" {
+		principal, err := apiKeys.VerifyApiKey(key)
+		return principal, "Bearer", err
+	}
+	token, found := bearerToken(header)
+	if !found {
+		return Principal{}, "Bearer", UnauthenticatedError{Reason: "missing bearer token or api key"}
+	}
+	principal, err := tokens.Verify(token)
+	return principal, `Bearer error="invalid_token"`, err
+}
+
+// bearerToken reads the Authorization header; the scheme is case-insensitive per RFC 7235
+func bearerToken(header http.Header) (string, bool) {
+	scheme, token, found := strings.Cut(header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RequireScope lets through requests whose principal was granted the scope; it belongs after Middleware
+func RequireScope(scope string, onError func(w http.ResponseWriter, r *http.Request, err error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, found := PrincipalFrom(r.Context())
+			if !found {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				onError(w, r, UnauthenticatedError{Reason: "missing bearer token"})
+				return
+			}
+			if !principal.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				onError(w, r, InsufficientScopeError{Scope: scope})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
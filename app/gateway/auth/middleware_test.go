@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type apiKeyVerifierFunc func(key string) (Principal, error)
+
+func (f apiKeyVerifierFunc) VerifyApiKey(key string) (Principal, error) {
+	return f(key)
+}
+
+func TestMiddleware(t *testing.T) {
+	key := newHmacKey("hmac")
+	verifier, _ := newVerifier(t, key)
+	onError := func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	}
+	apiKeys := apiKeyVerifierFunc(func(key string) (Principal, error) {
+		if key != "ak_valid" {
+			return Principal{}, UnauthenticatedError{Reason: "unknown key"}
+		}
+		return Principal{Subject: "api-key:valid"}, nil
+	})
+	handler := Middleware(verifier, apiKeys, onError)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFrom(r.Context())
+		w.Write([]byte(principal.Subject))
+	}))
+
+	tests := []struct {
+		name                    string
+		authorization           string
+		apiKey                  string
+		expectedStatus          int
+		expectedBody            string
+		expectedAuthenticateHdr string
+	}{
+		{
+			name:           "valid token",
+			authorization:  "Bearer " + sign(t, key, validClaims()),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "user-1",
+		},
+		{
+			name:           "case-insensitive scheme",
+			authorization:  "bearer " + sign(t, key, validClaims()),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "user-1",
+		},
+		{
+			name:           "valid api key",
+			apiKey:         "ak_valid",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "api-key:valid",
+		},
+		{
+			name:                    "invalid api key",
+			apiKey:                  "ak_invalid",
+			authorization:           "Bearer " + sign(t, key, validClaims()),
+			expectedStatus:          http.StatusUnauthorized,
+			expectedAuthenticateHdr: "Bearer",
+		},
+		{
+			name:                    "missing header",
+			expectedStatus:          http.StatusUnauthorized,
+			expectedAuthenticateHdr: "Bearer",
+		},
+		{
+			name:                    "other scheme",
+			authorization:           "Basic dXNlcjpwYXNz",
+			expectedStatus:          http.StatusUnauthorized,
+			expectedAuthenticateHdr: "Bearer",
+		},
+		{
+			name:                    "invalid token",
+			authorization:           "Bearer not-a-token",
+			expectedStatus:          http.StatusUnauthorized,
+			expectedAuthenticateHdr: `Bearer error="invalid_token"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			req, _ := http.NewRequest("GET", "/customers", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+
+			// when
+			handler.ServeHTTP(rr, req)
+
+			// then
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedAuthenticateHdr, rr.Header().Get("WWW-Authenticate"))
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Principal is the authenticated caller of a request; a principal bound to a tenant has Tenant set,
+// while one serving several tenants leaves it empty
+type Principal struct {
+	Subject string
+	Tenant  string
+	Scopes  []string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type UnauthenticatedError struct {
+	Reason string
+}
+
+func (e UnauthenticatedError) Error() string {
+	return fmt.Sprintf("unauthenticated: %s", e.Reason)
+}
+
+type InsufficientScopeError struct {
+	Scope string
+}
+
+func (e InsufficientScopeError) Error() string {
+	return fmt.Sprintf("missing scope %s", e.Scope)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal put on the context by Middleware
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
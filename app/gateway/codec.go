@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// codec reads and writes a representation; the first media type is the one responses are labelled with,
+// the others are aliases accepted from clients
+type codec struct {
+	mediaTypes []string
+	// etagSuffix tells the ETags of the representation apart, e.g. "3+xml"; JSON ones keep the bare version
+	etagSuffix string
+	decode     func(r io.Reader, v any) error
+	encode     func(w io.Writer, v any) error
+}
+
+var jsonCodec = codec{
+	mediaTypes: []string{"application/json"},
+	decode: func(r io.Reader, v any) error {
+		return json.NewDecoder(r).Decode(v)
+	},
+	encode: func(w io.Writer, v any) error {
+		return json.NewEncoder(w).Encode(v)
+	},
+}
+
+var xmlCodec = codec{
+	mediaTypes: []string{"application/xml", "text/xml"},
+	etagSuffix: "+xml",
+	decode: func(r io.Reader, v any) error {
+		return xml.NewDecoder(r).Decode(v)
+	},
+	encode: func(w io.Writer, v any) error {
+		return xml.NewEncoder(w).EncodeElement(v, xml.StartElement{Name: xml.Name{Local: xmlElementName(v)}})
+	},
+}
+
+var yamlCodec = codec{
+	mediaTypes: []string{"application/yaml", "application/x-yaml", "text/yaml"},
+	etagSuffix: "+yaml",
+	decode: func(r io.Reader, v any) error {
+		return yaml.NewDecoder(r).Decode(v)
+	},
+	encode: func(w io.Writer, v any) error {
+		return yaml.NewEncoder(w).Encode(v)
+	},
+}
+
+// cborCodec falls back to the json tags, as the DTOs carry no cbor ones
+var cborCodec = codec{
+	mediaTypes: []string{"application/cbor"},
+	etagSuffix: "+cbor",
+	decode: func(r io.Reader, v any) error {
+		return cbor.NewDecoder(r).Decode(v)
+	},
+	encode: func(w io.Writer, v any) error {
+		return cbor.NewEncoder(w).Encode(v)
+	},
+}
+
+var msgpackCodec = codec{
+	mediaTypes: []string{"application/msgpack", "application/vnd.msgpack", "application/x-msgpack"},
+	etagSuffix: "+msgpack",
+	decode: func(r io.Reader, v any) error {
+		decoder := msgpack.NewDecoder(r)
+		decoder.SetCustomStructTag("json")
+		return decoder.Decode(v)
+	},
+	encode: func(w io.Writer, v any) error {
+		encoder := msgpack.NewEncoder(w)
+		encoder.SetCustomStructTag("json")
+		return encoder.Encode(v)
+	},
+}
+
+// xmlElementName names the root element after the DTO, e.g. CustomerPageApiOutput becomes customerPage
+func xmlElementName(v any) string {
+	name := reflect.Indirect(reflect.ValueOf(v)).Type().Name()
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "ApiOutput"), "ApiInput")
+	first, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(first)) + name[size:]
+}
+
+type unsupportedMediaTypeError struct {
+	ContentType string
+	Supported   []string
+}
+
+func (e unsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("Content-Type %q is not supported, use one of %s", e.ContentType, strings.Join(e.Supported, ", "))
+}
+
+type notAcceptableError struct {
+	Accept    string
+	Supported []string
+}
+
+func (e notAcceptableError) Error() string {
+	return fmt.Sprintf("none of %q can be produced, accept one of %s", e.Accept, strings.Join(e.Supported, ", "))
+}
+
+// codecRegistry negotiates representations; the first codec is the default for requests that name no type
+type codecRegistry struct {
+	codecs []codec
+}
+
+func newCodecRegistry(codecs ...codec) codecRegistry {
+	return codecRegistry{codecs: codecs}
+}
+
+var customerCodecs = newCodecRegistry(jsonCodec, xmlCodec, yamlCodec, cborCodec, msgpackCodec)
+
+func (registry codecRegistry) supported() []string {
+	mediaTypes := make([]string, 0, len(registry.codecs))
+	for _, codec := range registry.codecs {
+		mediaTypes = append(mediaTypes, codec.mediaTypes[0])
+	}
+	return mediaTypes
+}
+
+// decoderFor picks the codec of a request body from its Content-Type; parameters such as charset are ignored
+func (registry codecRegistry) decoderFor(contentType string) (codec, error) {
+	if contentType == "" {
+		return registry.codecs[0], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for _, codec := range registry.codecs {
+			for _, candidate := range codec.mediaTypes {
+				if mediaType == candidate {
+					return codec, nil
+				}
+			}
+		}
+	}
+	return codec{}, unsupportedMediaTypeError{ContentType: contentType, Supported: registry.supported()}
+}
+
+// mediaRange is one element of an Accept header
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// specificity ranks exact types over type/* over */*, as the most specific matching range sets the quality
+func (mr mediaRange) specificity() int {
+	switch {
+	case mr.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mr.mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (mr mediaRange) matches(mediaType string) bool {
+	if mr.mediaType == "*/*" || mr.mediaType == mediaType {
+		return true
+	}
+	prefix, wildcard := strings.CutSuffix(mr.mediaType, "*")
+	return wildcard && strings.HasPrefix(mediaType, prefix)
+}
+
+// parseAccept skips malformed ranges rather than failing the request
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, element := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(element))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, found := params["q"]; found {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+	return ranges
+}
+
+// encoderFor picks the codec with the highest quality in Accept, preferring earlier codecs on ties;
+// an absent Accept takes the default
+func (registry codecRegistry) encoderFor(accept string) (codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		return registry.codecs[0], nil
+	}
+	ranges := parseAccept(accept)
+	best, bestQuality := codec{}, 0.0
+	for _, codec := range registry.codecs {
+		if quality := qualityOf(codec, ranges); quality > bestQuality {
+			best, bestQuality = codec, quality
+		}
+	}
+	if bestQuality == 0 {
+		return codec{}, notAcceptableError{Accept: accept, Supported: registry.supported()}
+	}
+	return best, nil
+}
+
+func qualityOf(codec codec, ranges []mediaRange) float64 {
+	quality, specificity := 0.0, -1
+	for _, mediaType := range codec.mediaTypes {
+		for _, mr := range ranges {
+			if mr.matches(mediaType) && mr.specificity() > specificity {
+				quality, specificity = mr.quality, mr.specificity()
+			}
+		}
+	}
+	return quality
+}
+
+// writeRepresentation labels and encodes the body; Vary tells caches the representation depends on Accept
+func writeRepresentation(w http.ResponseWriter, codec codec, status int, v any) {
+	w.Header().Set("Content-Type", codec.mediaTypes[0])
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	codec.encode(w, v)
+}
@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecRegistry_DecoderFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		expected    string
+		expectError bool
+	}{
+		{name: "Absent", contentType: "", expected: "application/json"},
+		{name: "Json", contentType: "application/json", expected: "application/json"},
+		{name: "Charset is ignored", contentType: "application/xml; charset=utf-8", expected: "application/xml"},
+		{name: "Alias", contentType: "text/yaml", expected: "application/yaml"},
+		{name: "Cbor", contentType: "application/cbor", expected: "application/cbor"},
+		{name: "MessagePack alias", contentType: "application/vnd.msgpack", expected: "application/msgpack"},
+		{name: "Unsupported", contentType: "text/csv", expectError: true},
+		{name: "Malformed", contentType: "application/", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			codec, err := customerCodecs.decoderFor(tt.contentType)
+
+			// then
+			if tt.expectError {
+				assert.ErrorAs(t, err, &unsupportedMediaTypeError{})
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, codec.mediaTypes[0])
+		})
+	}
+}
+
+func TestCodecRegistry_EncoderFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		expected    string
+		expectError bool
+	}{
+		{name: "Absent", accept: "", expected: "application/json"},
+		{name: "Anything", accept: "*/*", expected: "application/json"},
+		{name: "Exact", accept: "application/cbor", expected: "application/cbor"},
+		{name: "Quality", accept: "application/json;q=0.5, application/xml", expected: "application/xml"},
+		{name: "Specific range wins", accept: "*/*;q=0.1, application/yaml", expected: "application/yaml"},
+		{name: "Type wildcard", accept: "text/*", expected: "application/xml"},
+		{name: "Excluded by q=0", accept: "application/json;q=0, */*", expected: "application/xml"},
+		{name: "Malformed ranges are skipped", accept: "application/;q=1, application/msgpack", expected: "application/msgpack"},
+		{name: "Unsupported", accept: "text/csv", expectError: true},
+		{name: "Nothing acceptable", accept: "*/*;q=0", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			codec, err := customerCodecs.encoderFor(tt.accept)
+
+			// then
+			if tt.expectError {
+				assert.ErrorAs(t, err, &notAcceptableError{})
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, codec.mediaTypes[0])
+		})
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	nextCursor := "abc"
+	page := CustomerPageApiOutput{
+		Items:      []CustomerApiOutput{{Id: "1", Name: "John Doe", Age: 30}, {Id: "2", Name: "Jane Doe", Age: 31}},
+		NextCursor: &nextCursor,
+	}
+
+	for _, codec := range customerCodecs.codecs {
+		t.Run(codec.mediaTypes[0], func(t *testing.T) {
+			// given
+			var encoded bytes.Buffer
+			require.NoError(t, codec.encode(&encoded, page))
+
+			// when
+			var decoded CustomerPageApiOutput
+			err := codec.decode(&encoded, &decoded)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, page, decoded)
+		})
+	}
+}
+
+func TestXmlCodec_ElementNames(t *testing.T) {
+	// given
+	var encoded bytes.Buffer
+
+	// when
+	err := xmlCodec.encode(&encoded, CustomerPageApiOutput{Items: []CustomerApiOutput{{Id: "1", Name: "John Doe", Age: 30}}})
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, "<customerPage><items><customer><id>1</id><name>John Doe</name><age>30</age></customer></items></customerPage>", encoded.String())
+}
@@ -0,0 +1,396 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contractViolation is a difference between a message and the OpenAPI document; Field locates it, e.g.
+// "path.id" or "body.items[0].name"
+type contractViolation struct {
+	Field   string
+	Keyword string
+	Detail  string
+}
+
+type contractViolationError struct {
+	Violations []contractViolation
+}
+
+func (e contractViolationError) Error() string {
+	details := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		details = append(details, fmt.Sprintf("%s: %s", violation.Field, violation.Detail))
+	}
+	return "does not match the OpenAPI document: " + strings.Join(details, "; ")
+}
+
+// ContractOptions picks what ValidateContract checks
+type ContractOptions struct {
+	// ValidateRequests rejects requests whose path or body do not have the shape the document describes; value
+	// constraints such as maxLength are left to the handlers, which report them in the client's language, and
+	// so is the query, whose names and values the handlers report as validation failures
+	ValidateRequests bool
+	// OnResponseViolation, when set, gets every response that does not match the document, constraints
+	// included; it is meant for tests, as checking buffers responses
+	OnResponseViolation func(r *http.Request, err error)
+}
+
+// ValidateContract checks the traffic of CustomerRouter against its OpenAPI document; requests the document
+// does not describe pass unchecked, to be answered by the router
+func ValidateContract(options ContractOptions) func(http.Handler) http.Handler {
+	contract := newContract(mustCustomerOpenApi())
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			operation, pathParams, found := contract.find(r.Method, r.URL.Path)
+			if !found {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if options.ValidateRequests {
+				if err := contract.checkRequest(r, operation, pathParams); err != nil {
+					writeError(w, r, err)
+					return
+				}
+			}
+			if options.OnResponseViolation == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			if err := contract.checkResponse(recorder, operation); err != nil {
+				options.OnResponseViolation(r, fmt.Errorf("%s %s answered %d: %w", r.Method, r.URL.Path, recorder.status, err))
+			}
+			recorder.writeTo(w)
+		})
+	}
+}
+
+type contract struct {
+	document openApiDocument
+}
+
+func newContract(document openApiDocument) contract {
+	return contract{document: document}
+}
+
+// find matches the path against the path templates of the document
+func (c contract) find(method string, path string) (openApiOperation, map[string]string, bool) {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for template, item := range c.document.Paths {
+		pathParams, matched := matchPath(strings.Split(template, "/"), segments)
+		if !matched {
+			continue
+		}
+		operation, found := item[strings.ToLower(method)]
+		return operation, pathParams, found
+	}
+	return openApiOperation{}, nil, false
+}
+
+func matchPath(template []string, segments []string) (map[string]string, bool) {
+	if len(template) != len(segments) {
+		return nil, false
+	}
+	pathParams := map[string]string{}
+	for i, part := range template {
+		if name, isParam := strings.CutPrefix(part, "{"); isParam {
+			value, err := url.PathUnescape(segments[i])
+			if err != nil || value == "" {
+				return nil, false
+			}
+			pathParams[strings.TrimSuffix(name, "}")] = value
+			continue
+		}
+		if part != segments[i] {
+			return nil, false
+		}
+	}
+	return pathParams, true
+}
+
+func (c contract) checkRequest(r *http.Request, operation openApiOperation, pathParams map[string]string) error {
+	check := schemaCheck{components: c.document.Components.Schemas}
+	var violations []contractViolation
+	for _, param := range operation.Parameters {
+		if param.In == "path" {
+			violations = append(violations, check.parameter("path."+param.Name, param.Schema, pathParams[param.Name])...)
+		}
+	}
+	if operation.RequestBody != nil {
+		bodyViolations, err := c.checkRequestBody(r, operation.RequestBody, check)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, bodyViolations...)
+	}
+	if len(violations) > 0 {
+		return contractViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// checkRequestBody only reads JSON bodies, as the other representations have no schema-neutral decoding;
+// those are checked by the handlers once decoded into the DTOs. The body is restored for the handler
+func (c contract) checkRequestBody(r *http.Request, requestBody *openApiRequestBody, check schemaCheck) ([]contractViolation, error) {
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+	content, found := requestBody.Content[mediaType]
+	if !found || !isJsonMediaType(mediaType) {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, malformedRequestError{Err: err}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	value, err := decodeJson(body)
+	if err != nil {
+		// malformed bodies are the handler's to report
+		return nil, nil
+	}
+	return check.value("body", content.Schema, value), nil
+}
+
+func (c contract) checkResponse(recorder *responseRecorder, operation openApiOperation) error {
+	response, found := operation.Responses[strconv.Itoa(recorder.status)]
+	if !found {
+		return contractViolationError{Violations: []contractViolation{{Field: "status", Keyword: "responses", Detail: "status is not documented"}}}
+	}
+	if len(response.Content) == 0 {
+		if recorder.body.Len() > 0 {
+			return contractViolationError{Violations: []contractViolation{{Field: "body", Keyword: "content", Detail: "no body is documented"}}}
+		}
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(recorder.header.Get("Content-Type"))
+	content, found := response.Content[mediaType]
+	if err != nil || !found {
+		return contractViolationError{Violations: []contractViolation{{Field: "header.Content-Type", Keyword: "content", Detail: fmt.Sprintf("%q is not documented", recorder.header.Get("Content-Type"))}}}
+	}
+	if !isJsonMediaType(mediaType) {
+		return nil
+	}
+	value, err := decodeJson(recorder.body.Bytes())
+	if err != nil {
+		return contractViolationError{Violations: []contractViolation{{Field: "body", Keyword: "content", Detail: err.Error()}}}
+	}
+	check := schemaCheck{components: c.document.Components.Schemas, strict: true}
+	if violations := check.value("body", content.Schema, value); len(violations) > 0 {
+		return contractViolationError{Violations: violations}
+	}
+	return nil
+}
+
+func isJsonMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// decodeJson keeps numbers as json.Number, so integers can be told from other numbers
+func decodeJson(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("more than one JSON value")
+	}
+	return value, nil
+}
+
+// schemaCheck checks decoded JSON against the schemas of the generator; a strict check also applies value
+// constraints and rejects undocumented object members
+type schemaCheck struct {
+	components map[string]*openApiSchema
+	strict     bool
+}
+
+func (check schemaCheck) resolve(schema *openApiSchema) *openApiSchema {
+	for schema.Ref != "" {
+		schema = check.components[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// parameter parses a raw parameter as the scalar its schema describes before checking it
+func (check schemaCheck) parameter(field string, schema *openApiSchema, raw string) []contractViolation {
+	var value any = raw
+	if types := schemaTypes(check.resolve(schema)); slices.Contains(types, "integer") || slices.Contains(types, "number") {
+		value = json.Number(raw)
+	}
+	return check.value(field, schema, value)
+}
+
+func schemaTypes(schema *openApiSchema) []string {
+	switch t := schema.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	default:
+		return nil
+	}
+}
+
+func (check schemaCheck) value(field string, schema *openApiSchema, value any) []contractViolation {
+	schema = check.resolve(schema)
+	actual := jsonTypeOf(value)
+	types := schemaTypes(schema)
+	if len(types) > 0 && !slices.Contains(types, actual) && !(actual == "integer" && slices.Contains(types, "number")) {
+		return []contractViolation{{Field: field, Keyword: "type", Detail: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), actual)}}
+	}
+	var violations []contractViolation
+	switch typed := value.(type) {
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, found := typed[name]; !found {
+				violations = append(violations, contractViolation{Field: field + "." + name, Keyword: "required", Detail: "is required"})
+			}
+		}
+		for _, name := range sortedKeys(typed) {
+			property, documented := schema.Properties[name]
+			switch {
+			case documented:
+				violations = append(violations, check.value(field+"."+name, property, typed[name])...)
+			case check.strict:
+				violations = append(violations, contractViolation{Field: field + "." + name, Keyword: "properties", Detail: "is not documented"})
+			}
+		}
+	case []any:
+		for i, item := range typed {
+			violations = append(violations, check.value(fmt.Sprintf("%s[%d]", field, i), schema.Items, item)...)
+		}
+	}
+	if check.strict {
+		violations = append(violations, check.constraints(field, schema, value)...)
+	}
+	return violations
+}
+
+func jsonTypeOf(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := typed.Int64(); err == nil {
+			return "integer"
+		}
+		if _, err := typed.Float64(); err == nil {
+			return "number"
+		}
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func (check schemaCheck) constraints(field string, schema *openApiSchema, value any) []contractViolation {
+	var violations []contractViolation
+	violate := func(keyword string, detail string, args ...any) {
+		violations = append(violations, contractViolation{Field: field, Keyword: keyword, Detail: fmt.Sprintf(detail, args...)})
+	}
+	if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+		violate("enum", "must be one of %v", schema.Enum)
+	}
+	switch typed := value.(type) {
+	case string:
+		length := len([]rune(typed))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			violate("minLength", "must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			violate("maxLength", "must be at most %d characters", *schema.MaxLength)
+		}
+		if schema.Pattern != "" && !matchesPattern(schema.Pattern, typed) {
+			violate("pattern", "must match %s", schema.Pattern)
+		}
+	case json.Number:
+		number, _ := typed.Float64()
+		if schema.Minimum != nil && number < *schema.Minimum {
+			violate("minimum", "must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			violate("maximum", "must be at most %v", *schema.Maximum)
+		}
+		if schema.ExclusiveMinimum != nil && number <= *schema.ExclusiveMinimum {
+			violate("exclusiveMinimum", "must be greater than %v", *schema.ExclusiveMinimum)
+		}
+		if schema.ExclusiveMaximum != nil && number >= *schema.ExclusiveMaximum {
+			violate("exclusiveMaximum", "must be less than %v", *schema.ExclusiveMaximum)
+		}
+	case []any:
+		if schema.MinItems != nil && len(typed) < *schema.MinItems {
+			violate("minItems", "must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(typed) > *schema.MaxItems {
+			violate("maxItems", "must have at most %d items", *schema.MaxItems)
+		}
+	}
+	return violations
+}
+
+// responseRecorder buffers a response until it has been checked
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (recorder *responseRecorder) Header() http.Header {
+	return recorder.header
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status, recorder.wroteHeader = status, true
+	}
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.wroteHeader = true
+	return recorder.body.Write(data)
+}
+
+func (recorder *responseRecorder) writeTo(w http.ResponseWriter) {
+	for name, values := range recorder.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(recorder.status)
+	w.Write(recorder.body.Bytes())
+}
+
+// patterns caches the compiled schema patterns, which come from Go regular expressions
+var patterns sync.Map
+
+func matchesPattern(pattern string, value string) bool {
+	compiled, found := patterns.Load(pattern)
+	if !found {
+		compiled, _ = patterns.LoadOrStore(pattern, regexp.MustCompile(pattern))
+	}
+	return compiled.(*regexp.Regexp).MatchString(value)
+}
@@ -0,0 +1,196 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaCheck(t *testing.T) {
+	document := mustCustomerOpenApi()
+	ref := func(name string) *openApiSchema {
+		return &openApiSchema{Ref: "#/components/schemas/" + name}
+	}
+
+	tests := []struct {
+		name     string
+		schema   *openApiSchema
+		value    string
+		strict   bool
+		expected []contractViolation
+	}{
+		{
+			name:   "Valid",
+			schema: ref("CustomerPageApiOutput"),
+			value:  `{"items": [{"id": "1", "name": "John Doe", "age": 30}], "next_cursor": null}`,
+			strict: true,
+		},
+		{
+			name:     "Wrong type",
+			schema:   ref("CreateCustomerApiInput"),
+			value:    `{"name": "John Doe", "age": "thirty"}`,
+			expected: []contractViolation{{Field: "body.age", Keyword: "type", Detail: "expected integer, got string"}},
+		},
+		{
+			name:     "Not an integer",
+			schema:   ref("CreateCustomerApiInput"),
+			value:    `{"name": "John Doe", "age": 30.5}`,
+			expected: []contractViolation{{Field: "body.age", Keyword: "type", Detail: "expected integer, got number"}},
+		},
+		{
+			name:     "Missing required",
+			schema:   ref("CreateCustomerApiInput"),
+			value:    `{"name": "John Doe"}`,
+			expected: []contractViolation{{Field: "body.age", Keyword: "required", Detail: "is required"}},
+		},
+		{
+			name:     "Item path",
+			schema:   ref("CustomerPageApiOutput"),
+			value:    `{"items": [{"id": "1", "name": "John Doe", "age": 30}, {"id": 2, "name": "Jane Doe", "age": 31}], "next_cursor": "abc"}`,
+			expected: []contractViolation{{Field: "body.items[1].id", Keyword: "type", Detail: "expected string, got integer"}},
+		},
+		{
+			name:   "Lenient checks skip constraints and undocumented members",
+			schema: ref("CreateCustomerApiInput"),
+			value:  `{"name": "J0hn", "age": 201, "email": "john@example.com"}`,
+		},
+		{
+			name:   "Strict checks apply them",
+			schema: ref("CreateCustomerApiInput"),
+			value:  `{"name": "J0hn", "age": 201, "email": "john@example.com"}`,
+			strict: true,
+			expected: []contractViolation{
+				{Field: "body.email", Keyword: "properties", Detail: "is not documented"},
+				{Field: "body.name", Keyword: "pattern", Detail: "must match " + document.Components.Schemas["CreateCustomerApiInput"].Properties["name"].Pattern},
+				{Field: "body.age", Keyword: "maximum", Detail: "must be at most 200"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			value, err := decodeJson([]byte(tt.value))
+			require.NoError(t, err)
+			check := schemaCheck{components: document.Components.Schemas, strict: tt.strict}
+
+			// when
+			violations := check.value("body", tt.schema, value)
+
+			// then
+			assert.ElementsMatch(t, tt.expected, violations)
+		})
+	}
+}
+
+func TestValidateContract_Requests(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		body           string
+		expectedFields []string
+	}{
+		{name: "Valid list", method: "GET", path: "/customers?name_prefix=Jo&limit=10"},
+		{name: "Constraints are left to the handler", method: "GET", path: "/customers?limit=1000"},
+		{name: "Parameter type is left to the handler", method: "GET", path: "/customers?limit=ten"},
+		{name: "Unknown parameter is left to the handler", method: "GET", path: "/customers?email=john@example.com"},
+		{name: "Valid body", method: "POST", path: "/customers", body: `{"name": "John Doe", "age": 30}`},
+		{name: "Body type", method: "POST", path: "/customers", body: `{"name": ["John"], "age": 30}`, expectedFields: []string{"body.name"}},
+		{name: "Malformed body is left to the handler", method: "POST", path: "/customers", body: `{"name"`},
+		{name: "Other representations are left to the handler", method: "POST", path: "/customers", contentType: "application/xml", body: `<customer/>`},
+		{name: "Merge patch", method: "PATCH", path: "/customers/1", contentType: "application/merge-patch+json", body: `{"age": "31"}`, expectedFields: []string{"body.age"}},
+		{name: "Undescribed path", method: "GET", path: "/api-keys?anything=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			var received string
+			handler := ValidateContract(ContractOptions{ValidateRequests: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			// when
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			// then
+			if len(tt.expectedFields) == 0 {
+				assert.Equal(t, http.StatusNoContent, rr.Code)
+				assert.Equal(t, tt.body, received, "The handler should get the body unchanged")
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var problem Problem
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&problem))
+			assert.Equal(t, problemTypeContractViolation, problem.Type)
+			fields := make([]string, 0, len(problem.Errors))
+			for _, fieldErr := range problem.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+			assert.Equal(t, tt.expectedFields, fields)
+		})
+	}
+}
+
+func TestValidateContract_Responses(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		contentType   string
+		body          string
+		expectedError string
+	}{
+		{name: "Documented", status: http.StatusOK, contentType: "application/json", body: `{"id": "1", "name": "John Doe", "age": 30}`},
+		{name: "Other representations", status: http.StatusOK, contentType: "application/cbor", body: "\xa0"},
+		{name: "Not modified", status: http.StatusNotModified},
+		{name: "Undocumented status", status: http.StatusTeapot, expectedError: "status: status is not documented"},
+		{name: "Undocumented media type", status: http.StatusOK, contentType: "text/plain", body: "John Doe", expectedError: `header.Content-Type: "text/plain" is not documented`},
+		{name: "Undocumented member", status: http.StatusOK, contentType: "application/json", body: `{"id": "1", "name": "John Doe", "age": 30, "email": "john@example.com"}`, expectedError: "body.email: is not documented"},
+		{name: "Problem", status: http.StatusNotFound, contentType: problemContentType, body: `{"type": "/problems/customer-not-found", "title": "Customer not found", "status": 404}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			var reported error
+			handler := ValidateContract(ContractOptions{
+				OnResponseViolation: func(r *http.Request, err error) { reported = err },
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			req, _ := http.NewRequest("GET", "/customers/1", nil)
+
+			// when
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			// then
+			assert.Equal(t, tt.status, rr.Code, "The response should be passed on")
+			assert.Equal(t, tt.body, rr.Body.String())
+			if tt.expectedError == "" {
+				assert.NoError(t, reported)
+				return
+			}
+			assert.ErrorContains(t, reported, tt.expectedError)
+		})
+	}
+}
@@ -2,28 +2,46 @@ package gateway
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"go-chi-gorilla-wire-workshop/app/domain"
 	"go-chi-gorilla-wire-workshop/app/validation"
+	"io"
+	"mime"
 	"net/http"
+	"slices"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type CreateCustomerApiInput struct {
-	Name string `json:"name" validate:"min=1,max=30"`
-	Age  int    `json:"age" validate:"min=1,max=200"`
+	Name string `json:"name" xml:"name" yaml:"name" validate:"customername"`
+	Age  int    `json:"age" xml:"age" yaml:"age" validate:"customerage"`
+}
+
+type UpdateCustomerApiInput struct {
+	Name string `json:"name" xml:"name" yaml:"name" validate:"customername"`
+	Age  int    `json:"age" xml:"age" yaml:"age" validate:"customerage"`
+}
+
+// PatchCustomerApiInput is a JSON Merge Patch (RFC 7386) document; absent members are left unchanged
+type PatchCustomerApiInput struct {
+	Name *string `json:"name" validate:"omitnil,customername"`
+	Age  *int    `json:"age" validate:"omitnil,customerage"`
 }
 
 type CustomerApiOutput struct {
-	Id   string `json:"id"`
-	Name string `json:"name"`
-	Age  int    `json:"age"`
+	Id   string `json:"id" xml:"id" yaml:"id"`
+	Name string `json:"name" xml:"name" yaml:"name"`
+	Age  int    `json:"age" xml:"age" yaml:"age"`
+}
+
+type CustomerPageApiOutput struct {
+	Items      []CustomerApiOutput `json:"items" xml:"items>customer" yaml:"items"`
+	NextCursor *string             `json:"next_cursor" xml:"next_cursor,omitempty" yaml:"next_cursor"`
 }
 
 type CustomerIdApiOutput struct {
-	Id string `json:"id"`
+	Id string `json:"id" xml:"id" yaml:"id"`
 }
 
 func newCustomerIdApiOutput(customerId domain.CustomerId) CustomerIdApiOutput {
@@ -40,6 +58,19 @@ func newCustomerApiOutput(customer domain.Customer) CustomerApiOutput {
 	}
 }
 
+func newCustomerPageApiOutput(page domain.CustomerPage) CustomerPageApiOutput {
+	items := make([]CustomerApiOutput, 0, len(page.Items))
+	for _, customer := range page.Items {
+		items = append(items, newCustomerApiOutput(customer))
+	}
+	apiOutput := CustomerPageApiOutput{Items: items}
+	if page.NextCursor != nil {
+		nextCursor := page.NextCursor.Encode()
+		apiOutput.NextCursor = &nextCursor
+	}
+	return apiOutput
+}
+
 func (apiInput CreateCustomerApiInput) toCommand() (domain.CreateCustomerCommand, error) {
 	if err := validation.Validate(apiInput); err != nil {
 		return domain.CreateCustomerCommand{}, err
@@ -50,55 +81,329 @@ func (apiInput CreateCustomerApiInput) toCommand() (domain.CreateCustomerCommand
 	}, nil
 }
 
-func CustomerRouter(service domain.CustomerService, r *chi.Mux) {
+func (apiInput UpdateCustomerApiInput) toCommand() (domain.UpdateCustomerCommand, error) {
+	if err := validation.Validate(apiInput); err != nil {
+		return domain.UpdateCustomerCommand{}, err
+	}
+	return domain.UpdateCustomerCommand{
+		Name: apiInput.Name,
+		Age:  apiInput.Age,
+	}, nil
+}
+
+func (apiInput PatchCustomerApiInput) toCommand() (domain.PatchCustomerCommand, error) {
+	if err := validation.Validate(apiInput); err != nil {
+		return domain.PatchCustomerCommand{}, err
+	}
+	return domain.PatchCustomerCommand{
+		Name: apiInput.Name,
+		Age:  apiInput.Age,
+	}, nil
+}
+
+var mergePatchMediaTypes = []string{"application/merge-patch+json", "application/json"}
+
+// requireMergePatch accepts an absent Content-Type, as clients sent none before it was checked
+func requireMergePatch(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !slices.Contains(mergePatchMediaTypes, mediaType) {
+		return unsupportedMediaTypeError{ContentType: contentType, Supported: mergePatchMediaTypes}
+	}
+	return nil
+}
+
+// decodeMergePatch rejects null members, as in merge patch they mean removal and every customer field is required
+func decodeMergePatch(body io.Reader) (PatchCustomerApiInput, error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return PatchCustomerApiInput{}, malformedRequestError{Err: err}
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return PatchCustomerApiInput{}, malformedRequestError{Err: err}
+	}
+	for name, value := range members {
+		if string(value) == "null" {
+			return PatchCustomerApiInput{}, validation.InvalidInput{Err: fmt.Errorf("field '%s' cannot be removed", name)}
+		}
+	}
+	var apiInput PatchCustomerApiInput
+	if err := json.Unmarshal(raw, &apiInput); err != nil {
+		return PatchCustomerApiInput{}, malformedRequestError{Err: err}
+	}
+	return apiInput, nil
+}
+
+const (
+	ScopeCustomersRead   = "customers:read"
+	ScopeCustomersWrite  = "customers:write"
+	ScopeCustomersDelete = "customers:delete"
+)
+
+// customerRouteScopes is the authorization policy of CustomerRouter, keyed by method and pattern under the base url
+var customerRouteScopes = map[string]string{
+	"POST /":       ScopeCustomersWrite,
+	"GET /":        ScopeCustomersRead,
+	"GET /{id}":    ScopeCustomersRead,
+	"PUT /{id}":    ScopeCustomersWrite,
+	"PATCH /{id}":  ScopeCustomersWrite,
+	"DELETE /{id}": ScopeCustomersDelete,
+}
+
+// authorizedRoutes registers routes behind the scope the policy requires; a route missing from the policy
+// is a programming error, so it fails at startup rather than being left open
+type authorizedRoutes struct {
+	router chi.Router
+	scopes map[string]string
+}
+
+func (routes authorizedRoutes) handle(method string, pattern string, handler http.HandlerFunc) {
+	scope, found := routes.scopes[method+" "+pattern]
+	if !found {
+		panic(fmt.Sprintf("no scope declared for %s %s", method, pattern))
+	}
+	routes.router.With(requireScope(scope)).Method(method, pattern, handler)
+}
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// createCustomer goes through the idempotency keys when the request carries one; a replay answers as the
+// original create did, so the status, Location and body all match
+func createCustomer(service domain.CustomerService, tenant domain.TenantId, header http.Header, command domain.CreateCustomerCommand) (domain.CustomerId, bool, error) {
+	if _, found := header[idempotencyKeyHeader]; !found {
+		customerId, err := service.CreateCustomer(tenant, command)
+		return customerId, false, err
+	}
+	return service.CreateCustomerIdempotently(tenant, header.Get(idempotencyKeyHeader), command)
+}
+
+func CustomerRouter(service domain.CustomerService, r chi.Router) {
 	baseUrl := "/customers"
 	r.Route(baseUrl, func(r chi.Router) {
-		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		routes := authorizedRoutes{router: r, scopes: customerRouteScopes}
+		routes.handle(http.MethodPost, "/", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			decoder, err := customerCodecs.decoderFor(r.Header.Get("Content-Type"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			encoder, err := customerCodecs.encoderFor(r.Header.Get("Accept"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
 			var apiInput CreateCustomerApiInput
-			if err := json.NewDecoder(r.Body).Decode(&apiInput); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			if err := decoder.decode(r.Body, &apiInput); err != nil {
+				writeError(w, r, malformedRequestError{Err: err})
 				return
 			}
 			command, err := apiInput.toCommand()
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				writeError(w, r, err)
 				return
 			}
-			customerId, err := service.CreateCustomer(command)
+			customerId, replayed, err := createCustomer(service, tenant, r.Header, command)
 			if err != nil {
-				message, status := customerErrorToHttp(err)
-				http.Error(w, message, status)
+				writeError(w, r, err)
+				return
 			}
 			location := fmt.Sprintf("%s/%s", baseUrl, customerId)
 			w.Header().Set("Location", location)
-			w.WriteHeader(http.StatusCreated)
+			if replayed {
+				w.Header().Set(idempotentReplayedHeader, "true")
+			}
 			apiOutput := newCustomerIdApiOutput(customerId)
-			json.NewEncoder(w).Encode(apiOutput)
+			writeRepresentation(w, encoder, http.StatusCreated, apiOutput)
 		})
 
-		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
-			id := chi.URLParam(r, "id")
-			customer, found := service.GetCustomer(domain.CustomerId{Raw: id})
+		routes.handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			encoder, err := customerCodecs.encoderFor(r.Header.Get("Accept"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			query, err := newCustomerQuery(r.URL.Query())
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			pageRequest, err := newCustomerPageRequest(r.URL.Query())
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			page, err := service.ListCustomers(tenant, query, pageRequest)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			apiOutput := newCustomerPageApiOutput(page)
+			writeRepresentation(w, encoder, http.StatusOK, apiOutput)
+		})
+
+		routes.handle(http.MethodGet, "/{id}", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			customerId, err := domain.ParseCustomerId(chi.URLParam(r, "id"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			encoder, err := customerCodecs.encoderFor(r.Header.Get("Accept"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			customer, found, err := service.GetCustomer(tenant, customerId)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
 			if !found {
-				http.Error(w, "customer not found", http.StatusNotFound)
+				writeError(w, r, domain.CustomerNotFoundError{Id: customerId})
+				return
+			}
+			setValidators(w, customer, encoder)
+			if notModified(r, customer, encoder) {
+				w.Header().Add("Vary", "Accept")
+				w.WriteHeader(http.StatusNotModified)
 				return
 			}
 			apiOutput := newCustomerApiOutput(customer)
-			json.NewEncoder(w).Encode(apiOutput)
+			writeRepresentation(w, encoder, http.StatusOK, apiOutput)
 		})
-	})
-}
 
-func customerErrorToHttp(err error) (message string, httpCode int) {
-	var customerExistsErr *domain.CustomerAlreadyExistsError
-	var invalidInputErr *validation.InvalidInput
+		routes.handle(http.MethodPut, "/{id}", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			customerId, err := domain.ParseCustomerId(chi.URLParam(r, "id"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			version, err := expectedVersion(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			decoder, err := customerCodecs.decoderFor(r.Header.Get("Content-Type"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			encoder, err := customerCodecs.encoderFor(r.Header.Get("Accept"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			var apiInput UpdateCustomerApiInput
+			if err := decoder.decode(r.Body, &apiInput); err != nil {
+				writeError(w, r, malformedRequestError{Err: err})
+				return
+			}
+			command, err := apiInput.toCommand()
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			customer, err := service.UpdateCustomer(tenant, customerId, version, command)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			setValidators(w, customer, encoder)
+			apiOutput := newCustomerApiOutput(customer)
+			writeRepresentation(w, encoder, http.StatusOK, apiOutput)
+		})
 
-	switch {
-	case errors.As(err, &customerExistsErr):
-		return customerExistsErr.Error(), http.StatusBadRequest
-	case errors.As(err, &invalidInputErr):
-		return invalidInputErr.Error(), http.StatusUnprocessableEntity
-	default:
-		return err.Error(), http.StatusInternalServerError
-	}
+		routes.handle(http.MethodPatch, "/{id}", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			customerId, err := domain.ParseCustomerId(chi.URLParam(r, "id"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			version, err := expectedVersion(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if err := requireMergePatch(r.Header.Get("Content-Type")); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			encoder, err := customerCodecs.encoderFor(r.Header.Get("Accept"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			apiInput, err := decodeMergePatch(r.Body)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			command, err := apiInput.toCommand()
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			customer, err := service.PatchCustomer(tenant, customerId, version, command)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			setValidators(w, customer, encoder)
+			apiOutput := newCustomerApiOutput(customer)
+			writeRepresentation(w, encoder, http.StatusOK, apiOutput)
+		})
+
+		routes.handle(http.MethodDelete, "/{id}", func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolveTenant(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			customerId, err := domain.ParseCustomerId(chi.URLParam(r, "id"))
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			version, err := expectedVersion(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if err := service.DeleteCustomer(tenant, customerId, version); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
 }
@@ -0,0 +1,489 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+const graphqlPath = "/graphql"
+
+// maxGraphqlBatch bounds the requests of one POST, so a single call cannot run an unbounded number of
+// mutations or listings
+const maxGraphqlBatch = 10
+
+// maxGraphqlRootFields bounds the root fields of one POST across its batch, as aliases let a single request
+// repeat customers or createCustomer any number of times
+const maxGraphqlRootFields = 10
+
+// customerGraphqlScopes is the authorization policy of the root fields, matching customerRouteScopes
+var customerGraphqlScopes = map[string]string{
+	"Query.customer":          ScopeCustomersRead,
+	"Query.customers":         ScopeCustomersRead,
+	"Mutation.createCustomer": ScopeCustomersWrite,
+}
+
+// GraphqlRequest is a GraphQL over HTTP request; a POST may carry a JSON array of them to run as a batch
+type GraphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type graphqlCallerKey struct{}
+
+// graphqlCaller carries what resolvers need from the HTTP request: the requested tenant and the
+// language of error messages
+type graphqlCaller struct {
+	tenant string
+	trans  ut.Translator
+}
+
+// graphqlProblemError reports a failed root field with the problem the HTTP API would answer; field errors
+// carry the path of the invalid argument, e.g. ["input", "name"]
+type graphqlProblemError struct {
+	Problem Problem
+	// Argument is the argument the field errors are paths within; empty when they are arguments themselves
+	Argument string
+}
+
+func (e graphqlProblemError) Error() string {
+	if e.Problem.Detail != "" {
+		return e.Problem.Detail
+	}
+	return e.Problem.Title
+}
+
+func (e graphqlProblemError) Extensions() map[string]any {
+	extensions := map[string]any{
+		"code":   problemCode(e.Problem.Type),
+		"type":   e.Problem.Type,
+		"status": e.Problem.Status,
+	}
+	if len(e.Problem.Errors) > 0 {
+		fields := make([]map[string]any, 0, len(e.Problem.Errors))
+		for _, fieldErr := range e.Problem.Errors {
+			path := strings.Split(fieldErr.Field, ".")
+			if e.Argument != "" {
+				path = append([]string{e.Argument}, path...)
+			}
+			field := map[string]any{"path": path, "rule": fieldErr.Rule, "message": fieldErr.Detail}
+			if fieldErr.Param != "" {
+				field["param"] = fieldErr.Param
+			}
+			fields = append(fields, field)
+		}
+		extensions["fields"] = fields
+	}
+	return extensions
+}
+
+// customerField resolves a field of the Customer type from domain.Customer
+func customerField(value func(customer domain.Customer) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return value(p.Source.(domain.Customer)), nil
+	}
+}
+
+func timeOrNil(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+var customerGraphqlType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Customer",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.ID),
+			Resolve: customerField(func(customer domain.Customer) any { return customer.Id.Raw }),
+		},
+		"name": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: customerField(func(customer domain.Customer) any { return customer.Name }),
+		},
+		"age": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Int),
+			Resolve: customerField(func(customer domain.Customer) any { return customer.Age }),
+		},
+		"version": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Int),
+			Resolve: customerField(func(customer domain.Customer) any { return customer.Version }),
+		},
+		"createdAt": &graphql.Field{
+			Type:        graphql.DateTime,
+			Description: "null for customers stored before the times were tracked",
+			Resolve:     customerField(func(customer domain.Customer) any { return timeOrNil(customer.CreatedAt) }),
+		},
+		"updatedAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: customerField(func(customer domain.Customer) any { return timeOrNil(customer.UpdatedAt) }),
+		},
+	},
+})
+
+var customerPageGraphqlType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CustomerPage",
+	Fields: graphql.Fields{
+		"items": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(customerGraphqlType))),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(domain.CustomerPage).Items, nil
+			},
+		},
+		"nextCursor": &graphql.Field{
+			Type:        graphql.String,
+			Description: "null on the last page",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				if cursor := p.Source.(domain.CustomerPage).NextCursor; cursor != nil {
+					return cursor.Encode(), nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var createCustomerGraphqlInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateCustomerInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"age":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var createCustomerGraphqlPayload = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CreateCustomerPayload",
+	Fields: graphql.Fields{
+		"customer": &graphql.Field{Type: graphql.NewNonNull(customerGraphqlType)},
+		"replayed": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "set when the idempotency key was used before and no customer was created",
+		},
+	},
+})
+
+// customerGraphqlResolver resolves the root fields through the domain service, as CustomerRouter does
+type customerGraphqlResolver struct {
+	service domain.CustomerService
+}
+
+// authorize checks the scope of the root field and resolves the tenant of the request
+func (resolver customerGraphqlResolver) authorize(p graphql.ResolveParams) (domain.TenantId, error) {
+	caller, _ := p.Context.Value(graphqlCallerKey{}).(graphqlCaller)
+	scope := customerGraphqlScopes[p.Info.ParentType.Name()+"."+p.Info.FieldName]
+	return authorizeTenant(p.Context, scope, caller.tenant)
+}
+
+func (resolver customerGraphqlResolver) customer(p graphql.ResolveParams) (any, error) {
+	tenant, err := resolver.authorize(p)
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "")
+	}
+	customerId, err := domain.ParseCustomerId(p.Args["id"].(string))
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "")
+	}
+	customer, found, err := resolver.service.GetCustomer(tenant, customerId)
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "")
+	}
+	if !found {
+		return nil, nil
+	}
+	return customer, nil
+}
+
+func (resolver customerGraphqlResolver) customers(p graphql.ResolveParams) (any, error) {
+	tenant, err := resolver.authorize(p)
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "")
+	}
+	query := domain.CustomerQuery{
+		Filter: domain.CustomerFilter{
+			Name:       stringArg(p.Args, "name"),
+			NamePrefix: stringArg(p.Args, "namePrefix"),
+			Age:        intArg(p.Args, "age"),
+			AgeGt:      intArg(p.Args, "ageGt"),
+			AgeGte:     intArg(p.Args, "ageGte"),
+			AgeLt:      intArg(p.Args, "ageLt"),
+			AgeLte:     intArg(p.Args, "ageLte"),
+		},
+	}
+	if sort := stringArg(p.Args, "sort"); sort != nil {
+		query.Sort, err = parseCustomerSort(*sort)
+		if err != nil {
+			return nil, graphqlError(p.Context, validation.InvalidInput{Err: err}, "")
+		}
+	}
+	pageRequest := domain.CustomerPageRequest{Limit: p.Args["limit"].(int)}
+	if cursor := stringArg(p.Args, "cursor"); cursor != nil {
+		pageRequest.Cursor = *cursor
+	}
+	page, err := resolver.service.ListCustomers(tenant, query, pageRequest)
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "")
+	}
+	return page, nil
+}
+
+func (resolver customerGraphqlResolver) createCustomer(p graphql.ResolveParams) (any, error) {
+	tenant, err := resolver.authorize(p)
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "")
+	}
+	input := p.Args["input"].(map[string]any)
+	// the domain validates the command, so its field errors are reported within the input argument
+	command := domain.CreateCustomerCommand{Name: input["name"].(string), Age: input["age"].(int)}
+	var customerId domain.CustomerId
+	var replayed bool
+	if key := stringArg(p.Args, "idempotencyKey"); key != nil {
+		customerId, replayed, err = resolver.service.CreateCustomerIdempotently(tenant, *key, command)
+	} else {
+		customerId, err = resolver.service.CreateCustomer(tenant, command)
+	}
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "input")
+	}
+	customer, found, err := resolver.service.GetCustomer(tenant, customerId)
+	if err != nil {
+		return nil, graphqlError(p.Context, err, "")
+	}
+	if !found {
+		return nil, graphqlError(p.Context, domain.CustomerNotFoundError{Id: customerId}, "")
+	}
+	return map[string]any{"customer": customer, "replayed": replayed}, nil
+}
+
+func stringArg(args map[string]any, name string) *string {
+	if value, ok := args[name].(string); ok {
+		return &value
+	}
+	return nil
+}
+
+func intArg(args map[string]any, name string) *int {
+	if value, ok := args[name].(int); ok {
+		return &value
+	}
+	return nil
+}
+
+// graphqlError turns a failure into the problem the HTTP API would answer, in the language of the request
+func graphqlError(ctx context.Context, err error, argument string) error {
+	trans := validation.DefaultTranslator()
+	if caller, ok := ctx.Value(graphqlCallerKey{}).(graphqlCaller); ok {
+		trans = caller.trans
+	}
+	return graphqlProblemError{Problem: customerErrorToHttp(err, trans), Argument: argument}
+}
+
+func newCustomerGraphqlSchema(service domain.CustomerService) (graphql.Schema, error) {
+	resolver := customerGraphqlResolver{service: service}
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"customer": &graphql.Field{
+				Type:        customerGraphqlType,
+				Description: "null when the customer does not exist",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolver.customer,
+			},
+			"customers": &graphql.Field{
+				Type:        graphql.NewNonNull(customerPageGraphqlType),
+				Description: "customers matching every given filter, as GET /customers lists them",
+				Args: graphql.FieldConfigArgument{
+					"name":       &graphql.ArgumentConfig{Type: graphql.String},
+					"namePrefix": &graphql.ArgumentConfig{Type: graphql.String},
+					"age":        &graphql.ArgumentConfig{Type: graphql.Int},
+					"ageGt":      &graphql.ArgumentConfig{Type: graphql.Int},
+					"ageGte":     &graphql.ArgumentConfig{Type: graphql.Int},
+					"ageLt":      &graphql.ArgumentConfig{Type: graphql.Int},
+					"ageLte":     &graphql.ArgumentConfig{Type: graphql.Int},
+					"sort": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "comma separated list of id, name and age, each optionally prefixed with '-' for descending order",
+					},
+					"cursor": &graphql.ArgumentConfig{Type: graphql.String},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageLimit},
+				},
+				Resolve: resolver.customers,
+			},
+		},
+	})
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createCustomer": &graphql.Field{
+				Type: graphql.NewNonNull(createCustomerGraphqlPayload),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createCustomerGraphqlInput)},
+					"idempotencyKey": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "makes retries return the customer created first, as the Idempotency-Key header does",
+					},
+				},
+				Resolve: resolver.createCustomer,
+			},
+		},
+	})
+	for _, root := range []*graphql.Object{query, mutation} {
+		for name := range root.Fields() {
+			if _, found := customerGraphqlScopes[root.Name()+"."+name]; !found {
+				return graphql.Schema{}, fmt.Errorf("no scope declared for %s.%s", root.Name(), name)
+			}
+		}
+	}
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// GraphqlRouter serves the customer API as GraphQL over POST /graphql; it is meant to sit behind Authenticate,
+// with every root field checking its own scope
+func GraphqlRouter(service domain.CustomerService, r chi.Router) {
+	schema, err := newCustomerGraphqlSchema(service)
+	if err != nil {
+		panic(err)
+	}
+	r.Post(graphqlPath, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, malformedRequestError{Err: err})
+			return
+		}
+		requests, batch, err := decodeGraphqlRequests(body)
+		if err != nil {
+			writeError(w, r, malformedRequestError{Err: err})
+			return
+		}
+		trans := validation.TranslatorFor(r.Header.Get("Accept-Language"))
+		ctx := context.WithValue(r.Context(), graphqlCallerKey{}, graphqlCaller{tenant: r.Header.Get(tenantHeader), trans: trans})
+		results := make([]*graphql.Result, 0, len(requests))
+		for _, request := range requests {
+			results = append(results, graphql.Do(graphql.Params{
+				Schema:         schema,
+				RequestString:  request.Query,
+				OperationName:  request.OperationName,
+				VariableValues: request.Variables,
+				Context:        ctx,
+			}))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Language", trans.Locale())
+		if batch {
+			json.NewEncoder(w).Encode(results)
+			return
+		}
+		json.NewEncoder(w).Encode(results[0])
+	})
+}
+
+// decodeGraphqlRequests reads a single request or a batch of them
+func decodeGraphqlRequests(body []byte) ([]GraphqlRequest, bool, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		var requests []GraphqlRequest
+		if err := json.Unmarshal(body, &requests); err != nil {
+			return nil, true, err
+		}
+		if len(requests) == 0 {
+			return nil, true, errors.New("batch is empty")
+		}
+		if len(requests) > maxGraphqlBatch {
+			return nil, true, fmt.Errorf("batch holds %d requests, at most %d are allowed", len(requests), maxGraphqlBatch)
+		}
+		if err := checkGraphqlRootFields(requests); err != nil {
+			return nil, true, err
+		}
+		return requests, true, nil
+	}
+	var request GraphqlRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, false, err
+	}
+	requests := []GraphqlRequest{request}
+	if err := checkGraphqlRootFields(requests); err != nil {
+		return nil, false, err
+	}
+	return requests, false, nil
+}
+
+// checkGraphqlRootFields rejects requests resolving more than maxGraphqlRootFields root fields in total
+func checkGraphqlRootFields(requests []GraphqlRequest) error {
+	total := 0
+	for _, request := range requests {
+		total += graphqlRootFields(request)
+	}
+	if total > maxGraphqlRootFields {
+		return fmt.Errorf("request selects %d root fields, at most %d are allowed", total, maxGraphqlRootFields)
+	}
+	return nil
+}
+
+// graphqlRootFields counts the root fields the request resolves, by response key as fields selected twice are
+// resolved once, with aliases and fragments included; queries that do not parse count as none, as graphql.Do
+// reports them
+func graphqlRootFields(request GraphqlRequest) int {
+	document, err := parser.Parse(parser.ParseParams{Source: request.Query})
+	if err != nil {
+		return 0
+	}
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	count := 0
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || request.OperationName != "" && (operation.Name == nil || operation.Name.Value != request.OperationName) {
+			continue
+		}
+		keys := map[string]bool{}
+		collectGraphqlResponseKeys(operation.SelectionSet, fragments, map[string]bool{}, keys)
+		count += len(keys)
+	}
+	return count
+}
+
+// collectGraphqlResponseKeys adds the response keys of the selections to keys, spreading every fragment once
+func collectGraphqlResponseKeys(selections *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, spread map[string]bool, keys map[string]bool) {
+	if selections == nil {
+		return
+	}
+	for _, selection := range selections.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			key := selection.Name.Value
+			if selection.Alias != nil {
+				key = selection.Alias.Value
+			}
+			keys[key] = true
+		case *ast.InlineFragment:
+			collectGraphqlResponseKeys(selection.SelectionSet, fragments, spread, keys)
+		case *ast.FragmentSpread:
+			fragment, found := fragments[selection.Name.Value]
+			if !found || spread[selection.Name.Value] {
+				continue
+			}
+			spread[selection.Name.Value] = true
+			collectGraphqlResponseKeys(fragment.SelectionSet, fragments, spread, keys)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphqlProblemError_Extensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      graphqlProblemError
+		expected map[string]any
+	}{
+		{
+			name: "Without field errors",
+			err:  graphqlProblemError{Problem: Problem{Type: problemTypeCustomerNotFound, Title: "Customer not found", Status: 404}},
+			expected: map[string]any{
+				"code":   "CUSTOMER_NOT_FOUND",
+				"type":   problemTypeCustomerNotFound,
+				"status": 404,
+			},
+		},
+		{
+			name: "Field errors within an argument",
+			err: graphqlProblemError{
+				Problem: Problem{Type: problemTypeValidationFailed, Status: 422, Errors: []FieldErrorOutput{
+					{Field: "address.city", Rule: "required", Detail: "city is a required field"},
+					{Field: "age", Rule: "max", Param: "200", Detail: "age must be 200 or less"},
+				}},
+				Argument: "input",
+			},
+			expected: map[string]any{
+				"code":   "VALIDATION_FAILED",
+				"type":   problemTypeValidationFailed,
+				"status": 422,
+				"fields": []map[string]any{
+					{"path": []string{"input", "address", "city"}, "rule": "required", "message": "city is a required field"},
+					{"path": []string{"input", "age"}, "rule": "max", "param": "200", "message": "age must be 200 or less"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			extensions := tt.err.Extensions()
+
+			// then
+			assert.Equal(t, tt.expected, extensions)
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway/auth"
+	"go-chi-gorilla-wire-workshop/app/gateway/customerpb"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const tenantMetadataKey = "x-tenant-id"
+
+// customerGrpcScopes is the authorization policy of the gRPC CustomerService, matching customerRouteScopes
+var customerGrpcScopes = map[string]string{
+	customerpb.CustomerService_CreateCustomer_FullMethodName: ScopeCustomersWrite,
+	customerpb.CustomerService_GetCustomer_FullMethodName:    ScopeCustomersRead,
+	customerpb.CustomerService_ListCustomers_FullMethodName:  ScopeCustomersRead,
+	customerpb.CustomerService_UpdateCustomer_FullMethodName: ScopeCustomersWrite,
+	customerpb.CustomerService_PatchCustomer_FullMethodName:  ScopeCustomersWrite,
+	customerpb.CustomerService_DeleteCustomer_FullMethodName: ScopeCustomersDelete,
+}
+
+// grpcCodes translates the statuses of customerErrorToHttp, so both APIs fail alike; statuses missing here
+// become codes.Unknown
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:           codes.InvalidArgument,
+	http.StatusUnauthorized:         codes.Unauthenticated,
+	http.StatusForbidden:            codes.PermissionDenied,
+	http.StatusNotFound:             codes.NotFound,
+	http.StatusConflict:             codes.Aborted,
+	http.StatusPreconditionFailed:   codes.FailedPrecondition,
+	http.StatusUnprocessableEntity:  codes.InvalidArgument,
+	http.StatusPreconditionRequired: codes.FailedPrecondition,
+	http.StatusInternalServerError:  codes.Internal,
+}
+
+// grpcCodesByType takes precedence over grpcCodes for the problems whose status does not tell their gRPC code
+var grpcCodesByType = map[string]codes.Code{
+	problemTypeCustomerAlreadyExists: codes.AlreadyExists,
+	problemTypeIdempotencyInProgress: codes.Aborted,
+}
+
+// grpcError is the gRPC counterpart of writeError: the problem becomes the status, its type an ErrorInfo
+// detail and its field errors, localized to the accept-language metadata, a BadRequest detail
+func grpcError(ctx context.Context, err error) error {
+	trans := validation.TranslatorFor(metadataValue(ctx, "accept-language"))
+	problem := customerErrorToHttp(err, trans)
+	code, found := grpcCodesByType[problem.Type]
+	if !found {
+		code, found = grpcCodes[problem.Status]
+	}
+	if !found {
+		code = codes.Unknown
+	}
+	message := problem.Detail
+	if message == "" {
+		message = problem.Title
+	}
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: problemCode(problem.Type), Domain: "customers", Metadata: map[string]string{"type": problem.Type}}}
+	if len(problem.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, fieldErr := range problem.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: fieldErr.Field, Description: fieldErr.Detail})
+		}
+		details = append(details, badRequest)
+	}
+	st, detailErr := status.New(code, message).WithDetails(details...)
+	if detailErr != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// GrpcAuthenticate is the gRPC counterpart of Authenticate, reading the credentials from the metadata
+func GrpcAuthenticate(tokens auth.TokenVerifier, apiKeys domain.ApiKeyService) grpc.UnaryServerInterceptor {
+	verifier := apiKeyVerifier{service: apiKeys}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		header := http.Header{}
+		for key, values := range md {
+			for _, value := range values {
+				header.Add(key, value)
+			}
+		}
+		principal, err := auth.AuthenticateHeader(header, tokens, verifier)
+		if err != nil {
+			return nil, grpcError(ctx, err)
+		}
+		return handler(auth.WithPrincipal(ctx, principal), req)
+	}
+}
+
+// GrpcRecover is the gRPC counterpart of the Recoverer middleware: grpc-go does not recover handler panics,
+// so without it a repository panic would take the whole process down. It belongs first in the chain
+func GrpcRecover() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("panic serving %s: %v\n%s", info.FullMethod, recovered, debug.Stack())
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+type customerGrpcServer struct {
+	customerpb.UnimplementedCustomerServiceServer
+	service domain.CustomerService
+}
+
+// RegisterCustomerGrpcService serves the service behind GrpcAuthenticate; a method missing from the policy
+// is a programming error, so it fails at startup rather than being left open
+func RegisterCustomerGrpcService(server grpc.ServiceRegistrar, service domain.CustomerService) {
+	serviceDesc := customerpb.CustomerService_ServiceDesc
+	for _, method := range serviceDesc.Methods {
+		fullMethod := fmt.Sprintf("/%s/%s", serviceDesc.ServiceName, method.MethodName)
+		if _, found := customerGrpcScopes[fullMethod]; !found {
+			panic(fmt.Sprintf("no scope declared for %s", fullMethod))
+		}
+	}
+	customerpb.RegisterCustomerServiceServer(server, customerGrpcServer{service: service})
+}
+
+// authorize checks the scope of the method and resolves the tenant, as the HTTP routes do
+func authorize(ctx context.Context, fullMethod string) (domain.TenantId, error) {
+	return authorizeTenant(ctx, customerGrpcScopes[fullMethod], metadataValue(ctx, tenantMetadataKey))
+}
+
+func newCustomerMessage(customer domain.Customer) *customerpb.Customer {
+	message := &customerpb.Customer{
+		Id:      customer.Id.Raw,
+		Name:    customer.Name,
+		Age:     int32(customer.Age),
+		Version: customer.Version,
+	}
+	if !customer.CreatedAt.IsZero() {
+		message.CreatedAt = timestamppb.New(customer.CreatedAt)
+	}
+	if !customer.UpdatedAt.IsZero() {
+		message.UpdatedAt = timestamppb.New(customer.UpdatedAt)
+	}
+	return message
+}
+
+func intOf(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
+
+// expectedVersionOf is the gRPC counterpart of expectedVersion; 0 stands for AnyVersion, as "*" does in If-Match
+func expectedVersionOf(version *int64) (int64, error) {
+	if version == nil {
+		return 0, preconditionRequiredError{Precondition: "expected_version"}
+	}
+	return *version, nil
+}
+
+func (server customerGrpcServer) CreateCustomer(ctx context.Context, req *customerpb.CreateCustomerRequest) (*customerpb.CreateCustomerResponse, error) {
+	tenant, err := authorize(ctx, customerpb.CustomerService_CreateCustomer_FullMethodName)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	command, err := CreateCustomerApiInput{Name: req.Name, Age: int(req.Age)}.toCommand()
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	var customerId domain.CustomerId
+	var replayed bool
+	if req.IdempotencyKey == "" {
+		customerId, err = server.service.CreateCustomer(tenant, command)
+	} else {
+		customerId, replayed, err = server.service.CreateCustomerIdempotently(tenant, req.IdempotencyKey, command)
+	}
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &customerpb.CreateCustomerResponse{Id: customerId.Raw, Replayed: replayed}, nil
+}
+
+func (server customerGrpcServer) GetCustomer(ctx context.Context, req *customerpb.GetCustomerRequest) (*customerpb.Customer, error) {
+	tenant, err := authorize(ctx, customerpb.CustomerService_GetCustomer_FullMethodName)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	customerId, err := domain.ParseCustomerId(req.Id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	customer, found, err := server.service.GetCustomer(tenant, customerId)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if !found {
+		return nil, grpcError(ctx, domain.CustomerNotFoundError{Id: customerId})
+	}
+	return newCustomerMessage(customer), nil
+}
+
+func (server customerGrpcServer) ListCustomers(ctx context.Context, req *customerpb.ListCustomersRequest) (*customerpb.ListCustomersResponse, error) {
+	tenant, err := authorize(ctx, customerpb.CustomerService_ListCustomers_FullMethodName)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	query := domain.CustomerQuery{
+		Filter: domain.CustomerFilter{
+			Name:       req.Name,
+			NamePrefix: req.NamePrefix,
+			Age:        intOf(req.Age),
+			AgeGt:      intOf(req.AgeGt),
+			AgeGte:     intOf(req.AgeGte),
+			AgeLt:      intOf(req.AgeLt),
+			AgeLte:     intOf(req.AgeLte),
+		},
+	}
+	if req.Sort != "" {
+		query.Sort, err = parseCustomerSort(req.Sort)
+		if err != nil {
+			return nil, grpcError(ctx, validation.InvalidInput{Err: err})
+		}
+	}
+	pageRequest := domain.CustomerPageRequest{Cursor: req.Cursor, Limit: int(req.Limit)}
+	if pageRequest.Limit == 0 {
+		pageRequest.Limit = defaultPageLimit
+	}
+	page, err := server.service.ListCustomers(tenant, query, pageRequest)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	response := &customerpb.ListCustomersResponse{Items: make([]*customerpb.Customer, 0, len(page.Items))}
+	for _, customer := range page.Items {
+		response.Items = append(response.Items, newCustomerMessage(customer))
+	}
+	if page.NextCursor != nil {
+		response.NextCursor = page.NextCursor.Encode()
+	}
+	return response, nil
+}
+
+func (server customerGrpcServer) UpdateCustomer(ctx context.Context, req *customerpb.UpdateCustomerRequest) (*customerpb.Customer, error) {
+	tenant, err := authorize(ctx, customerpb.CustomerService_UpdateCustomer_FullMethodName)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	customerId, err := domain.ParseCustomerId(req.Id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	version, err := expectedVersionOf(req.ExpectedVersion)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	command, err := UpdateCustomerApiInput{Name: req.Name, Age: int(req.Age)}.toCommand()
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	customer, err := server.service.UpdateCustomer(tenant, customerId, version, command)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return newCustomerMessage(customer), nil
+}
+
+func (server customerGrpcServer) PatchCustomer(ctx context.Context, req *customerpb.PatchCustomerRequest) (*customerpb.Customer, error) {
+	tenant, err := authorize(ctx, customerpb.CustomerService_PatchCustomer_FullMethodName)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	customerId, err := domain.ParseCustomerId(req.Id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	version, err := expectedVersionOf(req.ExpectedVersion)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	command, err := PatchCustomerApiInput{Name: req.Name, Age: intOf(req.Age)}.toCommand()
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	customer, err := server.service.PatchCustomer(tenant, customerId, version, command)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return newCustomerMessage(customer), nil
+}
+
+func (server customerGrpcServer) DeleteCustomer(ctx context.Context, req *customerpb.DeleteCustomerRequest) (*customerpb.DeleteCustomerResponse, error) {
+	tenant, err := authorize(ctx, customerpb.CustomerService_DeleteCustomer_FullMethodName)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	customerId, err := domain.ParseCustomerId(req.Id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	version, err := expectedVersionOf(req.ExpectedVersion)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if err := server.service.DeleteCustomer(tenant, customerId, version); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &customerpb.DeleteCustomerResponse{}, nil
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const defaultPageLimit = 20
+
+type customerFilterSetter func(filter *domain.CustomerFilter, value string) error
+
+// customerFilterFields maps query fields to their operators; the operator follows the field after '_',
+// e.g. age_gte=18, and a bare field name means equality
+var customerFilterFields = map[string]map[string]customerFilterSetter{
+	"name": {
+		"": func(filter *domain.CustomerFilter, value string) error {
+			filter.Name = &value
+			return nil
+		},
+		"prefix": func(filter *domain.CustomerFilter, value string) error {
+			filter.NamePrefix = &value
+			return nil
+		},
+	},
+	"age": {
+		"":    intFilter(func(filter *domain.CustomerFilter) **int { return &filter.Age }),
+		"gt":  intFilter(func(filter *domain.CustomerFilter) **int { return &filter.AgeGt }),
+		"gte": intFilter(func(filter *domain.CustomerFilter) **int { return &filter.AgeGte }),
+		"lt":  intFilter(func(filter *domain.CustomerFilter) **int { return &filter.AgeLt }),
+		"lte": intFilter(func(filter *domain.CustomerFilter) **int { return &filter.AgeLte }),
+	},
+}
+
+var customerSortFields = []domain.CustomerSortField{
+	domain.CustomerSortById,
+	domain.CustomerSortByName,
+	domain.CustomerSortByAge,
+}
+
+var pageParams = []string{"cursor", "limit"}
+
+func intFilter(target func(filter *domain.CustomerFilter) **int) customerFilterSetter {
+	return func(filter *domain.CustomerFilter, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("value %q is not an integer", value)
+		}
+		*target(filter) = &parsed
+		return nil
+	}
+}
+
+func newCustomerQuery(values url.Values) (domain.CustomerQuery, error) {
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	slices.Sort(params)
+
+	var query domain.CustomerQuery
+	var errs []error
+	for _, param := range params {
+		value := values.Get(param)
+		switch {
+		case slices.Contains(pageParams, param):
+			continue
+		case param == "sort":
+			sort, err := parseCustomerSort(value)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			query.Sort = sort
+		default:
+			if err := applyCustomerFilter(&query.Filter, param, value); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return domain.CustomerQuery{}, validation.InvalidInput{Err: errors.Join(errs...)}
+	}
+	return query, nil
+}
+
+func applyCustomerFilter(filter *domain.CustomerFilter, param string, value string) error {
+	field, operator, _ := strings.Cut(param, "_")
+	operators, ok := customerFilterFields[field]
+	if !ok {
+		return fmt.Errorf("unknown query field '%s'", field)
+	}
+	setter, ok := operators[operator]
+	if !ok {
+		return fmt.Errorf("unsupported operator '%s' for field '%s'", operator, field)
+	}
+	if err := setter(filter, value); err != nil {
+		return fmt.Errorf("%s: %w", param, err)
+	}
+	return nil
+}
+
+// parseCustomerSort reads a comma separated list of fields, each optionally prefixed with '-' for descending order
+func parseCustomerSort(value string) ([]domain.CustomerSort, error) {
+	var sort []domain.CustomerSort
+	var seen []domain.CustomerSortField
+	for _, part := range strings.Split(value, ",") {
+		descending := strings.HasPrefix(part, "-")
+		field := domain.CustomerSortField(strings.TrimPrefix(part, "-"))
+		if !slices.Contains(customerSortFields, field) {
+			return nil, fmt.Errorf("cannot sort by '%s'", field)
+		}
+		if slices.Contains(seen, field) {
+			return nil, fmt.Errorf("sort field '%s' repeated", field)
+		}
+		seen = append(seen, field)
+		sort = append(sort, domain.CustomerSort{Field: field, Descending: descending})
+	}
+	return sort, nil
+}
+
+func newCustomerPageRequest(values url.Values) (domain.CustomerPageRequest, error) {
+	limit := defaultPageLimit
+	if rawLimit := values.Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil {
+			return domain.CustomerPageRequest{}, validation.InvalidInput{Err: fmt.Errorf("limit: value %q is not an integer", rawLimit)}
+		}
+		limit = parsed
+	}
+	return domain.CustomerPageRequest{
+		Cursor: values.Get("cursor"),
+		Limit:  limit,
+	}, nil
+}
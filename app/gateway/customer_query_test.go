@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCustomerQuery(t *testing.T) {
+	prefix := "Jo"
+	eighteen := 18
+	sixtyFive := 65
+
+	tests := []struct {
+		name          string
+		rawQuery      string
+		expected      domain.CustomerQuery
+		expectError   bool
+		errorMessages []string
+	}{
+		{
+			name:     "No parameters",
+			rawQuery: "",
+			expected: domain.CustomerQuery{},
+		},
+		{
+			name:     "Filters and sort",
+			rawQuery: "name_prefix=Jo&age_gte=18&age_lt=65&sort=-age,name",
+			expected: domain.CustomerQuery{
+				Filter: domain.CustomerFilter{NamePrefix: &prefix, AgeGte: &eighteen, AgeLt: &sixtyFive},
+				Sort: []domain.CustomerSort{
+					{Field: domain.CustomerSortByAge, Descending: true},
+					{Field: domain.CustomerSortByName},
+				},
+			},
+		},
+		{
+			name:     "Page parameters are ignored",
+			rawQuery: "limit=10&cursor=abc",
+			expected: domain.CustomerQuery{},
+		},
+		{
+			name:          "Unknown field",
+			rawQuery:      "email=john@example.com",
+			expectError:   true,
+			errorMessages: []string{"unknown query field 'email'"},
+		},
+		{
+			name:          "Bad operator",
+			rawQuery:      "name_gte=Jo",
+			expectError:   true,
+			errorMessages: []string{"unsupported operator 'gte' for field 'name'"},
+		},
+		{
+			name:          "Not an integer",
+			rawQuery:      "age_lt=old",
+			expectError:   true,
+			errorMessages: []string{"age_lt: value \"old\" is not an integer"},
+		},
+		{
+			name:          "Unknown sort field",
+			rawQuery:      "sort=email",
+			expectError:   true,
+			errorMessages: []string{"cannot sort by 'email'"},
+		},
+		{
+			name:          "Repeated sort field",
+			rawQuery:      "sort=age,-age",
+			expectError:   true,
+			errorMessages: []string{"sort field 'age' repeated"},
+		},
+		{
+			name:          "Several errors",
+			rawQuery:      "email=x&age_foo=1",
+			expectError:   true,
+			errorMessages: []string{"unknown query field 'email'", "unsupported operator 'foo' for field 'age'"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tc.rawQuery)
+			query, err := newCustomerQuery(values)
+
+			if tc.expectError {
+				assert.IsType(t, validation.InvalidInput{}, err)
+				for _, msg := range tc.errorMessages {
+					assert.Contains(t, err.Error(), msg)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, query)
+			}
+		})
+	}
+}
@@ -30,7 +30,7 @@ func TestValidate_CreateCustomerApiInput(t *testing.T) {
 				Age:  30,
 			},
 			expectError:   true,
-			errorMessages: []string{"Field validation for 'Name' failed on the 'min' tag"},
+			errorMessages: []string{"Field validation for 'name' failed on the 'customername' tag"},
 		},
 		{
 			name: "Name too short",
@@ -39,7 +39,7 @@ func TestValidate_CreateCustomerApiInput(t *testing.T) {
 				Age:  30,
 			},
 			expectError:   true,
-			errorMessages: []string{"Field validation for 'Name' failed on the 'min' tag"},
+			errorMessages: []string{"Field validation for 'name' failed on the 'customername' tag"},
 		},
 		{
 			name: "Name too long",
@@ -48,7 +48,7 @@ func TestValidate_CreateCustomerApiInput(t *testing.T) {
 				Age:  30,
 			},
 			expectError:   true,
-			errorMessages: []string{"Field validation for 'Name' failed on the 'max' tag"},
+			errorMessages: []string{"Field validation for 'name' failed on the 'customername' tag"},
 		},
 		{
 			name: "Zero Age",
@@ -57,7 +57,7 @@ func TestValidate_CreateCustomerApiInput(t *testing.T) {
 				Age:  0,
 			},
 			expectError:   true,
-			errorMessages: []string{"Field validation for 'Age' failed on the 'min' tag"},
+			errorMessages: []string{"Field validation for 'age' failed on the 'customerage' tag"},
 		},
 		{
 			name: "Age too low",
@@ -66,7 +66,7 @@ func TestValidate_CreateCustomerApiInput(t *testing.T) {
 				Age:  -1,
 			},
 			expectError:   true,
-			errorMessages: []string{"Field validation for 'Age' failed on the 'min' tag"},
+			errorMessages: []string{"Field validation for 'age' failed on the 'customerage' tag"},
 		},
 		{
 			name: "Age too high",
@@ -75,7 +75,7 @@ func TestValidate_CreateCustomerApiInput(t *testing.T) {
 				Age:  201,
 			},
 			expectError:   true,
-			errorMessages: []string{"Field validation for 'Age' failed on the 'max' tag"},
+			errorMessages: []string{"Field validation for 'age' failed on the 'customerage' tag"},
 		},
 		{
 			name: "Both fields invalid",
@@ -84,7 +84,7 @@ func TestValidate_CreateCustomerApiInput(t *testing.T) {
 				Age:  0,
 			},
 			expectError:   true,
-			errorMessages: []string{"Field validation for 'Name' failed on the 'min' tag", "Field validation for 'Age' failed on the 'min' tag"},
+			errorMessages: []string{"Field validation for 'name' failed on the 'customername' tag", "Field validation for 'age' failed on the 'customerage' tag"},
 		},
 	}
 
@@ -0,0 +1,501 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const openApiPath = "/openapi.json"
+
+type openApiDocument struct {
+	OpenApi    string                     `json:"openapi"`
+	Info       openApiInfo                `json:"info"`
+	Paths      map[string]openApiPathItem `json:"paths"`
+	Components openApiComponents          `json:"components"`
+}
+
+type openApiInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// openApiPathItem maps lower case methods to their operations
+type openApiPathItem map[string]openApiOperation
+
+type openApiOperation struct {
+	OperationId string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Parameters  []openApiParameter         `json:"parameters,omitempty"`
+	RequestBody *openApiRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openApiResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security"`
+}
+
+type openApiParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openApiSchema `json:"schema"`
+}
+
+type openApiRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openApiMediaType `json:"content"`
+}
+
+type openApiResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]openApiHeader    `json:"headers,omitempty"`
+	Content     map[string]openApiMediaType `json:"content,omitempty"`
+}
+
+type openApiHeader struct {
+	Description string         `json:"description,omitempty"`
+	Schema      *openApiSchema `json:"schema"`
+}
+
+type openApiMediaType struct {
+	Schema *openApiSchema `json:"schema"`
+}
+
+type openApiComponents struct {
+	Schemas         map[string]*openApiSchema        `json:"schemas"`
+	SecuritySchemes map[string]openApiSecurityScheme `json:"securitySchemes"`
+}
+
+type openApiSecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// openApiSchema is the JSON Schema subset the generator produces; Type is a string, or a list of strings
+// for nullable values
+type openApiSchema struct {
+	Ref              string                    `json:"$ref,omitempty"`
+	Type             any                       `json:"type,omitempty"`
+	Description      string                    `json:"description,omitempty"`
+	Properties       map[string]*openApiSchema `json:"properties,omitempty"`
+	Required         []string                  `json:"required,omitempty"`
+	Items            *openApiSchema            `json:"items,omitempty"`
+	Enum             []any                     `json:"enum,omitempty"`
+	Pattern          string                    `json:"pattern,omitempty"`
+	MinLength        *int                      `json:"minLength,omitempty"`
+	MaxLength        *int                      `json:"maxLength,omitempty"`
+	Minimum          *float64                  `json:"minimum,omitempty"`
+	Maximum          *float64                  `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64                  `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64                  `json:"exclusiveMaximum,omitempty"`
+	MinItems         *int                      `json:"minItems,omitempty"`
+	MaxItems         *int                      `json:"maxItems,omitempty"`
+}
+
+// customerOperation describes a route of CustomerRouter beyond what the router knows; body and response are
+// zero values of the DTOs, nil when there is none
+type customerOperation struct {
+	id         string
+	summary    string
+	parameters []openApiParameter
+	body       any
+	status     int
+	response   any
+	headers    map[string]openApiHeader
+	// conditional operations answer 304 to If-None-Match and If-Modified-Since
+	conditional bool
+	// problems lists the statuses of problem responses besides commonProblems
+	problems []int
+}
+
+// commonProblems may come from any operation: bad tenants and contract violations, authentication, scopes
+// and internal errors
+var commonProblems = []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError}
+
+var (
+	tenantParameter = openApiParameter{
+		Name:        tenantHeader,
+		In:          "header",
+		Description: "Tenant of the customers; required unless the credentials are bound to a tenant, and then it must match",
+		Schema:      &openApiSchema{Type: "string", Pattern: fmt.Sprintf("^[0-9a-z][0-9a-z_-]{0,%d}$", domain.MaxTenantIdLength-1)},
+	}
+	customerIdParameter = openApiParameter{
+		Name:     "id",
+		In:       "path",
+		Required: true,
+		Schema:   &openApiSchema{Type: "string"},
+	}
+	ifMatchParameter = openApiParameter{
+		Name:        "If-Match",
+		In:          "header",
+		Description: `ETag of the customer being changed, or "*" to change any version`,
+		Required:    true,
+		Schema:      &openApiSchema{Type: "string"},
+	}
+	etagHeader = openApiHeader{
+		Description: `Version of the customer in the returned representation, e.g. "3" for JSON and "3+xml" for XML, for If-Match and If-None-Match`,
+		Schema:      &openApiSchema{Type: "string"},
+	}
+	lastModifiedHeader = openApiHeader{
+		Description: "Time of the last change, absent for customers stored before it was tracked",
+		Schema:      &openApiSchema{Type: "string"},
+	}
+)
+
+var mutationProblems = []int{
+	http.StatusNotFound,
+	http.StatusNotAcceptable,
+	http.StatusPreconditionFailed,
+	http.StatusUnsupportedMediaType,
+	http.StatusUnprocessableEntity,
+	http.StatusPreconditionRequired,
+}
+
+// customerOperations is keyed like customerRouteScopes; every route must be described, see newCustomerOpenApi
+var customerOperations = map[string]customerOperation{
+	"POST /": {
+		id:      "createCustomer",
+		summary: "Create a customer",
+		parameters: []openApiParameter{tenantParameter, {
+			Name:        idempotencyKeyHeader,
+			In:          "header",
+			Description: "Makes retries return the customer created first instead of creating another",
+			Schema:      &openApiSchema{Type: "string", MinLength: ptr(1), MaxLength: ptr(domain.MaxIdempotencyKeyLength), Pattern: "^[ -~]+$"},
+		}},
+		body:     CreateCustomerApiInput{},
+		status:   http.StatusCreated,
+		response: CustomerIdApiOutput{},
+		headers: map[string]openApiHeader{
+			"Location":               {Description: "Url of the customer", Schema: &openApiSchema{Type: "string"}},
+			idempotentReplayedHeader: {Description: "Present on replays of an earlier request", Schema: &openApiSchema{Type: "string", Enum: []any{"true"}}},
+		},
+		problems: []int{http.StatusNotAcceptable, http.StatusConflict, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+	},
+	"GET /": {
+		id:         "listCustomers",
+		summary:    "List customers page by page",
+		parameters: append([]openApiParameter{tenantParameter}, customerListParameters()...),
+		status:     http.StatusOK,
+		response:   CustomerPageApiOutput{},
+		problems:   []int{http.StatusNotAcceptable, http.StatusUnprocessableEntity},
+	},
+	"GET /{id}": {
+		id:      "getCustomer",
+		summary: "Get a customer",
+		parameters: []openApiParameter{
+			tenantParameter,
+			customerIdParameter,
+			{Name: "If-None-Match", In: "header", Schema: &openApiSchema{Type: "string"}},
+			{Name: "If-Modified-Since", In: "header", Schema: &openApiSchema{Type: "string"}},
+		},
+		status:      http.StatusOK,
+		response:    CustomerApiOutput{},
+		headers:     map[string]openApiHeader{"ETag": etagHeader, "Last-Modified": lastModifiedHeader},
+		conditional: true,
+		problems:    []int{http.StatusNotFound, http.StatusNotAcceptable},
+	},
+	"PUT /{id}": {
+		id:         "updateCustomer",
+		summary:    "Replace a customer",
+		parameters: []openApiParameter{tenantParameter, customerIdParameter, ifMatchParameter},
+		body:       UpdateCustomerApiInput{},
+		status:     http.StatusOK,
+		response:   CustomerApiOutput{},
+		headers:    map[string]openApiHeader{"ETag": etagHeader, "Last-Modified": lastModifiedHeader},
+		problems:   mutationProblems,
+	},
+	"PATCH /{id}": {
+		id:         "patchCustomer",
+		summary:    "Change some fields of a customer",
+		parameters: []openApiParameter{tenantParameter, customerIdParameter, ifMatchParameter},
+		body:       PatchCustomerApiInput{},
+		status:     http.StatusOK,
+		response:   CustomerApiOutput{},
+		headers:    map[string]openApiHeader{"ETag": etagHeader, "Last-Modified": lastModifiedHeader},
+		problems:   mutationProblems,
+	},
+	"DELETE /{id}": {
+		id:         "deleteCustomer",
+		summary:    "Delete a customer",
+		parameters: []openApiParameter{tenantParameter, customerIdParameter, ifMatchParameter},
+		status:     http.StatusNoContent,
+		problems:   []int{http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired},
+	},
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// customerListParameters follows the filters and sort fields of newCustomerQuery; filters take the type
+// of the customer field they filter
+func customerListParameters() []openApiParameter {
+	fieldSchemas := newSchemaGenerator().objectSchema(reflect.TypeOf(CustomerApiOutput{})).Properties
+	var parameters []openApiParameter
+	for _, field := range sortedKeys(customerFilterFields) {
+		for _, operator := range sortedKeys(customerFilterFields[field]) {
+			name := field
+			if operator != "" {
+				name += "_" + operator
+			}
+			parameters = append(parameters, openApiParameter{Name: name, In: "query", Schema: &openApiSchema{Type: fieldSchemas[field].Type}})
+		}
+	}
+	sortFields := make([]string, 0, len(customerSortFields))
+	for _, field := range customerSortFields {
+		sortFields = append(sortFields, string(field))
+	}
+	limitField, _ := reflect.TypeOf(domain.CustomerPageRequest{}).FieldByName("Limit")
+	limit := &openApiSchema{Type: "integer", Description: fmt.Sprintf("defaults to %d", defaultPageLimit)}
+	applyConstraints(limit, limitField.Tag.Get("validate"))
+	return append(parameters,
+		openApiParameter{
+			Name:        "sort",
+			In:          "query",
+			Description: fmt.Sprintf("comma separated fields out of %s, each prefixed with '-' for descending order", strings.Join(sortFields, ", ")),
+			Schema:      &openApiSchema{Type: "string"},
+		},
+		openApiParameter{Name: "cursor", In: "query", Description: "next_cursor of the previous page", Schema: &openApiSchema{Type: "string"}},
+		openApiParameter{Name: "limit", In: "query", Schema: limit},
+	)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// newCustomerOpenApi describes the routes CustomerRouter registers; a route without a customerOperation, or
+// an operation without a route, is an error, so the document cannot silently fall behind the router
+func newCustomerOpenApi(operations map[string]customerOperation) (openApiDocument, error) {
+	const baseUrl = "/customers"
+	router := chi.NewMux()
+	CustomerRouter(domain.CustomerService{}, router)
+
+	generator := newSchemaGenerator()
+	document := openApiDocument{
+		OpenApi: "3.1.0",
+		Info:    openApiInfo{Title: "Customers", Version: "1.0.0"},
+		Paths:   map[string]openApiPathItem{},
+		Components: openApiComponents{
+			Schemas: generator.schemas,
+			SecuritySchemes: map[string]openApiSecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"apiKeyAuth": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+	described := map[string]bool{}
+	err := chi.Walk(router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		pattern := "/" + strings.TrimPrefix(strings.TrimPrefix(route, baseUrl), "/")
+		key := method + " " + pattern
+		operation, found := operations[key]
+		if !found {
+			return fmt.Errorf("route %s %s is not described", method, route)
+		}
+		described[key] = true
+		path := strings.TrimSuffix(baseUrl+pattern, "/")
+		if document.Paths[path] == nil {
+			document.Paths[path] = openApiPathItem{}
+		}
+		document.Paths[path][strings.ToLower(method)] = generator.operation(operation, customerRouteScopes[key])
+		return nil
+	})
+	if err != nil {
+		return openApiDocument{}, err
+	}
+	for key := range operations {
+		if !described[key] {
+			return openApiDocument{}, fmt.Errorf("operation %s has no route", key)
+		}
+	}
+	return document, nil
+}
+
+func (generator schemaGenerator) operation(operation customerOperation, scope string) openApiOperation {
+	responses := map[string]openApiResponse{}
+	problem := map[string]openApiMediaType{problemContentType: {Schema: generator.schemaOf(reflect.TypeOf(Problem{}))}}
+	for _, status := range append(slices.Clone(commonProblems), operation.problems...) {
+		responses[strconv.Itoa(status)] = openApiResponse{Description: http.StatusText(status), Content: problem}
+	}
+	success := openApiResponse{Description: http.StatusText(operation.status), Headers: operation.headers}
+	if operation.response != nil {
+		success.Content = customerContent(generator.schemaOf(reflect.TypeOf(operation.response)), customerCodecs.supported())
+	}
+	responses[strconv.Itoa(operation.status)] = success
+	if operation.conditional {
+		responses[strconv.Itoa(http.StatusNotModified)] = openApiResponse{Description: http.StatusText(http.StatusNotModified)}
+	}
+	result := openApiOperation{
+		OperationId: operation.id,
+		Summary:     operation.summary,
+		Parameters:  operation.parameters,
+		Responses:   responses,
+		Security:    []map[string][]string{{"bearerAuth": {scope}}, {"apiKeyAuth": {scope}}},
+	}
+	if operation.body != nil {
+		mediaTypes := customerCodecs.supported()
+		if _, isPatch := operation.body.(PatchCustomerApiInput); isPatch {
+			mediaTypes = mergePatchMediaTypes
+		}
+		result.RequestBody = &openApiRequestBody{Required: true, Content: customerContent(generator.schemaOf(reflect.TypeOf(operation.body)), mediaTypes)}
+	}
+	return result
+}
+
+func customerContent(schema *openApiSchema, mediaTypes []string) map[string]openApiMediaType {
+	content := make(map[string]openApiMediaType, len(mediaTypes))
+	for _, mediaType := range mediaTypes {
+		content[mediaType] = openApiMediaType{Schema: schema}
+	}
+	return content
+}
+
+// schemaGenerator turns DTO structs into component schemas, referenced by their type names
+type schemaGenerator struct {
+	schemas map[string]*openApiSchema
+}
+
+func newSchemaGenerator() schemaGenerator {
+	return schemaGenerator{schemas: map[string]*openApiSchema{}}
+}
+
+func (generator schemaGenerator) schemaOf(t reflect.Type) *openApiSchema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return generator.schemaOf(t.Elem())
+	case reflect.String:
+		return &openApiSchema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &openApiSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openApiSchema{Type: "number"}
+	case reflect.Bool:
+		return &openApiSchema{Type: "boolean"}
+	case reflect.Slice:
+		return &openApiSchema{Type: "array", Items: generator.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if _, found := generator.schemas[t.Name()]; !found {
+			generator.schemas[t.Name()] = generator.objectSchema(t)
+		}
+		return &openApiSchema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		panic(fmt.Sprintf("no schema for %s", t))
+	}
+}
+
+// objectSchema lists fields under their json names; a field is required unless it is omitempty or its
+// validation skips absent values, and a pointer that is always present is nullable
+func (generator schemaGenerator) objectSchema(t reflect.Type) *openApiSchema {
+	schema := &openApiSchema{Type: "object", Properties: map[string]*openApiSchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		validate := field.Tag.Get("validate")
+		optional := strings.Contains(options, "omitempty") || strings.HasPrefix(validate, "omitnil") || strings.HasPrefix(validate, "omitempty")
+		property := generator.schemaOf(field.Type)
+		if field.Type.Kind() == reflect.Pointer && !optional {
+			property.Type = []string{property.Type.(string), "null"}
+		}
+		applyConstraints(property, validate)
+		schema.Properties[name] = property
+		if !optional {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// applyConstraints states the validate rules of a field as JSON Schema keywords; rules without a
+// counterpart are left to the description of the validation failures
+func applyConstraints(schema *openApiSchema, tag string) {
+	for _, constraint := range validation.Expand(tag) {
+		if constraint.Pattern != "" {
+			schema.Pattern = constraint.Pattern
+			continue
+		}
+		number, err := strconv.ParseFloat(constraint.Param, 64)
+		if err != nil && constraint.Tag != "oneof" {
+			continue
+		}
+		switch {
+		case constraint.Tag == "oneof":
+			for _, value := range strings.Fields(constraint.Param) {
+				schema.Enum = append(schema.Enum, value)
+			}
+		case schema.Type == "string":
+			applyLengthConstraint(constraint.Tag, int(number), &schema.MinLength, &schema.MaxLength)
+		case schema.Type == "array":
+			applyLengthConstraint(constraint.Tag, int(number), &schema.MinItems, &schema.MaxItems)
+		default:
+			switch constraint.Tag {
+			case "min", "gte":
+				schema.Minimum = &number
+			case "max", "lte":
+				schema.Maximum = &number
+			case "gt":
+				schema.ExclusiveMinimum = &number
+			case "lt":
+				schema.ExclusiveMaximum = &number
+			case "len":
+				schema.Minimum, schema.Maximum = &number, &number
+			}
+		}
+	}
+}
+
+func applyLengthConstraint(tag string, length int, min **int, max **int) {
+	switch tag {
+	case "min", "gte":
+		*min = &length
+	case "max", "lte":
+		*max = &length
+	case "gt":
+		*min = ptr(length + 1)
+	case "lt":
+		*max = ptr(length - 1)
+	case "len":
+		*min, *max = &length, &length
+	}
+}
+
+// mustCustomerOpenApi is for startup, where an undescribed route is a programming error
+func mustCustomerOpenApi() openApiDocument {
+	document, err := newCustomerOpenApi(customerOperations)
+	if err != nil {
+		panic(err)
+	}
+	return document
+}
+
+// OpenApiRouter serves the OpenAPI document of CustomerRouter; it is generated once, at startup
+func OpenApiRouter(r chi.Router) {
+	encoded, err := json.MarshalIndent(mustCustomerOpenApi(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	r.Get(openApiPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(encoded)
+	})
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"encoding/json"
+	"flag"
+	"maps"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/openapi.json from the router")
+
+const openApiGoldenFile = "testdata/openapi.json"
+
+// TestCustomerOpenApi_Drift fails when the API changes without the committed document; review the change and
+// rerun with -update to accept it
+func TestCustomerOpenApi_Drift(t *testing.T) {
+	// given
+	document, err := newCustomerOpenApi(customerOperations)
+	require.NoError(t, err)
+	generated, err := json.MarshalIndent(document, "", "  ")
+	require.NoError(t, err)
+	if *update {
+		require.NoError(t, os.WriteFile(openApiGoldenFile, append(generated, '\n'), 0o644))
+	}
+
+	// when
+	committed, err := os.ReadFile(openApiGoldenFile)
+
+	// then
+	require.NoError(t, err)
+	assert.JSONEq(t, string(committed), string(generated), "%s is out of date, rerun with -update", openApiGoldenFile)
+}
+
+func TestCustomerOpenApi_EveryRouteDescribed(t *testing.T) {
+	// given
+	operations := maps.Clone(customerOperations)
+	delete(operations, "DELETE /{id}")
+
+	// when
+	_, err := newCustomerOpenApi(operations)
+
+	// then
+	assert.EqualError(t, err, "route DELETE /customers/{id} is not described")
+}
+
+func TestCustomerOpenApi_EveryOperationRouted(t *testing.T) {
+	// given
+	operations := maps.Clone(customerOperations)
+	operations["POST /{id}"] = customerOperation{id: "replaceCustomer", status: http.StatusOK}
+
+	// when
+	_, err := newCustomerOpenApi(operations)
+
+	// then
+	assert.EqualError(t, err, "operation POST /{id} has no route")
+}
+
+func TestCustomerOpenApi_ValidationConstraints(t *testing.T) {
+	// given
+	document, err := newCustomerOpenApi(customerOperations)
+	require.NoError(t, err)
+
+	// when
+	create := document.Components.Schemas["CreateCustomerApiInput"]
+	patch := document.Components.Schemas["PatchCustomerApiInput"]
+	page := document.Components.Schemas["CustomerPageApiOutput"]
+
+	// then
+	assert.Equal(t, []string{"name", "age"}, create.Required)
+	assert.Equal(t, ptr(1), create.Properties["name"].MinLength)
+	assert.Equal(t, ptr(30), create.Properties["name"].MaxLength)
+	assert.NotEmpty(t, create.Properties["name"].Pattern)
+	assert.Equal(t, ptr(1.0), create.Properties["age"].Minimum)
+	assert.Equal(t, ptr(200.0), create.Properties["age"].Maximum)
+
+	// and
+	assert.Empty(t, patch.Required, "Merge patch members should be optional")
+	assert.Equal(t, "integer", patch.Properties["age"].Type, "Merge patch members should not be nullable")
+	assert.Equal(t, []string{"string", "null"}, page.Properties["next_cursor"].Type)
+}
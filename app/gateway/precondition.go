@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// preconditionRequiredError names the missing precondition, e.g. the If-Match header
+type preconditionRequiredError struct {
+	Precondition string
+}
+
+func (e preconditionRequiredError) Error() string {
+	return fmt.Sprintf("%s is required, with the version of the customer being changed", e.Precondition)
+}
+
+// preconditionFailedError is returned for an If-Match no version can match, such as a weak or foreign ETag
+type preconditionFailedError struct {
+	IfMatch string
+}
+
+func (e preconditionFailedError) Error() string {
+	return fmt.Sprintf("If-Match %s does not match the customer", e.IfMatch)
+}
+
+// etagOf is a strong ETag of the representation the codec writes, as versions change with every change of
+// the customer and each representation is a different sequence of bytes
+func etagOf(customer domain.Customer, codec codec) string {
+	return `"` + strconv.FormatInt(customer.Version, 10) + codec.etagSuffix + `"`
+}
+
+// versionOf reads the version of an ETag of any representation, e.g. both "3" and "3+xml" are version 3
+func versionOf(etag string) (int64, bool) {
+	unquoted, quoted := strings.CutPrefix(etag, `"`)
+	unquoted, closed := strings.CutSuffix(unquoted, `"`)
+	if !quoted || !closed {
+		return 0, false
+	}
+	raw, suffix, suffixed := strings.Cut(unquoted, "+")
+	if suffixed && !slices.ContainsFunc(customerCodecs.codecs, func(codec codec) bool { return codec.etagSuffix == "+"+suffix }) {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(raw, 10, 64)
+	return version, err == nil && version >= 1
+}
+
+// setValidators sets the ETag of the representation and, when the customer's update time is known,
+// Last-Modified
+func setValidators(w http.ResponseWriter, customer domain.Customer, codec codec) {
+	w.Header().Set("ETag", etagOf(customer, codec))
+	if !customer.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", customer.UpdatedAt.Format(http.TimeFormat))
+	}
+}
+
+// notModified evaluates If-None-Match and, only in its absence, If-Modified-Since, as RFC 9110 orders them;
+// If-None-Match uses the weak comparison, so W/ prefixes are ignored, but only matches the ETag of the
+// negotiated representation
+func notModified(r *http.Request, customer domain.Customer, codec codec) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := etagOf(customer, codec)
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || customer.UpdatedAt.IsZero() {
+		return false
+	}
+	// Last-Modified is only precise to the second
+	return !customer.UpdatedAt.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// expectedVersion reads the version a mutation is based on from If-Match, which may carry the ETag of any
+// representation; "*" applies to any version, while lists of ETags are not supported
+func expectedVersion(r *http.Request) (int64, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return 0, preconditionRequiredError{Precondition: "the If-Match header"}
+	}
+	if ifMatch == "*" {
+		return domain.AnyVersion, nil
+	}
+	version, valid := versionOf(ifMatch)
+	if !valid {
+		return 0, preconditionFailedError{IfMatch: ifMatch}
+	}
+	return version, nil
+}
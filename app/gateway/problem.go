@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway/auth"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"net/http"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem types are relative URI references, stable across deployments
+const (
+	problemTypeCustomerAlreadyExists = "/problems/customer-already-exists"
+	problemTypeCustomerNotFound      = "/problems/customer-not-found"
+	problemTypeInvalidCursor         = "/problems/invalid-cursor"
+	problemTypeInvalidCustomerId     = "/problems/invalid-customer-id"
+	problemTypeValidationFailed      = "/problems/validation-failed"
+	problemTypeMalformedRequest      = "/problems/malformed-request"
+	problemTypeUnauthenticated       = "/problems/unauthenticated"
+	problemTypeInsufficientScope     = "/problems/insufficient-scope"
+	problemTypeApiKeyNotFound        = "/problems/api-key-not-found"
+	problemTypeInvalidTenantId       = "/problems/invalid-tenant-id"
+	problemTypeTenantRequired        = "/problems/tenant-required"
+	problemTypeTenantMismatch        = "/problems/tenant-mismatch"
+	problemTypeInvalidIdempotencyKey = "/problems/invalid-idempotency-key"
+	problemTypeIdempotencyKeyReused  = "/problems/idempotency-key-reused"
+	problemTypeIdempotencyInProgress = "/problems/idempotency-key-in-progress"
+	problemTypePreconditionRequired  = "/problems/precondition-required"
+	problemTypePreconditionFailed    = "/problems/precondition-failed"
+	problemTypeUnsupportedMediaType  = "/problems/unsupported-media-type"
+	problemTypeNotAcceptable         = "/problems/not-acceptable"
+	problemTypeContractViolation     = "/problems/contract-violation"
+	problemTypeInternalError         = "/problems/internal-error"
+)
+
+// Problem is an RFC 7807 problem details document
+type Problem struct {
+	Type     string             `json:"type"`
+	Title    string             `json:"title"`
+	Status   int                `json:"status"`
+	Detail   string             `json:"detail,omitempty"`
+	Instance string             `json:"instance,omitempty"`
+	Errors   []FieldErrorOutput `json:"errors,omitempty"`
+}
+
+type FieldErrorOutput struct {
+	Field  string `json:"field"`
+	Rule   string `json:"rule"`
+	Param  string `json:"param,omitempty"`
+	Detail string `json:"detail"`
+}
+
+type malformedRequestError struct {
+	Err error
+}
+
+func (e malformedRequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e malformedRequestError) Unwrap() error {
+	return e.Err
+}
+
+func customerErrorToHttp(err error, trans ut.Translator) Problem {
+	var customerExistsErr domain.CustomerAlreadyExistsError
+	var customerNotFoundErr domain.CustomerNotFoundError
+	var invalidCursorErr domain.InvalidCursorError
+	var invalidCustomerIdErr domain.InvalidCustomerIdError
+	var invalidInputErr validation.InvalidInput
+	var malformedRequestErr malformedRequestError
+	var unauthenticatedErr auth.UnauthenticatedError
+	var insufficientScopeErr auth.InsufficientScopeError
+	var apiKeyNotFoundErr domain.ApiKeyNotFoundError
+	var invalidTenantIdErr domain.InvalidTenantIdError
+	var tenantRequiredErr tenantRequiredError
+	var tenantMismatchErr tenantMismatchError
+	var invalidIdempotencyKeyErr domain.InvalidIdempotencyKeyError
+	var idempotencyKeyReusedErr domain.IdempotencyKeyReusedError
+	var idempotencyKeyInProgressErr domain.IdempotencyKeyInProgressError
+	var versionMismatchErr domain.CustomerVersionMismatchError
+	var preconditionRequiredErr preconditionRequiredError
+	var preconditionFailedErr preconditionFailedError
+	var unsupportedMediaTypeErr unsupportedMediaTypeError
+	var notAcceptableErr notAcceptableError
+	var contractViolationErr contractViolationError
+
+	switch {
+	case errors.As(err, &customerExistsErr):
+		return Problem{Type: problemTypeCustomerAlreadyExists, Title: "Customer already exists", Status: http.StatusBadRequest, Detail: customerExistsErr.Error()}
+	case errors.As(err, &customerNotFoundErr):
+		return Problem{Type: problemTypeCustomerNotFound, Title: "Customer not found", Status: http.StatusNotFound, Detail: customerNotFoundErr.Error()}
+	case errors.As(err, &invalidCursorErr):
+		return Problem{Type: problemTypeInvalidCursor, Title: "Invalid cursor", Status: http.StatusBadRequest, Detail: invalidCursorErr.Error()}
+	case errors.As(err, &invalidCustomerIdErr):
+		return Problem{Type: problemTypeInvalidCustomerId, Title: "Invalid customer id", Status: http.StatusBadRequest, Detail: invalidCustomerIdErr.Error()}
+	case errors.As(err, &invalidInputErr):
+		fieldErrors := newFieldErrorOutputs(invalidInputErr.FieldErrors(trans))
+		if len(fieldErrors) > 0 {
+			return Problem{Type: problemTypeValidationFailed, Title: "Validation failed", Status: http.StatusUnprocessableEntity, Detail: "request contains invalid fields", Errors: fieldErrors}
+		}
+		return Problem{Type: problemTypeValidationFailed, Title: "Validation failed", Status: http.StatusUnprocessableEntity, Detail: invalidInputErr.Error()}
+	case errors.As(err, &malformedRequestErr):
+		return Problem{Type: problemTypeMalformedRequest, Title: "Malformed request", Status: http.StatusBadRequest, Detail: malformedRequestErr.Error()}
+	case errors.As(err, &unauthenticatedErr):
+		return Problem{Type: problemTypeUnauthenticated, Title: "Unauthenticated", Status: http.StatusUnauthorized, Detail: unauthenticatedErr.Error()}
+	case errors.As(err, &insufficientScopeErr):
+		return Problem{Type: problemTypeInsufficientScope, Title: "Insufficient scope", Status: http.StatusForbidden, Detail: insufficientScopeErr.Error()}
+	case errors.As(err, &apiKeyNotFoundErr):
+		return Problem{Type: problemTypeApiKeyNotFound, Title: "Api key not found", Status: http.StatusNotFound, Detail: apiKeyNotFoundErr.Error()}
+	case errors.As(err, &invalidTenantIdErr):
+		return Problem{Type: problemTypeInvalidTenantId, Title: "Invalid tenant id", Status: http.StatusBadRequest, Detail: invalidTenantIdErr.Error()}
+	case errors.As(err, &tenantRequiredErr):
+		return Problem{Type: problemTypeTenantRequired, Title: "Tenant required", Status: http.StatusBadRequest, Detail: tenantRequiredErr.Error()}
+	case errors.As(err, &tenantMismatchErr):
+		return Problem{Type: problemTypeTenantMismatch, Title: "Tenant mismatch", Status: http.StatusForbidden, Detail: tenantMismatchErr.Error()}
+	case errors.As(err, &invalidIdempotencyKeyErr):
+		return Problem{Type: problemTypeInvalidIdempotencyKey, Title: "Invalid idempotency key", Status: http.StatusBadRequest, Detail: invalidIdempotencyKeyErr.Error()}
+	case errors.As(err, &idempotencyKeyReusedErr):
+		return Problem{Type: problemTypeIdempotencyKeyReused, Title: "Idempotency key reused", Status: http.StatusUnprocessableEntity, Detail: idempotencyKeyReusedErr.Error()}
+	case errors.As(err, &idempotencyKeyInProgressErr):
+		return Problem{Type: problemTypeIdempotencyInProgress, Title: "Idempotency key in progress", Status: http.StatusConflict, Detail: idempotencyKeyInProgressErr.Error()}
+	case errors.As(err, &versionMismatchErr):
+		return Problem{Type: problemTypePreconditionFailed, Title: "Precondition failed", Status: http.StatusPreconditionFailed, Detail: versionMismatchErr.Error()}
+	case errors.As(err, &preconditionFailedErr):
+		return Problem{Type: problemTypePreconditionFailed, Title: "Precondition failed", Status: http.StatusPreconditionFailed, Detail: preconditionFailedErr.Error()}
+	case errors.As(err, &preconditionRequiredErr):
+		return Problem{Type: problemTypePreconditionRequired, Title: "Precondition required", Status: http.StatusPreconditionRequired, Detail: preconditionRequiredErr.Error()}
+	case errors.As(err, &unsupportedMediaTypeErr):
+		return Problem{Type: problemTypeUnsupportedMediaType, Title: "Unsupported media type", Status: http.StatusUnsupportedMediaType, Detail: unsupportedMediaTypeErr.Error()}
+	case errors.As(err, &notAcceptableErr):
+		return Problem{Type: problemTypeNotAcceptable, Title: "Not acceptable", Status: http.StatusNotAcceptable, Detail: notAcceptableErr.Error()}
+	case errors.As(err, &contractViolationErr):
+		return Problem{Type: problemTypeContractViolation, Title: "Contract violation", Status: http.StatusBadRequest, Detail: "request does not match the OpenAPI document", Errors: newContractViolationOutputs(contractViolationErr.Violations)}
+	default:
+		// internal details are not leaked to clients
+		return Problem{Type: problemTypeInternalError, Title: "Internal error", Status: http.StatusInternalServerError}
+	}
+}
+
+func newFieldErrorOutputs(fieldErrors []validation.FieldError) []FieldErrorOutput {
+	outputs := make([]FieldErrorOutput, 0, len(fieldErrors))
+	for _, fieldErr := range fieldErrors {
+		outputs = append(outputs, FieldErrorOutput{
+			Field:  fieldErr.Field,
+			Rule:   fieldErr.Rule,
+			Param:  fieldErr.Param,
+			Detail: fieldErr.Message,
+		})
+	}
+	return outputs
+}
+
+func newContractViolationOutputs(violations []contractViolation) []FieldErrorOutput {
+	outputs := make([]FieldErrorOutput, 0, len(violations))
+	for _, violation := range violations {
+		outputs = append(outputs, FieldErrorOutput{
+			Field:  violation.Field,
+			Rule:   violation.Keyword,
+			Detail: violation.Detail,
+		})
+	}
+	return outputs
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problem.Instance = r.URL.RequestURI()
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// writeError localizes field error messages to the request Accept-Language
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	trans := validation.TranslatorFor(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", trans.Locale())
+	writeProblem(w, r, customerErrorToHttp(err, trans))
+}
+
+// problemCode names the problem type for protocols that carry error codes rather than URIs,
+// e.g. CUSTOMER_NOT_FOUND for /problems/customer-not-found
+func problemCode(problemType string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(problemType, "/problems/"), "-", "_"))
+}
+
+// Authenticate requires a verified bearer token or api key on every request and reports failures as problems
+func Authenticate(tokens auth.TokenVerifier, apiKeys domain.ApiKeyService) func(http.Handler) http.Handler {
+	return auth.Middleware(tokens, apiKeyVerifier{service: apiKeys}, writeError)
+}
+
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return auth.RequireScope(scope, writeError)
+}
@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway/auth"
+	"go-chi-gorilla-wire-workshop/app/validation"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomerErrorToHttp(t *testing.T) {
+	customerId := domain.NewCustomerId("1")
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedType   string
+		expectedStatus int
+	}{
+		{
+			name:           "Customer already exists",
+			err:            domain.CustomerAlreadyExistsError{Id: customerId},
+			expectedType:   problemTypeCustomerAlreadyExists,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Customer not found",
+			err:            domain.CustomerNotFoundError{Id: customerId},
+			expectedType:   problemTypeCustomerNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Wrapped customer not found",
+			err:            fmt.Errorf("deleting: %w", domain.CustomerNotFoundError{Id: customerId}),
+			expectedType:   problemTypeCustomerNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid cursor",
+			err:            domain.InvalidCursorError{Cursor: "abc"},
+			expectedType:   problemTypeInvalidCursor,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid customer id",
+			err:            domain.InvalidCustomerIdError{Raw: "abc", Reason: "missing prefix"},
+			expectedType:   problemTypeInvalidCustomerId,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unauthenticated",
+			err:            auth.UnauthenticatedError{Reason: "missing bearer token"},
+			expectedType:   problemTypeUnauthenticated,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Insufficient scope",
+			err:            auth.InsufficientScopeError{Scope: "customers:write"},
+			expectedType:   problemTypeInsufficientScope,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Invalid tenant id",
+			err:            domain.InvalidTenantIdError{Raw: "Acme", Reason: "unexpected character 'A'"},
+			expectedType:   problemTypeInvalidTenantId,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Tenant required",
+			err:            tenantRequiredError{},
+			expectedType:   problemTypeTenantRequired,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Tenant mismatch",
+			err:            tenantMismatchError{Requested: "globex"},
+			expectedType:   problemTypeTenantMismatch,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Invalid idempotency key",
+			err:            domain.InvalidIdempotencyKeyError{Key: "", Reason: "wrong length"},
+			expectedType:   problemTypeInvalidIdempotencyKey,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Idempotency key reused",
+			err:            domain.IdempotencyKeyReusedError{Key: "key-1"},
+			expectedType:   problemTypeIdempotencyKeyReused,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Idempotency key in progress",
+			err:            domain.IdempotencyKeyInProgressError{Key: "key-1"},
+			expectedType:   problemTypeIdempotencyInProgress,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Customer version mismatch",
+			err:            domain.CustomerVersionMismatchError{Id: customerId, Expected: 1, Actual: 2},
+			expectedType:   problemTypePreconditionFailed,
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "Unmatchable If-Match",
+			err:            preconditionFailedError{IfMatch: `W/"1"`},
+			expectedType:   problemTypePreconditionFailed,
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "Precondition required",
+			err:            preconditionRequiredError{Precondition: "the If-Match header"},
+			expectedType:   problemTypePreconditionRequired,
+			expectedStatus: http.StatusPreconditionRequired,
+		},
+		{
+			name:           "Unsupported media type",
+			err:            unsupportedMediaTypeError{ContentType: "text/csv"},
+			expectedType:   problemTypeUnsupportedMediaType,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "Not acceptable",
+			err:            notAcceptableError{Accept: "text/csv"},
+			expectedType:   problemTypeNotAcceptable,
+			expectedStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:           "Contract violation",
+			err:            contractViolationError{Violations: []contractViolation{{Field: "query.limit", Keyword: "type", Detail: "expected integer, got string"}}},
+			expectedType:   problemTypeContractViolation,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid input",
+			err:            validation.Validate(CreateCustomerApiInput{}),
+			expectedType:   problemTypeValidationFailed,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Malformed request",
+			err:            malformedRequestError{Err: errors.New("unexpected EOF")},
+			expectedType:   problemTypeMalformedRequest,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unexpected error",
+			err:            errors.New("disk full"),
+			expectedType:   problemTypeInternalError,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			problem := customerErrorToHttp(tc.err, validation.DefaultTranslator())
+
+			assert.Equal(t, tc.expectedType, problem.Type)
+			assert.Equal(t, tc.expectedStatus, problem.Status)
+			assert.NotEmpty(t, problem.Title)
+		})
+	}
+}
+
+func TestCustomerErrorToHttp_FieldErrors(t *testing.T) {
+	// given
+	err := validation.Validate(CreateCustomerApiInput{Name: "", Age: 201})
+
+	// when
+	problem := customerErrorToHttp(err, validation.DefaultTranslator())
+
+	// then
+	assert.Equal(t, []FieldErrorOutput{
+		{Field: "name", Rule: "min", Param: "1", Detail: "name must be at least 1 character in length"},
+		{Field: "age", Rule: "max", Param: "200", Detail: "age must be 200 or less"},
+	}, problem.Errors)
+}
+
+func TestCustomerErrorToHttp_TranslatedFieldErrors(t *testing.T) {
+	// given
+	err := validation.Validate(CreateCustomerApiInput{Name: "John Doe", Age: 201})
+
+	// when
+	problem := customerErrorToHttp(err, validation.TranslatorFor("pl-PL,pl;q=0.9,en;q=0.5"))
+
+	// then
+	assert.Equal(t, []FieldErrorOutput{
+		{Field: "age", Rule: "max", Param: "200", Detail: "age musi być równe 200 lub mniej"},
+	}, problem.Errors)
+}
+
+func TestCustomerErrorToHttp_HidesInternalDetails(t *testing.T) {
+	// when
+	problem := customerErrorToHttp(errors.New("connection refused to 10.0.0.1"), validation.DefaultTranslator())
+
+	// then
+	assert.Empty(t, problem.Detail)
+}
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway/auth"
+	"net/http"
+)
+
+const tenantHeader = "X-Tenant-ID"
+
+type tenantRequiredError struct{}
+
+func (e tenantRequiredError) Error() string {
+	return fmt.Sprintf("the %s header is required", tenantHeader)
+}
+
+type tenantMismatchError struct {
+	Requested string
+}
+
+func (e tenantMismatchError) Error() string {
+	return fmt.Sprintf("tenant %q is not accessible to the caller", e.Requested)
+}
+
+// resolveTenant takes the tenant of the principal; the X-Tenant-ID header may repeat it, but only principals
+// not bound to a tenant may use it to choose one
+func resolveTenant(r *http.Request) (domain.TenantId, error) {
+	principal, _ := auth.PrincipalFrom(r.Context())
+	return tenantOf(principal, r.Header.Get(tenantHeader))
+}
+
+// tenantOf picks the tenant of the principal, which a requested tenant must match, or else the requested one
+func tenantOf(principal auth.Principal, requested string) (domain.TenantId, error) {
+	if principal.Tenant != "" {
+		if requested != "" && requested != principal.Tenant {
+			return domain.TenantId{}, tenantMismatchError{Requested: requested}
+		}
+		return domain.ParseTenantId(principal.Tenant)
+	}
+	if requested == "" {
+		return domain.TenantId{}, tenantRequiredError{}
+	}
+	return domain.ParseTenantId(requested)
+}
+
+// authorizeTenant is the check of routes that are not behind requireScope: the principal must hold the scope,
+// and the tenant is resolved as resolveTenant does
+func authorizeTenant(ctx context.Context, scope string, requested string) (domain.TenantId, error) {
+	principal, found := auth.PrincipalFrom(ctx)
+	if !found {
+		return domain.TenantId{}, auth.UnauthenticatedError{Reason: "missing bearer token or api key"}
+	}
+	if !principal.HasScope(scope) {
+		return domain.TenantId{}, auth.InsufficientScopeError{Scope: scope}
+	}
+	return tenantOf(principal, requested)
+}
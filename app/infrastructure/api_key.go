@@ -0,0 +1,79 @@
+package infrastructure
+
+import (
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApiKeyInMemoryRepository stores *domain.ApiKey, as keys hold slices and CompareAndSwap needs comparable values;
+// stored keys are never mutated, changes swap in a copy
+type ApiKeyInMemoryRepository struct {
+	Data sync.Map
+}
+
+func NewApiKeyInMemoryRepository() domain.ApiKeyRepository {
+	return &ApiKeyInMemoryRepository{}
+}
+
+func (repo *ApiKeyInMemoryRepository) CreateApiKey(key domain.ApiKey) error {
+	key.Scopes = slices.Clone(key.Scopes)
+	if _, loaded := repo.Data.LoadOrStore(key.Prefix, &key); loaded {
+		return domain.ApiKeyAlreadyExistsError{Prefix: key.Prefix}
+	}
+	return nil
+}
+
+func (repo *ApiKeyInMemoryRepository) GetApiKey(prefix string) (domain.ApiKey, bool) {
+	value, ok := repo.Data.Load(prefix)
+	if !ok {
+		return domain.ApiKey{}, false
+	}
+	return *value.(*domain.ApiKey), true
+}
+
+func (repo *ApiKeyInMemoryRepository) ListApiKeys() []domain.ApiKey {
+	keys := []domain.ApiKey{}
+	repo.Data.Range(func(_, value any) bool {
+		keys = append(keys, *value.(*domain.ApiKey))
+		return true
+	})
+	slices.SortFunc(keys, func(a, b domain.ApiKey) int {
+		if byCreation := a.CreatedAt.Compare(b.CreatedAt); byCreation != 0 {
+			return byCreation
+		}
+		return strings.Compare(a.Prefix, b.Prefix)
+	})
+	return keys
+}
+
+func (repo *ApiKeyInMemoryRepository) TouchApiKey(prefix string, usedAt time.Time) bool {
+	return repo.modify(prefix, func(key *domain.ApiKey) {
+		key.LastUsedAt = &usedAt
+	})
+}
+
+func (repo *ApiKeyInMemoryRepository) RevokeApiKey(prefix string, revokedAt time.Time) bool {
+	return repo.modify(prefix, func(key *domain.ApiKey) {
+		if key.RevokedAt == nil {
+			key.RevokedAt = &revokedAt
+		}
+	})
+}
+
+// modify applies the change with CompareAndSwap, so concurrent changes of different fields are all kept
+func (repo *ApiKeyInMemoryRepository) modify(prefix string, change func(key *domain.ApiKey)) bool {
+	for {
+		current, ok := repo.Data.Load(prefix)
+		if !ok {
+			return false
+		}
+		key := *current.(*domain.ApiKey)
+		change(&key)
+		if repo.Data.CompareAndSwap(prefix, current, &key) {
+			return true
+		}
+	}
+}
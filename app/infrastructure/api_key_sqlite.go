@@ -0,0 +1,150 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"strings"
+	"time"
+)
+
+// times are stored as unix nanoseconds, scopes as a space-separated list
+const apiKeySchema = `
+CREATE TABLE IF NOT EXISTS api_keys (
+	prefix       TEXT PRIMARY KEY,
+	tenant_id    TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	scopes       TEXT NOT NULL,
+	hash         BLOB NOT NULL,
+	created_at   INTEGER NOT NULL,
+	last_used_at INTEGER,
+	expires_at   INTEGER,
+	revoked_at   INTEGER
+)`
+
+const apiKeyColumns = "prefix, tenant_id, name, scopes, hash, created_at, last_used_at, expires_at, revoked_at"
+
+// ApiKeySqliteRepository panics on unexpected database errors in the methods that cannot return them;
+// the Recoverer middleware turns those into 500 responses, and GrpcRecover into Internal statuses
+type ApiKeySqliteRepository struct {
+	db *sql.DB
+}
+
+func NewApiKeySqliteRepository(db *sql.DB) (domain.ApiKeyRepository, error) {
+	if _, err := db.Exec(apiKeySchema); err != nil {
+		return nil, fmt.Errorf("creating api key schema: %w", err)
+	}
+	if err := migrateApiKeyTenants(db); err != nil {
+		return nil, fmt.Errorf("migrating api keys to tenants: %w", err)
+	}
+	return &ApiKeySqliteRepository{db: db}, nil
+}
+
+// migrateApiKeyTenants binds the keys created before they were bound to a tenant to domain.DefaultTenant,
+// the tenant their customers were moved to
+func migrateApiKeyTenants(db *sql.DB) error {
+	columns, err := tableColumns(db, "api_keys")
+	if err != nil || columns["tenant_id"] {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '%s'", domain.DefaultTenant.Raw))
+	return err
+}
+
+func (repo *ApiKeySqliteRepository) CreateApiKey(key domain.ApiKey) error {
+	result, err := repo.db.Exec(
+		"INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (prefix) DO NOTHING",
+		key.Prefix, key.Tenant.Raw, key.Name, strings.Join(key.Scopes, " "), key.Hash, key.CreatedAt.UnixNano(),
+		nullableTime(key.LastUsedAt), nullableTime(key.ExpiresAt), nullableTime(key.RevokedAt),
+	)
+	if err != nil {
+		return err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return domain.ApiKeyAlreadyExistsError{Prefix: key.Prefix}
+	}
+	return nil
+}
+
+func (repo *ApiKeySqliteRepository) GetApiKey(prefix string) (domain.ApiKey, bool) {
+	row := repo.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = ?", prefix)
+	key, err := scanApiKey(row)
+	if err == sql.ErrNoRows {
+		return domain.ApiKey{}, false
+	}
+	if err != nil {
+		panic(fmt.Errorf("getting api key %s: %w", prefix, err))
+	}
+	return key, true
+}
+
+func (repo *ApiKeySqliteRepository) ListApiKeys() []domain.ApiKey {
+	rows, err := repo.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY created_at, prefix")
+	if err != nil {
+		panic(fmt.Errorf("listing api keys: %w", err))
+	}
+	defer rows.Close()
+	keys := []domain.ApiKey{}
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			panic(fmt.Errorf("listing api keys: %w", err))
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		panic(fmt.Errorf("listing api keys: %w", err))
+	}
+	return keys
+}
+
+func (repo *ApiKeySqliteRepository) TouchApiKey(prefix string, usedAt time.Time) bool {
+	return repo.exec("touching api key "+prefix, "UPDATE api_keys SET last_used_at = ? WHERE prefix = ?", usedAt.UnixNano(), prefix)
+}
+
+func (repo *ApiKeySqliteRepository) RevokeApiKey(prefix string, revokedAt time.Time) bool {
+	return repo.exec("revoking api key "+prefix, "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE prefix = ?", revokedAt.UnixNano(), prefix)
+}
+
+func (repo *ApiKeySqliteRepository) exec(operation string, statement string, args ...any) bool {
+	result, err := repo.db.Exec(statement, args...)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", operation, err))
+	}
+	updated, _ := result.RowsAffected()
+	return updated > 0
+}
+
+func scanApiKey(row interface{ Scan(dest ...any) error }) (domain.ApiKey, error) {
+	var key domain.ApiKey
+	var tenant string
+	var scopes string
+	var createdAt int64
+	var lastUsedAt, expiresAt, revokedAt sql.NullInt64
+	err := row.Scan(&key.Prefix, &tenant, &key.Name, &scopes, &key.Hash, &createdAt, &lastUsedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return domain.ApiKey{}, err
+	}
+	key.Tenant = domain.TenantId{Raw: tenant}
+	key.Scopes = strings.Fields(scopes)
+	key.CreatedAt = time.Unix(0, createdAt).UTC()
+	key.LastUsedAt = timeOf(lastUsedAt)
+	key.ExpiresAt = timeOf(expiresAt)
+	key.RevokedAt = timeOf(revokedAt)
+	return key, nil
+}
+
+func nullableTime(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func timeOf(value sql.NullInt64) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t := time.Unix(0, value.Int64).UTC()
+	return &t
+}
@@ -0,0 +1,48 @@
+package infrastructure
+
+import (
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/domain/repositorytest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiKeyInMemoryRepository(t *testing.T) {
+	repositorytest.RunApiKey(t, func(t *testing.T) domain.ApiKeyRepository {
+		return NewApiKeyInMemoryRepository()
+	})
+}
+
+func TestApiKeySqliteRepository(t *testing.T) {
+	repositorytest.RunApiKey(t, func(t *testing.T) domain.ApiKeyRepository {
+		db, cleanup, err := NewSqliteDB(":memory:")
+		require.NoError(t, err)
+		t.Cleanup(cleanup)
+		repository, err := NewApiKeySqliteRepository(db)
+		require.NoError(t, err)
+		return repository
+	})
+}
+
+func TestApiKeySqliteRepository_MigrateApiKeysWithoutTenants(t *testing.T) {
+	// given
+	db, cleanup, err := NewSqliteDB(":memory:")
+	require.NoError(t, err)
+	defer cleanup()
+	_, err = db.Exec(`CREATE TABLE api_keys (prefix TEXT PRIMARY KEY, name TEXT NOT NULL, scopes TEXT NOT NULL, hash BLOB NOT NULL,
+		created_at INTEGER NOT NULL, last_used_at INTEGER, expires_at INTEGER, revoked_at INTEGER)`)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO api_keys (prefix, name, scopes, hash, created_at) VALUES ('aaaaaaaaaaaaaaaa', 'billing', 'customers:read', zeroblob(32), 0)")
+	require.NoError(t, err)
+
+	// when
+	repository, err := NewApiKeySqliteRepository(db)
+
+	// then
+	require.NoError(t, err)
+	key, found := repository.GetApiKey("aaaaaaaaaaaaaaaa")
+	assert.True(t, found)
+	assert.Equal(t, domain.DefaultTenant, key.Tenant, "Existing keys should be bound to the default tenant")
+}
@@ -2,13 +2,24 @@ package infrastructure
 
 import (
 	"go-chi-gorilla-wire-workshop/app/domain"
+	"slices"
 	"sync"
 )
 
+// CustomerInMemoryRepository keys customers by customerKey, so lookups never cross tenants
 type CustomerInMemoryRepository struct {
 	Data sync.Map
 }
 
+type customerKey struct {
+	Tenant domain.TenantId
+	Id     domain.CustomerId
+}
+
+func keyOf(customer domain.Customer) customerKey {
+	return customerKey{Tenant: customer.Tenant, Id: customer.Id}
+}
+
 func NewCustomerInMemoryRepository() domain.CustomerRepository {
 	return &CustomerInMemoryRepository{}
 }
@@ -16,16 +27,87 @@ func NewCustomerInMemoryRepository() domain.CustomerRepository {
 func (repo *CustomerInMemoryRepository) CreateCustomer(customer domain.Customer) (domain.CustomerId, error) {
 	id := customer.Id
 	// Use LoadOrStore to check and add atomically
-	_, loaded := repo.Data.LoadOrStore(id, customer)
+	_, loaded := repo.Data.LoadOrStore(keyOf(customer), customer)
 	if loaded {
 		return domain.CustomerId{}, domain.CustomerAlreadyExistsError{Id: id}
 	}
 	return id, nil
 }
-func (repo *CustomerInMemoryRepository) GetCustomer(id domain.CustomerId) (domain.Customer, bool) {
-	value, ok := repo.Data.Load(id)
+
+func (repo *CustomerInMemoryRepository) GetCustomer(tenant domain.TenantId, id domain.CustomerId) (domain.Customer, bool, error) {
+	customer, found := repo.get(tenant, id)
+	return customer, found, nil
+}
+
+// get is GetCustomer without the error, which the in-memory repository never returns
+func (repo *CustomerInMemoryRepository) get(tenant domain.TenantId, id domain.CustomerId) (domain.Customer, bool) {
+	value, ok := repo.Data.Load(customerKey{Tenant: tenant, Id: id})
 	if !ok {
 		return domain.Customer{}, false
 	}
 	return value.(domain.Customer), true
 }
+
+func (repo *CustomerInMemoryRepository) ListCustomers(tenant domain.TenantId, query domain.CustomerQuery, after domain.CustomerCursor, limit int) ([]domain.Customer, error) {
+	customers := []domain.Customer{}
+	repo.Data.Range(func(key, value any) bool {
+		customer := value.(domain.Customer)
+		if customer.Tenant == tenant && query.Filter.Matches(customer) && after.Precedes(query, customer) {
+			customers = append(customers, customer)
+		}
+		return true
+	})
+	slices.SortFunc(customers, query.Compare)
+	if len(customers) > limit {
+		customers = customers[:limit]
+	}
+	return customers, nil
+}
+
+func (repo *CustomerInMemoryRepository) UpdateCustomer(customer domain.Customer, expectedVersion int64) error {
+	key := keyOf(customer)
+	current, ok := repo.Data.Load(key)
+	if !ok {
+		return domain.CustomerNotFoundError{Id: customer.Id}
+	}
+	if err := checkVersion(current.(domain.Customer), expectedVersion); err != nil {
+		return err
+	}
+	// CompareAndSwap fails if the customer changed or was deleted since it was loaded, which can only have
+	// moved it past the expected version
+	if !repo.Data.CompareAndSwap(key, current, customer) {
+		return repo.versionConflict(key, expectedVersion)
+	}
+	return nil
+}
+
+func (repo *CustomerInMemoryRepository) DeleteCustomer(tenant domain.TenantId, id domain.CustomerId, expectedVersion int64) error {
+	key := customerKey{Tenant: tenant, Id: id}
+	current, ok := repo.Data.Load(key)
+	if !ok {
+		return domain.CustomerNotFoundError{Id: id}
+	}
+	if err := checkVersion(current.(domain.Customer), expectedVersion); err != nil {
+		return err
+	}
+	if !repo.Data.CompareAndDelete(key, current) {
+		return repo.versionConflict(key, expectedVersion)
+	}
+	return nil
+}
+
+// versionConflict reports the state that made a compare-and-swap fail
+func (repo *CustomerInMemoryRepository) versionConflict(key customerKey, expectedVersion int64) error {
+	current, ok := repo.Data.Load(key)
+	if !ok {
+		return domain.CustomerNotFoundError{Id: key.Id}
+	}
+	return domain.CustomerVersionMismatchError{Id: key.Id, Expected: expectedVersion, Actual: current.(domain.Customer).Version}
+}
+
+func checkVersion(customer domain.Customer, expectedVersion int64) error {
+	if customer.Version != expectedVersion {
+		return domain.CustomerVersionMismatchError{Id: customer.Id, Expected: expectedVersion, Actual: customer.Version}
+	}
+	return nil
+}
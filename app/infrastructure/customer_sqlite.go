@@ -0,0 +1,334 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type SqliteDataSourceName string
+
+const customerSchema = `
+CREATE TABLE IF NOT EXISTS customers (
+	tenant_id TEXT NOT NULL,
+	id        TEXT NOT NULL,
+	name      TEXT NOT NULL,
+	age       INTEGER NOT NULL,
+	version   INTEGER NOT NULL DEFAULT 1,
+	-- times are unix nanoseconds; the defaults only serve rows copied by migrations
+	created_at INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (tenant_id, id)
+)`
+
+var customerSortColumns = map[domain.CustomerSortField]string{
+	domain.CustomerSortById:   "id",
+	domain.CustomerSortByName: "name",
+	domain.CustomerSortByAge:  "age",
+}
+
+func NewSqliteDB(dataSourceName SqliteDataSourceName) (*sql.DB, func(), error) {
+	db, err := sql.Open("sqlite", string(dataSourceName))
+	if err != nil {
+		return nil, nil, err
+	}
+	// sqlite allows a single writer; one connection also keeps ":memory:" databases shared
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return db, func() { db.Close() }, nil
+}
+
+// CustomerSqliteRepository returns unexpected database errors wrapped with the operation that failed; the
+// gateways answer them as internal errors
+type CustomerSqliteRepository struct {
+	db *sql.DB
+}
+
+func NewCustomerSqliteRepository(db *sql.DB) (domain.CustomerRepository, error) {
+	if err := migrateCustomerTenants(db); err != nil {
+		return nil, fmt.Errorf("moving customers to tenants: %w", err)
+	}
+	if _, err := db.Exec(customerSchema); err != nil {
+		return nil, fmt.Errorf("creating customer schema: %w", err)
+	}
+	if err := migrateCustomerVersions(db); err != nil {
+		return nil, fmt.Errorf("adding customer versions: %w", err)
+	}
+	if err := migrateCustomerTimes(db, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("adding customer times: %w", err)
+	}
+	return &CustomerSqliteRepository{db: db}, nil
+}
+
+// migrateCustomerVersions adds the version column to a customers table from before versions, putting its
+// customers at version 1
+func migrateCustomerVersions(db *sql.DB) error {
+	columns, err := tableColumns(db, "customers")
+	if err != nil || columns["version"] {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE customers ADD COLUMN version INTEGER NOT NULL DEFAULT 1")
+	return err
+}
+
+// migrateCustomerTenants rebuilds a customers table from before tenants, keyed by id alone, assigning its
+// customers to domain.DefaultTenant
+func migrateCustomerTenants(db *sql.DB) error {
+	columns, err := tableColumns(db, "customers")
+	if err != nil || len(columns) == 0 || columns["tenant_id"] {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	statements := []struct {
+		statement string
+		args      []any
+	}{
+		{statement: "ALTER TABLE customers RENAME TO customers_without_tenants"},
+		{statement: customerSchema},
+		{statement: "INSERT INTO customers (tenant_id, id, name, age) SELECT ?, id, name, age FROM customers_without_tenants", args: []any{domain.DefaultTenant.Raw}},
+		{statement: "DROP TABLE customers_without_tenants"},
+	}
+	for _, step := range statements {
+		if _, err := tx.Exec(step.statement, step.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateCustomerTimes adds the time columns to a customers table from before they were tracked; customers
+// without times are stamped with now, as no better time is known
+func migrateCustomerTimes(db *sql.DB, now time.Time) error {
+	columns, err := tableColumns(db, "customers")
+	if err != nil {
+		return err
+	}
+	for _, column := range []string{"created_at", "updated_at"} {
+		if !columns[column] {
+			if _, err := db.Exec("ALTER TABLE customers ADD COLUMN " + column + " INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = db.Exec(
+		"UPDATE customers SET created_at = ?, updated_at = ? WHERE created_at = 0",
+		now.UnixNano(), now.UnixNano(),
+	)
+	return err
+}
+
+// tableColumns returns the column names of the table, none if it does not exist
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+func (repo *CustomerSqliteRepository) CreateCustomer(customer domain.Customer) (domain.CustomerId, error) {
+	id := customer.Id
+	result, err := repo.db.Exec(
+		"INSERT INTO customers (tenant_id, id, name, age, version, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (tenant_id, id) DO NOTHING",
+		customer.Tenant.Raw, id.Raw, customer.Name, customer.Age, customer.Version, customer.CreatedAt.UnixNano(), customer.UpdatedAt.UnixNano(),
+	)
+	if err != nil {
+		return domain.CustomerId{}, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return domain.CustomerId{}, domain.CustomerAlreadyExistsError{Id: id}
+	}
+	return id, nil
+}
+
+func (repo *CustomerSqliteRepository) GetCustomer(tenant domain.TenantId, id domain.CustomerId) (domain.Customer, bool, error) {
+	customer := domain.Customer{Tenant: tenant, Id: id}
+	var createdAt, updatedAt int64
+	err := repo.db.QueryRow(
+		"SELECT name, age, version, created_at, updated_at FROM customers WHERE tenant_id = ? AND id = ?",
+		tenant.Raw, id.Raw,
+	).Scan(&customer.Name, &customer.Age, &customer.Version, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		return domain.Customer{}, false, nil
+	}
+	if err != nil {
+		return domain.Customer{}, false, fmt.Errorf("getting customer %s: %w", id.Raw, err)
+	}
+	customer.CreatedAt, customer.UpdatedAt = unixNanoTime(createdAt), unixNanoTime(updatedAt)
+	return customer, true, nil
+}
+
+func (repo *CustomerSqliteRepository) ListCustomers(tenant domain.TenantId, query domain.CustomerQuery, after domain.CustomerCursor, limit int) ([]domain.Customer, error) {
+	conditions, args := customerFilterConditions(query.Filter)
+	conditions = append([]string{"tenant_id = ?"}, conditions...)
+	args = append([]any{tenant.Raw}, args...)
+	if !after.IsZero() {
+		condition, cursorArgs := customerCursorCondition(query, after)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	statement := "SELECT id, name, age, version, created_at, updated_at FROM customers WHERE " + strings.Join(conditions, " AND ")
+	statement += " ORDER BY " + customerOrderBy(query) + " LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := repo.db.Query(statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing customers: %w", err)
+	}
+	defer rows.Close()
+	customers := []domain.Customer{}
+	for rows.Next() {
+		customer := domain.Customer{Tenant: tenant}
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&customer.Id.Raw, &customer.Name, &customer.Age, &customer.Version, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("listing customers: %w", err)
+		}
+		customer.CreatedAt, customer.UpdatedAt = unixNanoTime(createdAt), unixNanoTime(updatedAt)
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing customers: %w", err)
+	}
+	return customers, nil
+}
+
+// UpdateCustomer checks the version in the WHERE clause, so the check and the update are a single statement
+func (repo *CustomerSqliteRepository) UpdateCustomer(customer domain.Customer, expectedVersion int64) error {
+	result, err := repo.db.Exec(
+		"UPDATE customers SET name = ?, age = ?, version = ?, created_at = ?, updated_at = ? WHERE tenant_id = ? AND id = ? AND version = ?",
+		customer.Name, customer.Age, customer.Version, customer.CreatedAt.UnixNano(), customer.UpdatedAt.UnixNano(), customer.Tenant.Raw, customer.Id.Raw, expectedVersion,
+	)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return repo.versionConflict(customer.Tenant, customer.Id, expectedVersion)
+	}
+	return nil
+}
+
+func (repo *CustomerSqliteRepository) DeleteCustomer(tenant domain.TenantId, id domain.CustomerId, expectedVersion int64) error {
+	result, err := repo.db.Exec(
+		"DELETE FROM customers WHERE tenant_id = ? AND id = ? AND version = ?",
+		tenant.Raw, id.Raw, expectedVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("deleting customer %s: %w", id.Raw, err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return repo.versionConflict(tenant, id, expectedVersion)
+	}
+	return nil
+}
+
+// versionConflict tells why a mutation guarded by the version changed no row
+func (repo *CustomerSqliteRepository) versionConflict(tenant domain.TenantId, id domain.CustomerId, expectedVersion int64) error {
+	current, found, err := repo.GetCustomer(tenant, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return domain.CustomerNotFoundError{Id: id}
+	}
+	return domain.CustomerVersionMismatchError{Id: id, Expected: expectedVersion, Actual: current.Version}
+}
+
+func unixNanoTime(nanos int64) time.Time {
+	return time.Unix(0, nanos).UTC()
+}
+
+func customerFilterConditions(filter domain.CustomerFilter) ([]string, []any) {
+	var conditions []string
+	var args []any
+	if filter.Name != nil {
+		conditions = append(conditions, "name = ?")
+		args = append(args, *filter.Name)
+	}
+	if filter.NamePrefix != nil {
+		// LIKE would be case-insensitive and treat % and _ as wildcards
+		conditions = append(conditions, "substr(name, 1, length(?)) = ?")
+		args = append(args, *filter.NamePrefix, *filter.NamePrefix)
+	}
+	ageConditions := []struct {
+		value    *int
+		operator string
+	}{
+		{filter.Age, "="},
+		{filter.AgeGt, ">"},
+		{filter.AgeGte, ">="},
+		{filter.AgeLt, "<"},
+		{filter.AgeLte, "<="},
+	}
+	for _, condition := range ageConditions {
+		if condition.value != nil {
+			conditions = append(conditions, "age "+condition.operator+" ?")
+			args = append(args, *condition.value)
+		}
+	}
+	return conditions, args
+}
+
+// customerSortKeys mirrors domain.CustomerQuery.Compare: the query sort fields followed by ascending id
+func customerSortKeys(query domain.CustomerQuery) []domain.CustomerSort {
+	return append(append([]domain.CustomerSort{}, query.Sort...), domain.CustomerSort{Field: domain.CustomerSortById})
+}
+
+func customerOrderBy(query domain.CustomerQuery) string {
+	var columns []string
+	for _, key := range customerSortKeys(query) {
+		column := customerSortColumns[key.Field]
+		if key.Descending {
+			column += " DESC"
+		}
+		columns = append(columns, column)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// customerCursorCondition expands the keyset comparison into (k1 > c1) OR (k1 = c1 AND k2 > c2) OR ...,
+// as row values cannot express mixed sort directions
+func customerCursorCondition(query domain.CustomerQuery, after domain.CustomerCursor) (string, []any) {
+	cursorValues := map[domain.CustomerSortField]any{
+		domain.CustomerSortById:   after.After.Id.Raw,
+		domain.CustomerSortByName: after.After.Name,
+		domain.CustomerSortByAge:  after.After.Age,
+	}
+	var alternatives []string
+	var args []any
+	var equalities []string
+	var equalityArgs []any
+	for _, key := range customerSortKeys(query) {
+		column := customerSortColumns[key.Field]
+		operator := ">"
+		if key.Descending {
+			operator = "<"
+		}
+		parts := append(append([]string{}, equalities...), column+" "+operator+" ?")
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+		args = append(append(args, equalityArgs...), cursorValues[key.Field])
+
+		equalities = append(equalities, column+" = ?")
+		equalityArgs = append(equalityArgs, cursorValues[key.Field])
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
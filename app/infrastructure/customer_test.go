@@ -0,0 +1,124 @@
+package infrastructure
+
+import (
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/domain/repositorytest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var acme = domain.TenantId{Raw: "acme"}
+
+func TestCustomerInMemoryRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) domain.CustomerRepository {
+		return NewCustomerInMemoryRepository()
+	})
+}
+
+func TestCustomerSqliteRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) domain.CustomerRepository {
+		db, cleanup, err := NewSqliteDB(":memory:")
+		require.NoError(t, err)
+		t.Cleanup(cleanup)
+		repository, err := NewCustomerSqliteRepository(db)
+		require.NoError(t, err)
+		return repository
+	})
+}
+
+func TestCustomerSqliteRepository_MigrateCustomersWithoutTenants(t *testing.T) {
+	// given
+	db, cleanup, err := NewSqliteDB(":memory:")
+	require.NoError(t, err)
+	defer cleanup()
+	_, err = db.Exec("CREATE TABLE customers (id TEXT PRIMARY KEY, name TEXT NOT NULL, age INTEGER NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO customers (id, name, age) VALUES ('1', 'John Doe', 30)")
+	require.NoError(t, err)
+
+	// when
+	repository, err := NewCustomerSqliteRepository(db)
+
+	// then
+	require.NoError(t, err)
+	customer, found, _ := repository.GetCustomer(domain.DefaultTenant, domain.CustomerId{Raw: "1"})
+	assert.True(t, found, "Existing customers should move to the default tenant")
+	assert.Equal(t, domain.Customer{Tenant: domain.DefaultTenant, Id: domain.CustomerId{Raw: "1"}, Name: "John Doe", Age: 30, Version: 1, CreatedAt: customer.CreatedAt, UpdatedAt: customer.UpdatedAt}, customer)
+
+	// and
+	_, err = repository.CreateCustomer(domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "1"}, Name: "Jane Doe", Age: 31, Version: 1})
+	assert.NoError(t, err, "Ids should only be unique within a tenant")
+}
+
+func TestCustomerSqliteRepository_MigrateCustomersWithoutVersions(t *testing.T) {
+	// given
+	db, cleanup, err := NewSqliteDB(":memory:")
+	require.NoError(t, err)
+	defer cleanup()
+	_, err = db.Exec("CREATE TABLE customers (tenant_id TEXT NOT NULL, id TEXT NOT NULL, name TEXT NOT NULL, age INTEGER NOT NULL, PRIMARY KEY (tenant_id, id))")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO customers (tenant_id, id, name, age) VALUES ('acme', '1', 'John Doe', 30)")
+	require.NoError(t, err)
+
+	// when
+	repository, err := NewCustomerSqliteRepository(db)
+
+	// then
+	require.NoError(t, err)
+	customer, _, _ := repository.GetCustomer(acme, domain.CustomerId{Raw: "1"})
+	assert.Equal(t, int64(1), customer.Version, "Existing customers should start at version 1")
+}
+
+func TestCustomerSqliteRepository_MigrateCustomersWithoutTimes(t *testing.T) {
+	// given
+	db, cleanup, err := NewSqliteDB(":memory:")
+	require.NoError(t, err)
+	defer cleanup()
+	_, err = db.Exec("CREATE TABLE customers (tenant_id TEXT NOT NULL, id TEXT NOT NULL, name TEXT NOT NULL, age INTEGER NOT NULL, version INTEGER NOT NULL DEFAULT 1, PRIMARY KEY (tenant_id, id))")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO customers (tenant_id, id, name, age) VALUES ('acme', '1', 'John Doe', 30)")
+	require.NoError(t, err)
+
+	// and
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// when
+	err = migrateCustomerTimes(db, now)
+
+	// then
+	require.NoError(t, err)
+	customer, _, _ := (&CustomerSqliteRepository{db: db}).GetCustomer(acme, domain.CustomerId{Raw: "1"})
+	assert.Equal(t, now, customer.CreatedAt, "Existing customers should be stamped with the migration time")
+	assert.Equal(t, now, customer.UpdatedAt)
+}
+
+func TestCustomerWalRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) domain.CustomerRepository {
+		repository, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: t.TempDir()})
+		require.NoError(t, err)
+		t.Cleanup(cleanup)
+		return repository
+	})
+}
+
+func TestCustomerSqliteRepository_DatabaseErrors(t *testing.T) {
+	// given
+	db, _, err := NewSqliteDB(":memory:")
+	require.NoError(t, err)
+	repository, err := NewCustomerSqliteRepository(db)
+	require.NoError(t, err)
+	db.Close()
+
+	// when
+	_, found, getErr := repository.GetCustomer(acme, domain.CustomerId{Raw: "1"})
+	customers, listErr := repository.ListCustomers(acme, domain.CustomerQuery{}, domain.CustomerCursor{}, 10)
+
+	// then
+	assert.Error(t, getErr, "Database errors should be returned rather than panicked")
+	assert.False(t, found)
+	assert.Error(t, listErr)
+	assert.Empty(t, customers)
+}
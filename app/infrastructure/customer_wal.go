@@ -0,0 +1,352 @@
+package infrastructure
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	walLogFile      = "customers.log"
+	walSnapshotFile = "customers.snapshot"
+)
+
+type walOperation string
+
+const (
+	walCreate walOperation = "create"
+	walUpdate walOperation = "update"
+	walDelete walOperation = "delete"
+)
+
+type CustomerWalOptions struct {
+	Dir                string
+	CompactionInterval time.Duration
+}
+
+// customerRecord without a tenant was written before tenants were introduced and belongs to domain.DefaultTenant;
+// one without a version predates versions and is at version 1, and one without times leaves them zero
+type customerRecord struct {
+	Tenant    string    `json:"tenant,omitempty"`
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Age       int       `json:"age"`
+	Version   int64     `json:"version,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type walEntry struct {
+	Op       walOperation   `json:"op"`
+	Customer customerRecord `json:"customer"`
+}
+
+func newCustomerRecord(customer domain.Customer) customerRecord {
+	return customerRecord{
+		Tenant:    customer.Tenant.Raw,
+		Id:        customer.Id.Raw,
+		Name:      customer.Name,
+		Age:       customer.Age,
+		Version:   customer.Version,
+		CreatedAt: customer.CreatedAt,
+		UpdatedAt: customer.UpdatedAt,
+	}
+}
+
+func (record customerRecord) toCustomer() domain.Customer {
+	tenant := domain.TenantId{Raw: record.Tenant}
+	if tenant.IsZero() {
+		tenant = domain.DefaultTenant
+	}
+	version := record.Version
+	if version == 0 {
+		version = 1
+	}
+	return domain.Customer{
+		Tenant:    tenant,
+		Id:        domain.CustomerId{Raw: record.Id},
+		Name:      record.Name,
+		Age:       record.Age,
+		Version:   version,
+		CreatedAt: record.CreatedAt.UTC(),
+		UpdatedAt: record.UpdatedAt.UTC(),
+	}
+}
+
+// CustomerWalRepository keeps customers in memory and appends every mutation to a log file before applying it;
+// at startup the latest snapshot and the log are replayed, and the log is periodically compacted into a new snapshot
+type CustomerWalRepository struct {
+	memory CustomerInMemoryRepository
+	dir    string
+	// mu serializes mutations, so the log order is the order in which they are applied
+	mu  sync.Mutex
+	log walFile
+	// logSize is the length of the acknowledged entries, which a failed append truncates the log back to
+	logSize int64
+}
+
+// walFile is the part of *os.File the log is written through
+type walFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+func NewCustomerWalRepository(options CustomerWalOptions) (domain.CustomerRepository, func(), error) {
+	repo := &CustomerWalRepository{dir: options.Dir}
+	if err := os.MkdirAll(options.Dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+	if err := repo.replaySnapshot(); err != nil {
+		return nil, nil, err
+	}
+	if err := repo.replayLog(); err != nil {
+		return nil, nil, err
+	}
+	log, err := os.OpenFile(repo.path(walLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := log.Stat()
+	if err != nil {
+		log.Close()
+		return nil, nil, err
+	}
+	repo.log = log
+	repo.logSize = info.Size()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go repo.compactPeriodically(options.CompactionInterval, stop, done)
+	cleanup := func() {
+		close(stop)
+		<-done
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		repo.log.Close()
+	}
+	return repo, cleanup, nil
+}
+
+func (repo *CustomerWalRepository) CreateCustomer(customer domain.Customer) (domain.CustomerId, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, found := repo.memory.get(customer.Tenant, customer.Id); found {
+		return domain.CustomerId{}, domain.CustomerAlreadyExistsError{Id: customer.Id}
+	}
+	if err := repo.append(walEntry{Op: walCreate, Customer: newCustomerRecord(customer)}); err != nil {
+		return domain.CustomerId{}, err
+	}
+	return repo.memory.CreateCustomer(customer)
+}
+
+func (repo *CustomerWalRepository) GetCustomer(tenant domain.TenantId, id domain.CustomerId) (domain.Customer, bool, error) {
+	return repo.memory.GetCustomer(tenant, id)
+}
+
+func (repo *CustomerWalRepository) ListCustomers(tenant domain.TenantId, query domain.CustomerQuery, after domain.CustomerCursor, limit int) ([]domain.Customer, error) {
+	return repo.memory.ListCustomers(tenant, query, after, limit)
+}
+
+// UpdateCustomer checks the version under mu, which also serializes every other mutation, so the check and
+// the update are atomic
+func (repo *CustomerWalRepository) UpdateCustomer(customer domain.Customer, expectedVersion int64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	current, found := repo.memory.get(customer.Tenant, customer.Id)
+	if !found {
+		return domain.CustomerNotFoundError{Id: customer.Id}
+	}
+	if err := checkVersion(current, expectedVersion); err != nil {
+		return err
+	}
+	if err := repo.append(walEntry{Op: walUpdate, Customer: newCustomerRecord(customer)}); err != nil {
+		return err
+	}
+	return repo.memory.UpdateCustomer(customer, expectedVersion)
+}
+
+func (repo *CustomerWalRepository) DeleteCustomer(tenant domain.TenantId, id domain.CustomerId, expectedVersion int64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	current, found := repo.memory.get(tenant, id)
+	if !found {
+		return domain.CustomerNotFoundError{Id: id}
+	}
+	if err := checkVersion(current, expectedVersion); err != nil {
+		return err
+	}
+	if err := repo.append(walEntry{Op: walDelete, Customer: customerRecord{Tenant: tenant.Raw, Id: id.Raw}}); err != nil {
+		return fmt.Errorf("deleting customer %s: %w", id.Raw, err)
+	}
+	return repo.memory.DeleteCustomer(tenant, id, expectedVersion)
+}
+
+// Compact writes all customers to a new snapshot and empties the log
+func (repo *CustomerWalRepository) Compact() error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	temporary := repo.path(walSnapshotFile + ".tmp")
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	var encodeErr error
+	repo.memory.Data.Range(func(_, value any) bool {
+		encodeErr = encoder.Encode(newCustomerRecord(value.(domain.Customer)))
+		return encodeErr == nil
+	})
+	if err := errors.Join(encodeErr, writer.Flush(), file.Sync(), file.Close()); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	if err := os.Rename(temporary, repo.path(walSnapshotFile)); err != nil {
+		return err
+	}
+	// a crash before truncation only means the log is replayed on top of a snapshot that already contains it,
+	// which is harmless as replay is idempotent
+	if err := repo.log.Truncate(0); err != nil {
+		return err
+	}
+	repo.logSize = 0
+	return repo.log.Sync()
+}
+
+func (repo *CustomerWalRepository) compactPeriodically(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	if interval <= 0 {
+		<-stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := repo.Compact(); err != nil {
+				slog.Error("compacting customer log", "error", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// append writes and syncs an entry; when either fails the entry is cut off again, as a partial line followed
+// by later entries would be damage replay cannot recover from
+func (repo *CustomerWalRepository) append(entry walEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	_, err = repo.log.Write(line)
+	if err == nil {
+		err = repo.log.Sync()
+	}
+	if err != nil {
+		if truncateErr := repo.log.Truncate(repo.logSize); truncateErr != nil {
+			return errors.Join(err, fmt.Errorf("truncating customer log: %w", truncateErr))
+		}
+		return err
+	}
+	repo.logSize += int64(len(line))
+	return nil
+}
+
+func (repo *CustomerWalRepository) replaySnapshot() error {
+	file, err := os.Open(repo.path(walSnapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// snapshots are renamed into place only once complete, so any damage is a real error
+	decoder := json.NewDecoder(file)
+	for {
+		var record customerRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading customer snapshot: %w", err)
+		}
+		customer := record.toCustomer()
+		repo.memory.Data.Store(keyOf(customer), customer)
+	}
+}
+
+// replayLog applies the logged mutations; a damaged last line is what a crash in the middle of an append leaves
+// behind, so it is cut off, while damage anywhere else is reported
+func (repo *CustomerWalRepository) replayLog() error {
+	file, err := os.OpenFile(repo.path(walLogFile), os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) == 0 && readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		// a line is only acknowledged once it ends with a newline
+		var entry walEntry
+		if readErr == nil && json.Unmarshal(line, &entry) == nil {
+			repo.apply(entry)
+			offset += int64(len(line))
+			continue
+		}
+		if !isLastLine(reader) {
+			return fmt.Errorf("customer log is damaged at line %d", lineNumber)
+		}
+		slog.Warn("truncating damaged last line of customer log", "line", lineNumber)
+		if err := file.Truncate(offset); err != nil {
+			return err
+		}
+		return file.Sync()
+	}
+}
+
+func isLastLine(reader *bufio.Reader) bool {
+	_, err := reader.Peek(1)
+	return err == io.EOF
+}
+
+// apply uses put and delete semantics, so replaying an entry twice leaves the same state
+func (repo *CustomerWalRepository) apply(entry walEntry) {
+	customer := entry.Customer.toCustomer()
+	switch entry.Op {
+	case walCreate, walUpdate:
+		repo.memory.Data.Store(keyOf(customer), customer)
+	case walDelete:
+		repo.memory.Data.Delete(keyOf(customer))
+	}
+}
+
+func (repo *CustomerWalRepository) path(name string) string {
+	return filepath.Join(repo.dir, name)
+}
@@ -0,0 +1,158 @@
+package infrastructure
+
+import (
+	"errors"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomerWalRepository_Replay(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	john := domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "1"}, Name: "John Doe", Age: 30, Version: 1}
+	jane := domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "2"}, Name: "Jane Doe", Age: 31, Version: 1}
+
+	// and
+	repository, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+	require.NoError(t, err)
+	repository.CreateCustomer(john)
+	repository.CreateCustomer(jane)
+	repository.UpdateCustomer(domain.Customer{Tenant: acme, Id: john.Id, Name: "Johnny", Age: 30, Version: 2}, 1)
+	repository.DeleteCustomer(acme, jane.Id, 1)
+	cleanup()
+
+	// when
+	reopened, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+	require.NoError(t, err)
+	defer cleanup()
+
+	// then
+	customer, found, _ := reopened.GetCustomer(acme, john.Id)
+	assert.True(t, found)
+	assert.Equal(t, "Johnny", customer.Name)
+	assert.Equal(t, int64(2), customer.Version, "Version should be restored")
+	_, found, _ = reopened.GetCustomer(acme, jane.Id)
+	assert.False(t, found, "Deleted customer should stay deleted")
+}
+
+func TestCustomerWalRepository_ReplayAfterCompaction(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	john := domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "1"}, Name: "John Doe", Age: 30, Version: 1}
+	jane := domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "2"}, Name: "Jane Doe", Age: 31, Version: 1}
+
+	// and
+	repository, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+	require.NoError(t, err)
+	repository.CreateCustomer(john)
+
+	// when
+	err = repository.(*CustomerWalRepository).Compact()
+
+	// then
+	require.NoError(t, err)
+	log, _ := os.ReadFile(filepath.Join(dir, walLogFile))
+	assert.Empty(t, log, "Compaction should empty the log")
+
+	// and
+	repository.CreateCustomer(jane)
+	cleanup()
+	reopened, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+	require.NoError(t, err)
+	defer cleanup()
+	_, found, _ := reopened.GetCustomer(acme, john.Id)
+	assert.True(t, found, "Customer from snapshot should be restored")
+	_, found, _ = reopened.GetCustomer(acme, jane.Id)
+	assert.True(t, found, "Customer from log should be restored")
+}
+
+func TestCustomerWalRepository_TruncatedLastLine(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	complete := `{"op":"create","customer":{"id":"1","name":"John Doe","age":30}}` + "\n"
+	truncated := `{"op":"create","customer":{"id":"2","na`
+	os.WriteFile(filepath.Join(dir, walLogFile), []byte(complete+truncated), 0o644)
+
+	// when
+	repository, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+
+	// then
+	require.NoError(t, err)
+	defer cleanup()
+	_, found, _ := repository.GetCustomer(domain.DefaultTenant, domain.CustomerId{Raw: "1"})
+	assert.True(t, found, "Complete entries should be replayed into the default tenant")
+	_, found, _ = repository.GetCustomer(domain.DefaultTenant, domain.CustomerId{Raw: "2"})
+	assert.False(t, found, "Truncated entry should be dropped")
+
+	// and
+	log, _ := os.ReadFile(filepath.Join(dir, walLogFile))
+	assert.Equal(t, complete, string(log), "Truncated entry should be cut off the log")
+}
+
+func TestCustomerWalRepository_DamagedLineInTheMiddle(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	damaged := "not json\n" + `{"op":"create","customer":{"id":"1","name":"John Doe","age":30}}` + "\n"
+	os.WriteFile(filepath.Join(dir, walLogFile), []byte(damaged), 0o644)
+
+	// when
+	_, _, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+
+	// then
+	assert.EqualError(t, err, "customer log is damaged at line 1")
+}
+
+// tornWalFile writes half of every entry and fails, as a full disk does
+type tornWalFile struct {
+	walFile
+}
+
+func (file tornWalFile) Write(p []byte) (int, error) {
+	written, _ := file.walFile.Write(p[:len(p)/2])
+	return written, errors.New("no space left on device")
+}
+
+func TestCustomerWalRepository_FailedAppend(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	john := domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "1"}, Name: "John Doe", Age: 30, Version: 1}
+	jane := domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "2"}, Name: "Jane Doe", Age: 31, Version: 1}
+	jack := domain.Customer{Tenant: acme, Id: domain.CustomerId{Raw: "3"}, Name: "Jack Smith", Age: 40, Version: 1}
+
+	// and
+	repository, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+	require.NoError(t, err)
+	wal := repository.(*CustomerWalRepository)
+	_, err = repository.CreateCustomer(john)
+	require.NoError(t, err)
+
+	// when
+	log := wal.log
+	wal.log = tornWalFile{walFile: log}
+	_, err = repository.CreateCustomer(jane)
+	wal.log = log
+
+	// then
+	assert.Error(t, err)
+	_, found, _ := repository.GetCustomer(acme, jane.Id)
+	assert.False(t, found, "Customer should not be created when its entry is not logged")
+
+	// and
+	_, err = repository.CreateCustomer(jack)
+	require.NoError(t, err)
+	cleanup()
+	reopened, cleanup, err := NewCustomerWalRepository(CustomerWalOptions{Dir: dir})
+	require.NoError(t, err, "Partial entry should not damage the log")
+	defer cleanup()
+	_, found, _ = reopened.GetCustomer(acme, john.Id)
+	assert.True(t, found)
+	_, found, _ = reopened.GetCustomer(acme, jane.Id)
+	assert.False(t, found)
+	_, found, _ = reopened.GetCustomer(acme, jack.Id)
+	assert.True(t, found, "Entries after the failed one should be replayed")
+}
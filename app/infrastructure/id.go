@@ -1,8 +1,13 @@
 package infrastructure
 
 import (
+	"crypto/rand"
+	"fmt"
 	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
 	"go-chi-gorilla-wire-workshop/app/domain"
+	"sync"
+	"time"
 )
 
 type IdUuidRepository struct{}
@@ -14,3 +19,89 @@ func NewIdUuidRepository() domain.IdRepository {
 func (repo *IdUuidRepository) GetId() string {
 	return uuid.New().String()
 }
+
+// IdUuidV7Repository generates time-ordered UUIDs; the uuid package keeps them monotonic within the process
+type IdUuidV7Repository struct{}
+
+func NewIdUuidV7Repository() domain.IdRepository {
+	return &IdUuidV7Repository{}
+}
+
+func (repo *IdUuidV7Repository) GetId() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+type IdUlidRepository struct {
+	mu      sync.Mutex
+	entropy *ulid.MonotonicEntropy
+	lastMs  uint64
+}
+
+func NewIdUlidRepository() domain.IdRepository {
+	return &IdUlidRepository{entropy: ulid.Monotonic(rand.Reader, 0)}
+}
+
+func (repo *IdUlidRepository) GetId() string {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	// a clock moving backwards must not break the ordering, so time never goes below the last used millisecond
+	ms := max(ulid.Now(), repo.lastMs)
+	for {
+		id, err := ulid.New(ms, repo.entropy)
+		if err == nil {
+			repo.lastMs = ms
+			return id.String()
+		}
+		if err != ulid.ErrMonotonicOverflow {
+			panic(err)
+		}
+		ms++
+	}
+}
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	SnowflakeMaxNodeId    = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch shifts the 41 timestamp bits to last until 2093
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// IdSnowflakeRepository generates 64-bit ids made of milliseconds since snowflakeEpoch, node id and sequence
+type IdSnowflakeRepository struct {
+	nodeId   int64
+	mu       sync.Mutex
+	lastMs   int64
+	sequence int64
+}
+
+type SnowflakeNodeId int64
+
+func NewIdSnowflakeRepository(nodeId SnowflakeNodeId) (domain.IdRepository, error) {
+	if nodeId < 0 || nodeId > SnowflakeMaxNodeId {
+		return nil, fmt.Errorf("snowflake node id %d out of range [0, %d]", nodeId, SnowflakeMaxNodeId)
+	}
+	return &IdSnowflakeRepository{nodeId: int64(nodeId)}, nil
+}
+
+func (repo *IdSnowflakeRepository) GetId() string {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	// as with ulids, the timestamp never goes below the last used one; an exhausted sequence borrows the next millisecond
+	ms := max(time.Since(snowflakeEpoch).Milliseconds(), repo.lastMs)
+	if ms == repo.lastMs {
+		repo.sequence++
+		if repo.sequence > snowflakeMaxSequence {
+			ms++
+			repo.sequence = 0
+		}
+	} else {
+		repo.sequence = 0
+	}
+	repo.lastMs = ms
+	id := ms<<(snowflakeNodeBits+snowflakeSequenceBits) | repo.nodeId<<snowflakeSequenceBits | repo.sequence
+	// zero padding keeps the string order equal to the numeric one
+	return fmt.Sprintf("%019d", id)
+}
@@ -0,0 +1,63 @@
+package infrastructure
+
+import (
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedIdRepositories(t *testing.T) {
+	snowflake, err := NewIdSnowflakeRepository(42)
+	require.NoError(t, err)
+
+	repositories := map[string]domain.IdRepository{
+		"uuidv7":    NewIdUuidV7Repository(),
+		"ulid":      NewIdUlidRepository(),
+		"snowflake": snowflake,
+	}
+
+	for name, repository := range repositories {
+		t.Run(name, func(t *testing.T) {
+			// given
+			const callers = 8
+			const idsPerCaller = 2000
+
+			// when
+			var wg sync.WaitGroup
+			ids := make([][]string, callers)
+			for caller := 0; caller < callers; caller++ {
+				wg.Add(1)
+				go func(caller int) {
+					defer wg.Done()
+					for i := 0; i < idsPerCaller; i++ {
+						ids[caller] = append(ids[caller], repository.GetId())
+					}
+				}(caller)
+			}
+			wg.Wait()
+
+			// then
+			seen := map[string]bool{}
+			for _, callerIds := range ids {
+				for i, id := range callerIds {
+					assert.False(t, seen[id], "Id %s generated twice", id)
+					seen[id] = true
+					if i > 0 && callerIds[i-1] >= id {
+						t.Fatalf("ids not monotonic: %s generated after %s", id, callerIds[i-1])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewIdSnowflakeRepository_NodeIdOutOfRange(t *testing.T) {
+	// when
+	_, err := NewIdSnowflakeRepository(SnowflakeMaxNodeId + 1)
+
+	// then
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idempotencySweepInterval bounds how often expired records are looked for; the sweep runs within a reservation,
+// so an idle repository keeps its expired records until the next one
+const idempotencySweepInterval = time.Minute
+
+type idempotencyKey struct {
+	Tenant domain.TenantId
+	Key    string
+}
+
+// IdempotencyInMemoryRepository keeps idempotency keys of this instance only; they do not survive a restart
+type IdempotencyInMemoryRepository struct {
+	Data sync.Map
+	// nextSweep is in unix nanoseconds
+	nextSweep atomic.Int64
+}
+
+func NewIdempotencyInMemoryRepository() domain.IdempotencyRepository {
+	return &IdempotencyInMemoryRepository{}
+}
+
+func (repo *IdempotencyInMemoryRepository) ReserveIdempotencyKey(record domain.IdempotencyRecord, now time.Time) (domain.IdempotencyRecord, bool, error) {
+	repo.sweep(now)
+	key := idempotencyKey{Tenant: record.Tenant, Key: record.Key}
+	for {
+		current, loaded := repo.Data.LoadOrStore(key, record)
+		if !loaded {
+			return record, true, nil
+		}
+		existing := current.(domain.IdempotencyRecord)
+		if now.Before(existing.ExpiresAt) {
+			return existing, false, nil
+		}
+		if repo.Data.CompareAndSwap(key, current, record) {
+			return record, true, nil
+		}
+	}
+}
+
+func (repo *IdempotencyInMemoryRepository) CompleteIdempotencyKey(record domain.IdempotencyRecord) error {
+	repo.Data.Store(idempotencyKey{Tenant: record.Tenant, Key: record.Key}, record)
+	return nil
+}
+
+func (repo *IdempotencyInMemoryRepository) ReleaseIdempotencyKey(tenant domain.TenantId, key string) error {
+	repo.Data.Delete(idempotencyKey{Tenant: tenant, Key: key})
+	return nil
+}
+
+// sweep drops expired records, at most once per idempotencySweepInterval across all callers
+func (repo *IdempotencyInMemoryRepository) sweep(now time.Time) {
+	next := repo.nextSweep.Load()
+	if now.UnixNano() < next || !repo.nextSweep.CompareAndSwap(next, now.Add(idempotencySweepInterval).UnixNano()) {
+		return
+	}
+	repo.Data.Range(func(key, value any) bool {
+		if !now.Before(value.(domain.IdempotencyRecord).ExpiresAt) {
+			repo.Data.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
@@ -0,0 +1,115 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"sync/atomic"
+	"time"
+)
+
+// expiry is stored as unix nanoseconds; customer_id is empty while the create is in progress
+const idempotencySchema = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	tenant_id   TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	fingerprint BLOB NOT NULL,
+	customer_id TEXT NOT NULL,
+	expires_at  INTEGER NOT NULL,
+	PRIMARY KEY (tenant_id, key)
+)`
+
+// IdempotencySqliteRepository keeps idempotency keys across restarts and instances sharing the database;
+// unexpected database errors are returned, like CustomerSqliteRepository does
+type IdempotencySqliteRepository struct {
+	db *sql.DB
+	// nextSweep is in unix nanoseconds
+	nextSweep atomic.Int64
+}
+
+func NewIdempotencySqliteRepository(db *sql.DB) (domain.IdempotencyRepository, error) {
+	if _, err := db.Exec(idempotencySchema); err != nil {
+		return nil, fmt.Errorf("creating idempotency schema: %w", err)
+	}
+	return &IdempotencySqliteRepository{db: db}, nil
+}
+
+// ReserveIdempotencyKey inserts the record, or replaces an expired one, in a single upsert, so concurrent
+// reservations of one key cannot both win
+func (repo *IdempotencySqliteRepository) ReserveIdempotencyKey(record domain.IdempotencyRecord, now time.Time) (domain.IdempotencyRecord, bool, error) {
+	if err := repo.sweep(now); err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+	for {
+		result, err := repo.db.Exec(
+			`INSERT INTO idempotency_keys (tenant_id, key, fingerprint, customer_id, expires_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (tenant_id, key) DO UPDATE SET
+				fingerprint = excluded.fingerprint, customer_id = excluded.customer_id, expires_at = excluded.expires_at
+			WHERE idempotency_keys.expires_at <= ?`,
+			record.Tenant.Raw, record.Key, record.Fingerprint[:], record.CustomerId.Raw, record.ExpiresAt.UnixNano(), now.UnixNano(),
+		)
+		if err != nil {
+			return domain.IdempotencyRecord{}, false, fmt.Errorf("reserving idempotency key %s: %w", record.Key, err)
+		}
+		if reserved, _ := result.RowsAffected(); reserved > 0 {
+			return record, true, nil
+		}
+		existing, found, err := repo.get(record.Tenant, record.Key)
+		if err != nil {
+			return domain.IdempotencyRecord{}, false, err
+		}
+		// a key released between the upsert and the read is free again
+		if found {
+			return existing, false, nil
+		}
+	}
+}
+
+func (repo *IdempotencySqliteRepository) CompleteIdempotencyKey(record domain.IdempotencyRecord) error {
+	_, err := repo.db.Exec(
+		"UPDATE idempotency_keys SET customer_id = ?, expires_at = ? WHERE tenant_id = ? AND key = ?",
+		record.CustomerId.Raw, record.ExpiresAt.UnixNano(), record.Tenant.Raw, record.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("completing idempotency key %s: %w", record.Key, err)
+	}
+	return nil
+}
+
+func (repo *IdempotencySqliteRepository) ReleaseIdempotencyKey(tenant domain.TenantId, key string) error {
+	if _, err := repo.db.Exec("DELETE FROM idempotency_keys WHERE tenant_id = ? AND key = ?", tenant.Raw, key); err != nil {
+		return fmt.Errorf("releasing idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+func (repo *IdempotencySqliteRepository) get(tenant domain.TenantId, key string) (domain.IdempotencyRecord, bool, error) {
+	record := domain.IdempotencyRecord{Tenant: tenant, Key: key}
+	var fingerprint []byte
+	var expiresAt int64
+	err := repo.db.QueryRow(
+		"SELECT fingerprint, customer_id, expires_at FROM idempotency_keys WHERE tenant_id = ? AND key = ?",
+		tenant.Raw, key,
+	).Scan(&fingerprint, &record.CustomerId.Raw, &expiresAt)
+	if err == sql.ErrNoRows {
+		return domain.IdempotencyRecord{}, false, nil
+	}
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, fmt.Errorf("getting idempotency key %s: %w", key, err)
+	}
+	copy(record.Fingerprint[:], fingerprint)
+	record.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	return record, true, nil
+}
+
+// sweep drops expired records, at most once per idempotencySweepInterval across all callers of this instance
+func (repo *IdempotencySqliteRepository) sweep(now time.Time) error {
+	next := repo.nextSweep.Load()
+	if now.UnixNano() < next || !repo.nextSweep.CompareAndSwap(next, now.Add(idempotencySweepInterval).UnixNano()) {
+		return nil
+	}
+	if _, err := repo.db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", now.UnixNano()); err != nil {
+		return fmt.Errorf("sweeping idempotency keys: %w", err)
+	}
+	return nil
+}
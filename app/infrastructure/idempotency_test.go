@@ -0,0 +1,69 @@
+package infrastructure
+
+import (
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/domain/repositorytest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyInMemoryRepository(t *testing.T) {
+	repositorytest.RunIdempotency(t, func(t *testing.T) domain.IdempotencyRepository {
+		return NewIdempotencyInMemoryRepository()
+	})
+}
+
+func TestIdempotencySqliteRepository(t *testing.T) {
+	repositorytest.RunIdempotency(t, func(t *testing.T) domain.IdempotencyRepository {
+		db, cleanup, err := NewSqliteDB(":memory:")
+		require.NoError(t, err)
+		t.Cleanup(cleanup)
+		repository, err := NewIdempotencySqliteRepository(db)
+		require.NoError(t, err)
+		return repository
+	})
+}
+
+func TestIdempotencyInMemoryRepository_SweepExpiredKeys(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repository := NewIdempotencyInMemoryRepository()
+	repository.ReserveIdempotencyKey(domain.IdempotencyRecord{Tenant: acme, Key: "key-1", ExpiresAt: now.Add(time.Hour)}, now)
+
+	// when
+	later := now.Add(time.Hour)
+	repository.ReserveIdempotencyKey(domain.IdempotencyRecord{Tenant: acme, Key: "key-2", ExpiresAt: later.Add(time.Hour)}, later)
+
+	// then
+	_, found := repository.(*IdempotencyInMemoryRepository).Data.Load(idempotencyKey{Tenant: acme, Key: "key-1"})
+	assert.False(t, found, "Expired key should be dropped")
+}
+
+func TestIdempotencySqliteRepository_SurvivesReopening(t *testing.T) {
+	// given
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dataSourceName := SqliteDataSourceName(filepath.Join(t.TempDir(), "idempotency.db"))
+	record := domain.IdempotencyRecord{Tenant: acme, Key: "key-1", CustomerId: domain.CustomerId{Raw: "1"}, ExpiresAt: now.Add(time.Hour)}
+	db, cleanup, err := NewSqliteDB(dataSourceName)
+	require.NoError(t, err)
+	repository, err := NewIdempotencySqliteRepository(db)
+	require.NoError(t, err)
+	repository.ReserveIdempotencyKey(record, now)
+	cleanup()
+
+	// when
+	db, cleanup, err = NewSqliteDB(dataSourceName)
+	require.NoError(t, err)
+	defer cleanup()
+	reopened, err := NewIdempotencySqliteRepository(db)
+	require.NoError(t, err)
+	existing, reserved, _ := reopened.ReserveIdempotencyKey(record, now.Add(time.Minute))
+
+	// then
+	assert.False(t, reserved, "Key should be remembered after a restart")
+	assert.Equal(t, record, existing)
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app/config"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway/auth"
+	"go-chi-gorilla-wire-workshop/app/infrastructure"
+
+	"github.com/google/wire"
+)
+
+var ConfigSet = wire.NewSet(
+	wire.FieldsOf(new(config.Config), "Repository", "Id", "Auth", "ApiKeys", "Idempotency"),
+)
+
+var ConfiguredInfrastructureSet = wire.NewSet(
+	NewCustomerRepository,
+	NewIdRepository,
+	NewApiKeyRepository,
+	NewIdempotencyRepository,
+	NewIdempotencyWindow,
+)
+
+var AuthSet = wire.NewSet(
+	NewTokenVerifier,
+)
+
+var InMemoryInfrastructureSet = wire.NewSet(
+	infrastructure.NewCustomerInMemoryRepository,
+	infrastructure.NewIdUuidRepository,
+	infrastructure.NewApiKeyInMemoryRepository,
+	infrastructure.NewIdempotencyInMemoryRepository,
+	wire.Value(domain.DefaultIdempotencyWindow),
+)
+
+var DomainSet = wire.NewSet(
+	domain.NewIdService,
+	domain.NewCustomerService,
+	domain.NewApiKeyService,
+)
+
+// App is what the HTTP server is built from
+type App struct {
+	CustomerService domain.CustomerService
+	ApiKeyService   domain.ApiKeyService
+	TokenVerifier   auth.TokenVerifier
+}
+
+func NewCustomerRepository(repositoryConfig config.RepositoryConfig) (domain.CustomerRepository, func(), error) {
+	switch repositoryConfig.Backend {
+	case config.RepositoryMemory:
+		return infrastructure.NewCustomerInMemoryRepository(), func() {}, nil
+	case config.RepositorySqlite:
+		dataSourceName := infrastructure.SqliteDataSourceName(repositoryConfig.Sqlite.DataSourceName)
+		db, cleanup, err := infrastructure.NewSqliteDB(dataSourceName)
+		if err != nil {
+			return nil, nil, err
+		}
+		repository, err := infrastructure.NewCustomerSqliteRepository(db)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return repository, cleanup, nil
+	case config.RepositoryWal:
+		return infrastructure.NewCustomerWalRepository(infrastructure.CustomerWalOptions{
+			Dir:                repositoryConfig.Wal.Dir,
+			CompactionInterval: repositoryConfig.Wal.CompactionInterval,
+		})
+	default:
+		return nil, nil, fmt.Errorf("unknown repository backend %q", repositoryConfig.Backend)
+	}
+}
+
+func NewApiKeyRepository(apiKeysConfig config.ApiKeysConfig) (domain.ApiKeyRepository, func(), error) {
+	switch apiKeysConfig.Backend {
+	case config.RepositoryMemory:
+		return infrastructure.NewApiKeyInMemoryRepository(), func() {}, nil
+	case config.RepositorySqlite:
+		db, cleanup, err := infrastructure.NewSqliteDB(infrastructure.SqliteDataSourceName(apiKeysConfig.Sqlite.DataSourceName))
+		if err != nil {
+			return nil, nil, err
+		}
+		repository, err := infrastructure.NewApiKeySqliteRepository(db)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return repository, cleanup, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown api key backend %q", apiKeysConfig.Backend)
+	}
+}
+
+func NewIdempotencyRepository(idempotencyConfig config.IdempotencyConfig) (domain.IdempotencyRepository, func(), error) {
+	switch idempotencyConfig.Backend {
+	case config.RepositoryMemory:
+		return infrastructure.NewIdempotencyInMemoryRepository(), func() {}, nil
+	case config.RepositorySqlite:
+		db, cleanup, err := infrastructure.NewSqliteDB(infrastructure.SqliteDataSourceName(idempotencyConfig.Sqlite.DataSourceName))
+		if err != nil {
+			return nil, nil, err
+		}
+		repository, err := infrastructure.NewIdempotencySqliteRepository(db)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return repository, cleanup, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown idempotency backend %q", idempotencyConfig.Backend)
+	}
+}
+
+func NewIdempotencyWindow(idempotencyConfig config.IdempotencyConfig) domain.IdempotencyWindow {
+	return domain.IdempotencyWindow(idempotencyConfig.Window)
+}
+
+func NewIdRepository(idConfig config.IdConfig) (domain.IdRepository, error) {
+	switch idConfig.Generator {
+	case config.IdUuid:
+		return infrastructure.NewIdUuidRepository(), nil
+	case config.IdUuidV7:
+		return infrastructure.NewIdUuidV7Repository(), nil
+	case config.IdUlid:
+		return infrastructure.NewIdUlidRepository(), nil
+	case config.IdSnowflake:
+		return infrastructure.NewIdSnowflakeRepository(infrastructure.SnowflakeNodeId(idConfig.Snowflake.NodeId))
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", idConfig.Generator)
+	}
+}
+
+func NewTokenVerifier(authConfig config.AuthConfig) (auth.TokenVerifier, error) {
+	keys, err := auth.NewJwksFile(authConfig.JwksFile, authConfig.JwksRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewJwtVerifier(keys, auth.JwtOptions{
+		Issuer:   authConfig.Issuer,
+		Audience: authConfig.Audience,
+		Leeway:   authConfig.Leeway,
+	}), nil
+}
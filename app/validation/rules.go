@@ -0,0 +1,172 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// Rule is a named rule usable in validate tags; either Func implements it or Alias expands it into other rules,
+// while a rule with neither only names the failures reported by a struct rule
+type Rule struct {
+	Tag   string
+	Func  validator.Func
+	Alias string
+	// Pattern is the regular expression a Func rule enforces, if any, so API schemas can state it
+	Pattern string
+	// Messages maps locales to message templates, where {0} is the field name and {1} the rule param;
+	// aliases need none, as failures are reported with the message of the failing rule
+	Messages map[string]string
+}
+
+// personNamePattern accepts words of letters joined by single spaces, hyphens or apostrophes, e.g. "Mary-Jane O'Neil"
+var personNamePattern = regexp.MustCompile(`^[\p{L}\p{M}]+(?:[ '’-][\p{L}\p{M}]+)*$`)
+
+// phoneNumberPattern is an E.164 phone number: a plus, a country code not starting with 0 and at most 15 digits
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// scopePattern is the scope-token of RFC 6749: printable ASCII except space, double quote and backslash
+var scopePattern = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+var rules = []Rule{
+	{
+		Tag: "personname",
+		Func: func(fl validator.FieldLevel) bool {
+			return personNamePattern.MatchString(fl.Field().String())
+		},
+		Pattern: personNamePattern.String(),
+		Messages: map[string]string{
+			"en": "{0} may only contain letters, spaces, hyphens and apostrophes",
+			"pl": "{0} może zawierać tylko litery, spacje, łączniki i apostrofy",
+			"es": "{0} solo puede contener letras, espacios, guiones y apóstrofos",
+		},
+	},
+	{
+		Tag: "e164",
+		Func: func(fl validator.FieldLevel) bool {
+			return phoneNumberPattern.MatchString(fl.Field().String())
+		},
+		Pattern: phoneNumberPattern.String(),
+		Messages: map[string]string{
+			"en": "{0} must be a phone number in E.164 format, e.g. +48123456789",
+			"pl": "{0} musi być numerem telefonu w formacie E.164, np. +48123456789",
+			"es": "{0} debe ser un número de teléfono en formato E.164, p. ej. +48123456789",
+		},
+	},
+	{
+		Tag: "scope",
+		Func: func(fl validator.FieldLevel) bool {
+			return scopePattern.MatchString(fl.Field().String())
+		},
+		Pattern: scopePattern.String(),
+		Messages: map[string]string{
+			"en": "{0} must be a scope without spaces, quotes or backslashes",
+			"pl": "{0} musi być zakresem bez spacji, cudzysłowów i ukośników wstecznych",
+			"es": "{0} debe ser un ámbito sin espacios, comillas ni barras invertidas",
+		},
+	},
+	{
+		Tag:   "customername",
+		Alias: "min=1,max=30,personname",
+	},
+	{
+		Tag:   "customerage",
+		Alias: "min=1,max=200",
+	},
+}
+
+// aliases and patterns remember what rules were registered with, as the validator cannot be asked
+var (
+	aliases  = map[string]string{}
+	patterns = map[string]string{}
+)
+
+func init() {
+	for _, rule := range rules {
+		if err := RegisterRule(rule); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterRule adds a rule to the shared validator; like all registrations it is not safe to call concurrently
+// with validation, so it belongs in package initialization
+func RegisterRule(rule Rule) error {
+	switch {
+	case rule.Func != nil && rule.Alias != "":
+		return fmt.Errorf("rule %s cannot have both a func and an alias", rule.Tag)
+	case rule.Func != nil:
+		if err := validate.RegisterValidation(rule.Tag, rule.Func); err != nil {
+			return err
+		}
+	case rule.Alias != "":
+		validate.RegisterAlias(rule.Tag, rule.Alias)
+		aliases[rule.Tag] = rule.Alias
+	}
+	if rule.Pattern != "" {
+		patterns[rule.Tag] = rule.Pattern
+	}
+	for _, trans := range translators {
+		message, ok := rule.Messages[trans.Locale()]
+		if !ok {
+			continue
+		}
+		if err := registerMessage(rule.Tag, message, trans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Constraint is a single rule of a validate tag, e.g. max=30 is Constraint{Tag: "max", Param: "30"}
+type Constraint struct {
+	Tag   string
+	Param string
+	// Pattern is the regular expression of a registered rule, empty for rules without one
+	Pattern string
+}
+
+// Expand splits a validate tag into its constraints, replacing aliases by the rules they stand for; rules
+// after dive apply to elements and are left out, as are alternatives joined with '|'
+func Expand(tag string) []Constraint {
+	var constraints []Constraint
+	for _, part := range strings.Split(tag, ",") {
+		if part == "" || strings.Contains(part, "|") {
+			continue
+		}
+		if part == "dive" {
+			break
+		}
+		if alias, found := aliases[part]; found {
+			constraints = append(constraints, Expand(alias)...)
+			continue
+		}
+		name, param, _ := strings.Cut(part, "=")
+		constraints = append(constraints, Constraint{Tag: name, Param: param, Pattern: patterns[name]})
+	}
+	return constraints
+}
+
+// RegisterStructRule adds a cross-field rule for the given struct types; it reports failures with
+// validator.StructLevel.ReportError, using a tag registered with RegisterRule for the message
+func RegisterStructRule(fn validator.StructLevelFunc, types ...any) {
+	validate.RegisterStructValidation(fn, types...)
+}
+
+func registerMessage(tag string, message string, trans ut.Translator) error {
+	return validate.RegisterTranslation(tag, trans,
+		func(trans ut.Translator) error {
+			return trans.Add(tag, message, true)
+		},
+		func(trans ut.Translator, fieldErr validator.FieldError) string {
+			translated, err := trans.T(tag, fieldErr.Field(), fieldErr.Param())
+			if err != nil {
+				return fieldErr.Error()
+			}
+			return translated
+		},
+	)
+}
@@ -0,0 +1,170 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonName(t *testing.T) {
+	type input struct {
+		Name string `json:"name" validate:"personname"`
+	}
+
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "John", valid: true},
+		{name: "Mary-Jane O'Neil", valid: true},
+		{name: "Zoë Łukasiewicz", valid: true},
+		{name: "J0hn", valid: false},
+		{name: "John  Doe", valid: false},
+		{name: " John", valid: false},
+		{name: "John-", valid: false},
+		{name: "<script>", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(input{Name: tt.name})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPhoneNumber(t *testing.T) {
+	type input struct {
+		Phone string `json:"phone" validate:"e164"`
+	}
+
+	tests := []struct {
+		phone string
+		valid bool
+	}{
+		{phone: "+48123456789", valid: true},
+		{phone: "+12", valid: true},
+		{phone: "+123456789012345", valid: true},
+		{phone: "48123456789", valid: false},
+		{phone: "+0123456789", valid: false},
+		{phone: "+1", valid: false},
+		{phone: "+1234567890123456", valid: false},
+		{phone: "+48 123 456 789", valid: false},
+		{phone: "+48123456789\n", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.phone, func(t *testing.T) {
+			err := Validate(input{Phone: tt.phone})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPhoneNumber_Messages(t *testing.T) {
+	type input struct {
+		Phone string `json:"phone" validate:"e164"`
+	}
+
+	// given
+	var invalidInput InvalidInput
+	require.True(t, errors.As(Validate(input{Phone: "123"}), &invalidInput))
+
+	for locale, expected := range map[string]string{
+		"en": "phone must be a phone number in E.164 format, e.g. +48123456789",
+		"pl": "phone musi być numerem telefonu w formacie E.164, np. +48123456789",
+		"es": "phone debe ser un número de teléfono en formato E.164, p. ej. +48123456789",
+	} {
+		t.Run(locale, func(t *testing.T) {
+			// when
+			fieldErrors := invalidInput.FieldErrors(TranslatorFor(locale))
+
+			// then
+			assert.Equal(t, []FieldError{{Field: "phone", Rule: "e164", Message: expected}}, fieldErrors)
+		})
+	}
+}
+
+func TestAliasRule_ReportsFailingRule(t *testing.T) {
+	type input struct {
+		Name string `json:"name" validate:"customername"`
+		Age  int    `json:"age" validate:"customerage"`
+	}
+
+	// given
+	err := Validate(input{Name: "J0hn", Age: 201})
+
+	// when
+	var invalidInput InvalidInput
+	require.True(t, errors.As(err, &invalidInput))
+	fieldErrors := invalidInput.FieldErrors(TranslatorFor("pl"))
+
+	// then
+	assert.Equal(t, []FieldError{
+		{Field: "name", Rule: "personname", Message: "name może zawierać tylko litery, spacje, łączniki i apostrofy"},
+		{Field: "age", Rule: "max", Param: "200", Message: "age musi być równe 200 lub mniej"},
+	}, fieldErrors)
+}
+
+func TestRegisterRule_RejectsFuncAndAlias(t *testing.T) {
+	// when
+	err := RegisterRule(Rule{
+		Tag:   "ambiguous",
+		Func:  func(fl validator.FieldLevel) bool { return true },
+		Alias: "min=1",
+	})
+
+	// then
+	assert.Error(t, err)
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		expected []Constraint
+	}{
+		{
+			name:     "Plain rules",
+			tag:      "min=1,max=100",
+			expected: []Constraint{{Tag: "min", Param: "1"}, {Tag: "max", Param: "100"}},
+		},
+		{
+			name: "Alias with a pattern rule",
+			tag:  "omitnil,customername",
+			expected: []Constraint{
+				{Tag: "omitnil"},
+				{Tag: "min", Param: "1"},
+				{Tag: "max", Param: "30"},
+				{Tag: "personname", Pattern: personNamePattern.String()},
+			},
+		},
+		{
+			name:     "Element rules are left out",
+			tag:      "min=1,dive,oneof=a b",
+			expected: []Constraint{{Tag: "min", Param: "1"}},
+		},
+		{
+			name:     "Alternatives are left out",
+			tag:      "required,email|url",
+			expected: []Constraint{{Tag: "required"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Expand(tt.tag))
+		})
+	}
+}
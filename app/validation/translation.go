@@ -0,0 +1,98 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/pl"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	esTranslations "github.com/go-playground/validator/v10/translations/es"
+	plTranslations "github.com/go-playground/validator/v10/translations/pl"
+	"golang.org/x/text/language"
+)
+
+type FieldError struct {
+	// Field is the path of the invalid field, e.g. "name" or "id.raw"
+	Field   string
+	Rule    string
+	Param   string
+	Message string
+}
+
+type translation struct {
+	tag      language.Tag
+	locale   locales.Translator
+	register func(v *validator.Validate, trans ut.Translator) error
+}
+
+// the first translation is the fallback for clients that accept none of them
+var translations = []translation{
+	{language.English, en.New(), enTranslations.RegisterDefaultTranslations},
+	{language.Polish, pl.New(), plTranslations.RegisterDefaultTranslations},
+	{language.Spanish, es.New(), esTranslations.RegisterDefaultTranslations},
+}
+
+var translators, languageMatcher = newTranslators()
+
+func newTranslators() ([]ut.Translator, language.Matcher) {
+	locales := make([]locales.Translator, 0, len(translations))
+	tags := make([]language.Tag, 0, len(translations))
+	for _, t := range translations {
+		locales = append(locales, t.locale)
+		tags = append(tags, t.tag)
+	}
+	universal := ut.New(locales[0], locales...)
+
+	result := make([]ut.Translator, 0, len(translations))
+	for _, t := range translations {
+		trans, _ := universal.GetTranslator(t.locale.Locale())
+		if err := t.register(validate, trans); err != nil {
+			panic(err)
+		}
+		result = append(result, trans)
+	}
+	return result, language.NewMatcher(tags)
+}
+
+// TranslatorFor picks the best supported translator for an Accept-Language header value
+func TranslatorFor(acceptLanguage string) ut.Translator {
+	_, index := language.MatchStrings(languageMatcher, acceptLanguage)
+	return translators[index]
+}
+
+func DefaultTranslator() ut.Translator {
+	return translators[0]
+}
+
+// FieldErrors lists the invalid fields with messages in the translator language; errors that do not come
+// from struct validation have no fields
+func (e InvalidInput) FieldErrors(trans ut.Translator) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(e.Err, &validationErrs) {
+		return nil
+	}
+	fieldErrors := make([]FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   fieldPath(fieldErr),
+			Rule:    fieldErr.ActualTag(),
+			Param:   fieldErr.Param(),
+			Message: fieldErr.Translate(trans),
+		})
+	}
+	return fieldErrors
+}
+
+// fieldPath drops the root struct name from the namespace
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+	return path
+}
@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslatorFor(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		expectedLocale string
+	}{
+		{acceptLanguage: "", expectedLocale: "en"},
+		{acceptLanguage: "pl", expectedLocale: "pl"},
+		{acceptLanguage: "pl-PL,pl;q=0.9,en;q=0.8", expectedLocale: "pl"},
+		{acceptLanguage: "de-DE,es;q=0.7,en;q=0.5", expectedLocale: "es"},
+		{acceptLanguage: "ja", expectedLocale: "en"},
+		{acceptLanguage: "not a header", expectedLocale: "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			assert.Equal(t, tt.expectedLocale, TranslatorFor(tt.acceptLanguage).Locale())
+		})
+	}
+}
+
+func TestInvalidInput_FieldErrors(t *testing.T) {
+	type address struct {
+		City string `json:"city" validate:"min=1"`
+	}
+	type input struct {
+		Name    string `json:"name" validate:"min=1"`
+		Address address
+	}
+
+	// given
+	err := Validate(input{Name: "", Address: address{City: ""}})
+
+	// when
+	fieldErrors := err.(InvalidInput).FieldErrors(DefaultTranslator())
+
+	// then
+	assert.Equal(t, []FieldError{
+		{Field: "name", Rule: "min", Param: "1", Message: "name must be at least 1 character in length"},
+		{Field: "address.city", Rule: "min", Param: "1", Message: "city must be at least 1 character in length"},
+	}, fieldErrors)
+}
@@ -3,6 +3,8 @@ package validation
 import (
 	"fmt"
 	"github.com/go-playground/validator/v10"
+	"reflect"
+	"strings"
 )
 
 type InvalidInput struct {
@@ -13,7 +15,27 @@ func (e InvalidInput) Error() string {
 	return fmt.Sprintf("invalid input: %v", e.Err)
 }
 
-var validate = validator.New()
+var validate = newValidate()
+
+func newValidate() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(fieldName)
+	return v
+}
+
+// fieldName reports fields under their json names, as clients know them; structs without json tags fall back
+// to the lower camel case field name
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return strings.ToLower(field.Name[:1]) + field.Name[1:]
+	default:
+		return name
+	}
+}
 
 func Validate[T any](input T) error {
 	if err := validate.Struct(input); err != nil {
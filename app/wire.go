@@ -5,26 +5,33 @@ package app
 
 import (
 	"github.com/google/wire"
+	"go-chi-gorilla-wire-workshop/app/config"
 	"go-chi-gorilla-wire-workshop/app/domain"
-	"go-chi-gorilla-wire-workshop/app/infrastructure"
 )
 
-func InitializeApp() domain.CustomerService {
+func InitializeApp(appConfig config.Config) (App, func(), error) {
 	wire.Build(
-		infrastructure.NewCustomerInMemoryRepository,
-		infrastructure.NewIdUuidRepository,
-		domain.NewIdService,
-		domain.NewCustomerService,
+		ConfigSet,
+		ConfiguredInfrastructureSet,
+		AuthSet,
+		DomainSet,
+		wire.Struct(new(App), "*"),
 	)
-	return domain.CustomerService{}
+	return App{}, nil, nil
 }
 
 func InitializeInMemoryApp() domain.CustomerService {
 	wire.Build(
-		infrastructure.NewCustomerInMemoryRepository,
-		infrastructure.NewIdUuidRepository,
-		domain.NewIdService,
-		domain.NewCustomerService,
+		InMemoryInfrastructureSet,
+		DomainSet,
 	)
 	return domain.CustomerService{}
 }
+
+func InitializeInMemoryApiKeyService() domain.ApiKeyService {
+	wire.Build(
+		InMemoryInfrastructureSet,
+		DomainSet,
+	)
+	return domain.ApiKeyService{}
+}
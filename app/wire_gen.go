@@ -7,24 +7,78 @@
 package app
 
 import (
+	"go-chi-gorilla-wire-workshop/app/config"
 	"go-chi-gorilla-wire-workshop/app/domain"
 	"go-chi-gorilla-wire-workshop/app/infrastructure"
 )
 
 // Injectors from wire.go:
 
-func InitializeApp() domain.CustomerService {
-	customerRepository := infrastructure.NewCustomerInMemoryRepository()
-	idRepository := infrastructure.NewIdUuidRepository()
+func InitializeApp(appConfig config.Config) (App, func(), error) {
+	repositoryConfig := appConfig.Repository
+	customerRepository, cleanup, err := NewCustomerRepository(repositoryConfig)
+	if err != nil {
+		return App{}, nil, err
+	}
+	idConfig := appConfig.Id
+	idRepository, err := NewIdRepository(idConfig)
+	if err != nil {
+		cleanup()
+		return App{}, nil, err
+	}
 	idService := domain.NewIdService(idRepository)
-	customerService := domain.NewCustomerService(customerRepository, idService)
-	return customerService
+	idempotencyConfig := appConfig.Idempotency
+	idempotencyRepository, cleanup2, err := NewIdempotencyRepository(idempotencyConfig)
+	if err != nil {
+		cleanup()
+		return App{}, nil, err
+	}
+	idempotencyWindow := NewIdempotencyWindow(idempotencyConfig)
+	customerService := domain.NewCustomerService(customerRepository, idService, idempotencyRepository, idempotencyWindow)
+	apiKeysConfig := appConfig.ApiKeys
+	apiKeyRepository, cleanup3, err := NewApiKeyRepository(apiKeysConfig)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return App{}, nil, err
+	}
+	apiKeyService := domain.NewApiKeyService(apiKeyRepository)
+	authConfig := appConfig.Auth
+	tokenVerifier, err := NewTokenVerifier(authConfig)
+	if err != nil {
+		cleanup3()
+		cleanup2()
+		cleanup()
+		return App{}, nil, err
+	}
+	app := App{
+		CustomerService: customerService,
+		ApiKeyService:   apiKeyService,
+		TokenVerifier:   tokenVerifier,
+	}
+	return app, func() {
+		cleanup3()
+		cleanup2()
+		cleanup()
+	}, nil
 }
 
 func InitializeInMemoryApp() domain.CustomerService {
 	customerRepository := infrastructure.NewCustomerInMemoryRepository()
 	idRepository := infrastructure.NewIdUuidRepository()
 	idService := domain.NewIdService(idRepository)
-	customerService := domain.NewCustomerService(customerRepository, idService)
+	idempotencyRepository := infrastructure.NewIdempotencyInMemoryRepository()
+	idempotencyWindow := _wireIdempotencyWindowValue
+	customerService := domain.NewCustomerService(customerRepository, idService, idempotencyRepository, idempotencyWindow)
 	return customerService
 }
+
+var (
+	_wireIdempotencyWindowValue = domain.DefaultIdempotencyWindow
+)
+
+func InitializeInMemoryApiKeyService() domain.ApiKeyService {
+	apiKeyRepository := infrastructure.NewApiKeyInMemoryRepository()
+	apiKeyService := domain.NewApiKeyService(apiKeyRepository)
+	return apiKeyService
+}
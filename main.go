@@ -1,38 +1,114 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/gorilla/context"
+	gorillacontext "github.com/gorilla/context"
 	"go-chi-gorilla-wire-workshop/app"
+	"go-chi-gorilla-wire-workshop/app/config"
 	"go-chi-gorilla-wire-workshop/app/gateway"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 )
 
+// shutdownTimeout bounds how long in-flight HTTP requests may finish once the servers stop
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run returns errors rather than exiting, so the repositories are cleaned up before main exits; the servers stop
+// together, when either fails or on SIGINT or SIGTERM
+func run() error {
+	appConfig, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	application, cleanup, err := app.InitializeApp(appConfig)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	r := chi.NewRouter()
-	r.Use(authMiddleware)
 	r.Use(middleware.Recoverer)
+	gateway.OpenApiRouter(r)
+	r.Group(func(r chi.Router) {
+		r.Use(gateway.Authenticate(application.TokenVerifier, application.ApiKeyService))
+		r.Use(gateway.ValidateContract(contractOptions(appConfig.Contract)))
+		gateway.CustomerRouter(application.CustomerService, r)
+		gateway.ApiKeyRouter(application.ApiKeyService, r)
+		gateway.GraphqlRouter(application.CustomerService, r)
+	})
 
-	customerService := app.InitializeApp()
-
-	gateway.CustomerRouter(customerService, r)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	servers, ctx := errgroup.WithContext(ctx)
+	servers.Go(func() error {
+		return serveHttp(ctx, appConfig.Addr, gorillacontext.ClearHandler(r))
+	})
+	servers.Go(func() error {
+		return serveGrpc(ctx, appConfig.GrpcAddr, application)
+	})
+	return servers.Wait()
+}
 
-	http.ListenAndServe(":8080", context.ClearHandler(r))
+// serveHttp serves until ctx is done, then lets in-flight requests finish within shutdownTimeout
+func serveHttp(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving http on %s: %w", addr, err)
+	}
+	return nil
 }
 
-func authMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the token from the Authorization header
-		token := r.Header.Get("Authorization")
+// serveGrpc serves the customer API over gRPC next to the HTTP one, behind the same credentials, until ctx is done
+func serveGrpc(ctx context.Context, addr string, application app.App) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("serving grpc on %s: %w", addr, err)
+	}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(gateway.GrpcRecover(), gateway.GrpcAuthenticate(application.TokenVerifier, application.ApiKeyService)))
+	gateway.RegisterCustomerGrpcService(server, application.CustomerService)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("serving grpc on %s: %w", addr, err)
+	}
+	return nil
+}
 
-		// Validate the token (you can add more validation logic here if needed)
-		if token == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+// contractOptions fails responses that break the OpenAPI document loudly: the panic is logged with its stack
+// and answered with a 500 by the Recoverer
+func contractOptions(contract config.ContractConfig) gateway.ContractOptions {
+	options := gateway.ContractOptions{ValidateRequests: contract.ValidateRequests}
+	if contract.ValidateResponses {
+		options.OnResponseViolation = func(r *http.Request, err error) {
+			panic(err)
 		}
-
-		// Call the next handler if the token is valid
-		next.ServeHTTP(w, r)
-	})
+	}
+	return options
 }
@@ -0,0 +1,212 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-chi-gorilla-wire-workshop/app"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiKeyRouter(t *testing.T) {
+	newRouter := func(t *testing.T) (http.Handler, domain.ApiKeyService, string) {
+		apiKeyService := app.InitializeInMemoryApiKeyService()
+		r := chi.NewRouter()
+		// no bearer tokens are sent, so no token verifier is needed
+		r.Use(gateway.Authenticate(nil, apiKeyService))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+		gateway.ApiKeyRouter(apiKeyService, r)
+		// keys only grant scopes their creator holds, so the admin key holds them all
+		adminScopes := append([]string{gateway.ScopeApiKeysAdmin}, allCustomerScopes...)
+		_, adminKey, err := apiKeyService.CreateApiKey(domain.CreateApiKeyCommand{Tenant: domain.TenantId{Raw: testTenant}, Name: "admin", Scopes: adminScopes})
+		require.NoError(t, err)
+		return r, apiKeyService, adminKey
+	}
+
+	t.Run("Create And Use Api Key", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+
+		// when
+		created := createApiKey(t, r, adminKey, gateway.CreateApiKeyApiInput{Name: "reporting", Scopes: []string{gateway.ScopeCustomersRead}})
+
+		// then
+		assert.Equal(t, "reporting", created.Name)
+		assert.Equal(t, testTenant, created.Tenant, "Key should be bound to the tenant of its creator")
+		assert.NotEmpty(t, created.Key)
+
+		// when
+		list := requestWithApiKey(r, created.Key, "GET", "/customers", nil)
+		create := requestWithApiKey(r, created.Key, "POST", "/customers", gateway.CreateCustomerApiInput{Name: "John", Age: 30})
+
+		// then
+		assert.Equal(t, http.StatusOK, list.Code)
+		assert.Equal(t, http.StatusForbidden, create.Code, "Read-only key should not create customers")
+
+		// and
+		rr := requestWithApiKey(r, adminKey, "GET", "/api-keys/"+created.Id, nil)
+		var stored gateway.ApiKeyApiOutput
+		json.NewDecoder(rr.Body).Decode(&stored)
+		assert.NotNil(t, stored.LastUsedAt)
+		assert.NotContains(t, rr.Body.String(), created.Key, "Key should only be shown on creation")
+	})
+
+	t.Run("Revoke Api Key", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+		created := createApiKey(t, r, adminKey, gateway.CreateApiKeyApiInput{Name: "reporting", Scopes: []string{gateway.ScopeCustomersRead}})
+
+		// when
+		revoke := requestWithApiKey(r, adminKey, "DELETE", "/api-keys/"+created.Id, nil)
+
+		// then
+		assert.Equal(t, http.StatusNoContent, revoke.Code)
+		assert.Equal(t, http.StatusUnauthorized, requestWithApiKey(r, created.Key, "GET", "/customers", nil).Code)
+
+		// and
+		var list gateway.ApiKeyListApiOutput
+		json.NewDecoder(requestWithApiKey(r, adminKey, "GET", "/api-keys", nil).Body).Decode(&list)
+		assert.Len(t, list.Items, 2)
+		for _, item := range list.Items {
+			assert.Equal(t, item.Id == created.Id, item.RevokedAt != nil, "Revoked key should stay listed as revoked")
+		}
+	})
+
+	t.Run("Revoke Non-Existent Api Key", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+
+		// when
+		rr := requestWithApiKey(r, adminKey, "DELETE", "/api-keys/aaaaaaaaaaaaaaaa", nil)
+
+		// then
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Create Api Key With Every Scope", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+		scopes := append([]string{gateway.ScopeApiKeysAdmin}, allCustomerScopes...)
+
+		// when
+		created := createApiKey(t, r, adminKey, gateway.CreateApiKeyApiInput{Name: "operator", Scopes: scopes})
+
+		// then
+		assert.ElementsMatch(t, scopes, created.Scopes)
+	})
+
+	t.Run("Create Api Key With Unknown Scope", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+
+		// when
+		rr := requestWithApiKey(r, adminKey, "POST", "/api-keys", gateway.CreateApiKeyApiInput{Name: "reporting", Scopes: []string{"everything"}})
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "customers:read customers:write customers:delete api-keys:admin", "Error should list the known scopes")
+	})
+
+	t.Run("Create Api Key With Scope Not Held", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+		keyAdmin := createApiKey(t, r, adminKey, gateway.CreateApiKeyApiInput{Name: "key-admin", Scopes: []string{gateway.ScopeApiKeysAdmin, gateway.ScopeCustomersRead}})
+
+		// when
+		rr := requestWithApiKey(r, keyAdmin.Key, "POST", "/api-keys", gateway.CreateApiKeyApiInput{Name: "writer", Scopes: []string{gateway.ScopeCustomersRead, gateway.ScopeCustomersWrite}})
+
+		// then
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/problems/insufficient-scope")
+		assert.Contains(t, rr.Body.String(), gateway.ScopeCustomersWrite)
+
+		// and
+		var list gateway.ApiKeyListApiOutput
+		json.NewDecoder(requestWithApiKey(r, adminKey, "GET", "/api-keys", nil).Body).Decode(&list)
+		assert.Len(t, list.Items, 2, "No key should be created")
+	})
+
+	t.Run("Manage Api Keys Without Admin Scope", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+		created := createApiKey(t, r, adminKey, gateway.CreateApiKeyApiInput{Name: "reporting", Scopes: []string{gateway.ScopeCustomersRead}})
+
+		// when
+		rr := requestWithApiKey(r, created.Key, "GET", "/api-keys", nil)
+
+		// then
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Api Key Cannot Choose Another Tenant", func(t *testing.T) {
+		// given
+		r, _, adminKey := newRouter(t)
+		created := createApiKey(t, r, adminKey, gateway.CreateApiKeyApiInput{Name: "reporting", Scopes: allCustomerScopes})
+		req, _ := http.NewRequest("GET", "/customers", nil)
+		req.Header.Set("X-API-Key", created.Key)
+		req.Header.Set("X-Tenant-ID", "globex")
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Api Keys Of Other Tenants Are Not Visible", func(t *testing.T) {
+		// given
+		r, apiKeyService, adminKey := newRouter(t)
+		other, _, err := apiKeyService.CreateApiKey(domain.CreateApiKeyCommand{Tenant: domain.TenantId{Raw: "globex"}, Name: "billing", Scopes: []string{gateway.ScopeCustomersRead}})
+		require.NoError(t, err)
+
+		// when
+		get := requestWithApiKey(r, adminKey, "GET", "/api-keys/"+other.Prefix, nil)
+		revoke := requestWithApiKey(r, adminKey, "DELETE", "/api-keys/"+other.Prefix, nil)
+		var list gateway.ApiKeyListApiOutput
+		json.NewDecoder(requestWithApiKey(r, adminKey, "GET", "/api-keys", nil).Body).Decode(&list)
+
+		// then
+		assert.Equal(t, http.StatusNotFound, get.Code)
+		assert.Equal(t, http.StatusNotFound, revoke.Code)
+		assert.Len(t, list.Items, 1, "Only the admin key of the tenant should be listed")
+	})
+
+	t.Run("Unknown Api Key", func(t *testing.T) {
+		// given
+		r, _, _ := newRouter(t)
+
+		// when
+		rr := requestWithApiKey(r, "ak_aaaaaaaaaaaaaaaa_secret", "GET", "/customers", nil)
+
+		// then
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func requestWithApiKey(r http.Handler, key string, method string, path string, body any) *httptest.ResponseRecorder {
+	var content bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&content).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &content)
+	req.Header.Set("X-API-Key", key)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func createApiKey(t *testing.T, r http.Handler, adminKey string, apiInput gateway.CreateApiKeyApiInput) gateway.CreatedApiKeyApiOutput {
+	rr := requestWithApiKey(r, adminKey, "POST", "/api-keys", apiInput)
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var created gateway.CreatedApiKeyApiOutput
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	return created
+}
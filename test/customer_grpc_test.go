@@ -0,0 +1,334 @@
+package test
+
+import (
+	"context"
+	"go-chi-gorilla-wire-workshop/app"
+	"go-chi-gorilla-wire-workshop/app/domain"
+	"go-chi-gorilla-wire-workshop/app/gateway"
+	"go-chi-gorilla-wire-workshop/app/gateway/customerpb"
+	"go-chi-gorilla-wire-workshop/app/infrastructure"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcClient serves the customer API over an in-process listener, with the api key authentication of main
+type grpcClient struct {
+	customerpb.CustomerServiceClient
+	apiKeys domain.ApiKeyService
+}
+
+func newGrpcClient(t *testing.T) grpcClient {
+	return newGrpcClientOf(t, app.InitializeInMemoryApp())
+}
+
+func newGrpcClientOf(t *testing.T, customerService domain.CustomerService) grpcClient {
+	apiKeyService := app.InitializeInMemoryApiKeyService()
+	listener := bufconn.Listen(1024 * 1024)
+	// no bearer tokens are sent, so no token verifier is needed
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(gateway.GrpcRecover(), gateway.GrpcAuthenticate(nil, apiKeyService)))
+	gateway.RegisterCustomerGrpcService(server, customerService)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return grpcClient{CustomerServiceClient: customerpb.NewCustomerServiceClient(conn), apiKeys: apiKeyService}
+}
+
+// as returns a context calling with a new api key of the given scopes, bound to the tenant of the router tests
+func (client grpcClient) as(t *testing.T, scopes ...string) context.Context {
+	_, key, err := client.apiKeys.CreateApiKey(domain.CreateApiKeyCommand{Tenant: domain.TenantId{Raw: testTenant}, Name: "grpc", Scopes: scopes})
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+}
+
+func TestCustomerGrpcService(t *testing.T) {
+	t.Run("Create, Change And Delete Customer", func(t *testing.T) {
+		// given
+		client := newGrpcClient(t)
+		ctx := client.as(t, allCustomerScopes...)
+
+		// when
+		created, err := client.CreateCustomer(ctx, &customerpb.CreateCustomerRequest{Name: "John Doe", Age: 30})
+
+		// then
+		require.NoError(t, err)
+		assert.NotEmpty(t, created.Id)
+
+		// when
+		customer, err := client.GetCustomer(ctx, &customerpb.GetCustomerRequest{Id: created.Id})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "John Doe", customer.Name)
+		assert.Equal(t, int32(30), customer.Age)
+		assert.NotNil(t, customer.CreatedAt)
+
+		// when
+		updated, err := client.UpdateCustomer(ctx, &customerpb.UpdateCustomerRequest{Id: created.Id, ExpectedVersion: proto.Int64(customer.Version), Name: "Jane Doe", Age: 31})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "Jane Doe", updated.Name)
+		assert.Greater(t, updated.Version, customer.Version)
+
+		// when
+		patched, err := client.PatchCustomer(ctx, &customerpb.PatchCustomerRequest{Id: created.Id, ExpectedVersion: proto.Int64(updated.Version), Age: proto.Int32(32)})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "Jane Doe", patched.Name, "Unset fields should be kept")
+		assert.Equal(t, int32(32), patched.Age)
+
+		// when
+		_, err = client.DeleteCustomer(ctx, &customerpb.DeleteCustomerRequest{Id: created.Id, ExpectedVersion: proto.Int64(0)})
+
+		// then
+		require.NoError(t, err)
+		_, err = client.GetCustomer(ctx, &customerpb.GetCustomerRequest{Id: created.Id})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("List Customers", func(t *testing.T) {
+		// given
+		client := newGrpcClient(t)
+		ctx := client.as(t, allCustomerScopes...)
+		for _, input := range []*customerpb.CreateCustomerRequest{
+			{Name: "John Doe", Age: 30},
+			{Name: "Jane Doe", Age: 25},
+			{Name: "Jack Smith", Age: 40},
+		} {
+			_, err := client.CreateCustomer(ctx, input)
+			require.NoError(t, err)
+		}
+
+		// when
+		first, err := client.ListCustomers(ctx, &customerpb.ListCustomersRequest{AgeGte: proto.Int32(25), Sort: "-age", Limit: 2})
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, first.Items, 2)
+		assert.Equal(t, "Jack Smith", first.Items[0].Name)
+		assert.Equal(t, "John Doe", first.Items[1].Name)
+		assert.NotEmpty(t, first.NextCursor)
+
+		// when
+		second, err := client.ListCustomers(ctx, &customerpb.ListCustomersRequest{AgeGte: proto.Int32(25), Sort: "-age", Limit: 2, Cursor: first.NextCursor})
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, second.Items, 1)
+		assert.Equal(t, "Jane Doe", second.Items[0].Name)
+		assert.Empty(t, second.NextCursor)
+	})
+
+	t.Run("Idempotent Create", func(t *testing.T) {
+		// given
+		client := newGrpcClient(t)
+		ctx := client.as(t, allCustomerScopes...)
+		request := &customerpb.CreateCustomerRequest{Name: "John Doe", Age: 30, IdempotencyKey: "create-john"}
+
+		// when
+		first, err := client.CreateCustomer(ctx, request)
+		require.NoError(t, err)
+		second, err := client.CreateCustomer(ctx, request)
+		require.NoError(t, err)
+
+		// then
+		assert.False(t, first.Replayed)
+		assert.True(t, second.Replayed)
+		assert.Equal(t, first.Id, second.Id)
+	})
+}
+
+func TestCustomerGrpcService_Errors(t *testing.T) {
+	client := newGrpcClient(t)
+	ctx := client.as(t, allCustomerScopes...)
+	created, err := client.CreateCustomer(ctx, &customerpb.CreateCustomerRequest{Name: "John Doe", Age: 30})
+	require.NoError(t, err)
+
+	// and
+	duplicates := newGrpcClientOf(t, domain.NewCustomerService(
+		infrastructure.NewCustomerInMemoryRepository(),
+		domain.NewIdService(fixedIdRepository{}),
+		infrastructure.NewIdempotencyInMemoryRepository(),
+		domain.DefaultIdempotencyWindow,
+	))
+	duplicatesCtx := duplicates.as(t, allCustomerScopes...)
+	_, err = duplicates.CreateCustomer(duplicatesCtx, &customerpb.CreateCustomerRequest{Name: "John Doe", Age: 30})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		call           func() error
+		expectedCode   codes.Code
+		expectedType   string
+		expectedFields []string
+	}{
+		{
+			name: "Not found",
+			call: func() error {
+				_, err := client.GetCustomer(ctx, &customerpb.GetCustomerRequest{Id: nonExistentCustomerId})
+				return err
+			},
+			expectedCode: codes.NotFound,
+			expectedType: "/problems/customer-not-found",
+		},
+		{
+			name: "Already exists",
+			call: func() error {
+				_, err := duplicates.CreateCustomer(duplicatesCtx, &customerpb.CreateCustomerRequest{Name: "Jane Doe", Age: 25})
+				return err
+			},
+			expectedCode: codes.AlreadyExists,
+			expectedType: "/problems/customer-already-exists",
+		},
+		{
+			name: "Validation",
+			call: func() error {
+				_, err := client.CreateCustomer(ctx, &customerpb.CreateCustomerRequest{Name: "", Age: 201})
+				return err
+			},
+			expectedCode:   codes.InvalidArgument,
+			expectedType:   "/problems/validation-failed",
+			expectedFields: []string{"name", "age"},
+		},
+		{
+			name: "Invalid sort",
+			call: func() error {
+				_, err := client.ListCustomers(ctx, &customerpb.ListCustomersRequest{Sort: "email"})
+				return err
+			},
+			expectedCode: codes.InvalidArgument,
+			expectedType: "/problems/validation-failed",
+		},
+		{
+			name: "Missing expected version",
+			call: func() error {
+				_, err := client.DeleteCustomer(ctx, &customerpb.DeleteCustomerRequest{Id: created.Id})
+				return err
+			},
+			expectedCode: codes.FailedPrecondition,
+			expectedType: "/problems/precondition-required",
+		},
+		{
+			name: "Stale expected version",
+			call: func() error {
+				_, err := client.PatchCustomer(ctx, &customerpb.PatchCustomerRequest{Id: created.Id, ExpectedVersion: proto.Int64(99), Age: proto.Int32(31)})
+				return err
+			},
+			expectedCode: codes.FailedPrecondition,
+			expectedType: "/problems/precondition-failed",
+		},
+		{
+			name: "Insufficient scope",
+			call: func() error {
+				_, err := client.DeleteCustomer(client.as(t, gateway.ScopeCustomersRead), &customerpb.DeleteCustomerRequest{Id: created.Id, ExpectedVersion: proto.Int64(0)})
+				return err
+			},
+			expectedCode: codes.PermissionDenied,
+			expectedType: "/problems/insufficient-scope",
+		},
+		{
+			name: "Unauthenticated",
+			call: func() error {
+				_, err := client.GetCustomer(context.Background(), &customerpb.GetCustomerRequest{Id: created.Id})
+				return err
+			},
+			expectedCode: codes.Unauthenticated,
+			expectedType: "/problems/unauthenticated",
+		},
+		{
+			name: "Tenant mismatch",
+			call: func() error {
+				_, err := client.GetCustomer(metadata.AppendToOutgoingContext(ctx, "x-tenant-id", "globex"), &customerpb.GetCustomerRequest{Id: created.Id})
+				return err
+			},
+			expectedCode: codes.PermissionDenied,
+			expectedType: "/problems/tenant-mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			err := tt.call()
+
+			// then
+			st := status.Convert(err)
+			assert.Equal(t, tt.expectedCode, st.Code(), st.Message())
+
+			// and
+			var problemType string
+			var fields []string
+			for _, detail := range st.Details() {
+				switch detail := detail.(type) {
+				case *errdetails.ErrorInfo:
+					problemType = detail.Metadata["type"]
+				case *errdetails.BadRequest:
+					for _, violation := range detail.FieldViolations {
+						fields = append(fields, violation.Field)
+					}
+				}
+			}
+			assert.Equal(t, tt.expectedType, problemType)
+			assert.ElementsMatch(t, tt.expectedFields, fields)
+		})
+	}
+}
+
+// fixedIdRepository hands out the same id every time, so the second customer created collides with the first
+type fixedIdRepository struct{}
+
+func (repository fixedIdRepository) GetId() string {
+	return "duplicate"
+}
+
+// failingCustomerRepository panics on reads, as a bug behind a handler would
+type failingCustomerRepository struct {
+	domain.CustomerRepository
+}
+
+func (repository failingCustomerRepository) GetCustomer(tenant domain.TenantId, id domain.CustomerId) (domain.Customer, bool, error) {
+	panic("database is locked")
+}
+
+func TestCustomerGrpcService_RecoversPanics(t *testing.T) {
+	// given
+	customerService := domain.NewCustomerService(
+		failingCustomerRepository{CustomerRepository: infrastructure.NewCustomerInMemoryRepository()},
+		domain.NewIdService(infrastructure.NewIdUuidRepository()),
+		infrastructure.NewIdempotencyInMemoryRepository(),
+		domain.DefaultIdempotencyWindow,
+	)
+	client := newGrpcClientOf(t, customerService)
+	ctx := client.as(t, allCustomerScopes...)
+
+	// when
+	_, err := client.GetCustomer(ctx, &customerpb.GetCustomerRequest{Id: nonExistentCustomerId})
+
+	// then
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	// and
+	created, err := client.CreateCustomer(ctx, &customerpb.CreateCustomerRequest{Name: "John Doe", Age: 30})
+	assert.NoError(t, err, "Server should keep serving after a panic")
+	assert.NotEmpty(t, created.GetId())
+}
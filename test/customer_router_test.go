@@ -3,21 +3,39 @@ package test
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"go-chi-gorilla-wire-workshop/app"
+	"go-chi-gorilla-wire-workshop/app/domain"
 	"go-chi-gorilla-wire-workshop/app/gateway"
+	"go-chi-gorilla-wire-workshop/app/gateway/auth"
+	"go-chi-gorilla-wire-workshop/app/infrastructure"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
 )
 
+var nonExistentCustomerId = domain.NewCustomerId("NonExistent").Raw
+
+var allCustomerScopes = []string{gateway.ScopeCustomersRead, gateway.ScopeCustomersWrite, gateway.ScopeCustomersDelete}
+
 func TestCustomerRouter(t *testing.T) {
 	t.Run("Create Customer", func(t *testing.T) {
 		// given
 		customerService := app.InitializeInMemoryApp()
 		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
 		gateway.CustomerRouter(customerService, r)
 
 		// and
@@ -41,13 +59,14 @@ func TestCustomerRouter(t *testing.T) {
 
 		// and
 		location := rr.Header().Get("Location")
-		assert.NotEmpty(t, location, "Location header should not be empty")
+		assert.Equal(t, "/customers/"+apiOutput.Id, location)
 	})
 
 	t.Run("Get Customer", func(t *testing.T) {
 		// given
 		customerService := app.InitializeInMemoryApp()
 		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
 		gateway.CustomerRouter(customerService, r)
 
 		// and
@@ -89,10 +108,11 @@ func TestCustomerRouter(t *testing.T) {
 		// given
 		customerService := app.InitializeInMemoryApp()
 		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
 		gateway.CustomerRouter(customerService, r)
 
 		// and
-		req, _ := http.NewRequest("GET", "/customers/NonExistent", nil)
+		req, _ := http.NewRequest("GET", "/customers/"+nonExistentCustomerId, nil)
 		rr := httptest.NewRecorder()
 
 		// when
@@ -101,8 +121,1336 @@ func TestCustomerRouter(t *testing.T) {
 		// then
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 
+		// and
+		assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+		var problem gateway.Problem
+		err := json.NewDecoder(rr.Body).Decode(&problem)
+		assert.NoError(t, err)
+		assert.Equal(t, "/problems/customer-not-found", problem.Type)
+		assert.Equal(t, http.StatusNotFound, problem.Status)
+		assert.Equal(t, "/customers/"+nonExistentCustomerId, problem.Instance)
+
 		// and
 		location := rr.Header().Get("Location")
 		assert.Empty(t, location, "Location header should be empty")
 	})
+	t.Run("Get Customer With Malformed Id", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		mistyped := strings.Replace(nonExistentCustomerId, "NonExistent", "NonExistant", 1)
+		req, _ := http.NewRequest("GET", "/customers/"+mistyped, nil)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Create Customer With Malformed Body", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("POST", "/customers", bytes.NewBufferString(`{"name":`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+		// and
+		var problem gateway.Problem
+		err := json.NewDecoder(rr.Body).Decode(&problem)
+		assert.NoError(t, err)
+		assert.Equal(t, "/problems/malformed-request", problem.Type)
+	})
+
+	t.Run("Create Customer With Invalid Name", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		body, _ := json.Marshal(gateway.CreateCustomerApiInput{Name: "J0hn", Age: 30})
+		req, _ := http.NewRequest("POST", "/customers", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		// and
+		var problem gateway.Problem
+		err := json.NewDecoder(rr.Body).Decode(&problem)
+		assert.NoError(t, err)
+		assert.Len(t, problem.Errors, 1)
+		assert.Equal(t, "name", problem.Errors[0].Field)
+		assert.Equal(t, "personname", problem.Errors[0].Rule)
+		assert.Equal(t, "name may only contain letters, spaces, hyphens and apostrophes", problem.Errors[0].Detail)
+	})
+
+	t.Run("Delete Customer", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		reqBody := gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30}
+		body, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("POST", "/customers", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// and
+		var idApiOutput gateway.CustomerIdApiOutput
+		json.NewDecoder(rr.Body).Decode(&idApiOutput)
+		customerId := idApiOutput.Id
+
+		// when
+		req, _ = http.NewRequest("DELETE", "/customers/"+customerId, nil)
+		req.Header.Set("If-Match", `"1"`)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, rr.Body.String())
+
+		// and
+		req, _ = http.NewRequest("GET", "/customers/"+customerId, nil)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Delete Non-Existent Customer", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("DELETE", "/customers/"+nonExistentCustomerId, nil)
+		req.Header.Set("If-Match", `"1"`)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("Update Customer", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		customerId := createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+
+		// and
+		reqBody := gateway.UpdateCustomerApiInput{Name: "Jane Doe", Age: 31}
+		body, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("PUT", "/customers/"+customerId, bytes.NewBuffer(body))
+		req.Header.Set("If-Match", `"1"`)
+		req.Header.Set("Content-Type", "application/json")
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// and
+		var apiOutput gateway.CustomerApiOutput
+		err := json.NewDecoder(rr.Body).Decode(&apiOutput)
+		assert.NoError(t, err)
+		assert.Equal(t, gateway.CustomerApiOutput{Id: customerId, Name: "Jane Doe", Age: 31}, apiOutput)
+	})
+
+	t.Run("Update Non-Existent Customer", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		body, _ := json.Marshal(gateway.UpdateCustomerApiInput{Name: "Jane Doe", Age: 31})
+		req, _ := http.NewRequest("PUT", "/customers/"+nonExistentCustomerId, bytes.NewBuffer(body))
+		req.Header.Set("If-Match", `"1"`)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Update Customer With Invalid Input", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		customerId := createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+
+		// and
+		body, _ := json.Marshal(gateway.UpdateCustomerApiInput{Name: "", Age: 31})
+		req, _ := http.NewRequest("PUT", "/customers/"+customerId, bytes.NewBuffer(body))
+		req.Header.Set("If-Match", `"1"`)
+		req.Header.Set("Accept-Language", "es-ES,es;q=0.9")
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		// and
+		var problem gateway.Problem
+		err := json.NewDecoder(rr.Body).Decode(&problem)
+		assert.NoError(t, err)
+		assert.Equal(t, "/problems/validation-failed", problem.Type)
+		assert.Len(t, problem.Errors, 1)
+		assert.Equal(t, "name", problem.Errors[0].Field)
+		assert.Equal(t, "min", problem.Errors[0].Rule)
+		assert.Equal(t, "name debe tener al menos 1 carácter de longitud", problem.Errors[0].Detail)
+		assert.Equal(t, "es", rr.Header().Get("Content-Language"))
+	})
+
+	t.Run("Patch Customer", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		customerId := createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+
+		// and
+		req, _ := http.NewRequest("PATCH", "/customers/"+customerId, bytes.NewBufferString(`{"age": 31}`))
+		req.Header.Set("If-Match", `"1"`)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// and
+		var apiOutput gateway.CustomerApiOutput
+		err := json.NewDecoder(rr.Body).Decode(&apiOutput)
+		assert.NoError(t, err)
+		assert.Equal(t, gateway.CustomerApiOutput{Id: customerId, Name: "John Doe", Age: 31}, apiOutput)
+	})
+
+	t.Run("Patch Customer With Null Member", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		customerId := createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+
+		// and
+		req, _ := http.NewRequest("PATCH", "/customers/"+customerId, bytes.NewBufferString(`{"name": null}`))
+		req.Header.Set("If-Match", `"1"`)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("Patch Non-Existent Customer", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("PATCH", "/customers/"+nonExistentCustomerId, bytes.NewBufferString(`{"age": 31}`))
+		req.Header.Set("If-Match", `"1"`)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("List Customers", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		created := map[string]bool{}
+		for i := 0; i < 5; i++ {
+			created[createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})] = true
+		}
+
+		// when
+		firstPage := listCustomers(r, "/customers?limit=3")
+		secondPage := listCustomers(r, "/customers?limit=3&cursor="+*firstPage.NextCursor)
+
+		// then
+		assert.Len(t, firstPage.Items, 3)
+		assert.Len(t, secondPage.Items, 2)
+		assert.Nil(t, secondPage.NextCursor, "Last page should not have a next cursor")
+
+		// and
+		listed := map[string]bool{}
+		for _, item := range append(firstPage.Items, secondPage.Items...) {
+			listed[item.Id] = true
+		}
+		assert.Equal(t, created, listed)
+	})
+
+	t.Run("List Customers Is Stable Under Concurrent Creates", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		created := map[string]bool{}
+		for i := 0; i < 20; i++ {
+			created[createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})] = true
+		}
+
+		// and
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				createCustomer(r, gateway.CreateCustomerApiInput{Name: "Jane Doe", Age: 30})
+			}()
+		}
+
+		// when
+		listed := []string{}
+		path := "/customers?limit=3"
+		for {
+			page := listCustomers(r, path)
+			for _, item := range page.Items {
+				listed = append(listed, item.Id)
+			}
+			if page.NextCursor == nil {
+				break
+			}
+			path = "/customers?limit=3&cursor=" + *page.NextCursor
+		}
+		wg.Wait()
+
+		// then
+		assert.True(t, sort.StringsAreSorted(listed), "Customers should be listed in a stable order")
+		seen := map[string]bool{}
+		for _, id := range listed {
+			assert.False(t, seen[id], "Customer %s listed twice", id)
+			seen[id] = true
+		}
+		for id := range created {
+			assert.True(t, seen[id], "Customer %s created before listing should be listed", id)
+		}
+	})
+
+	t.Run("List Customers With Invalid Cursor", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("GET", "/customers?cursor=not-a-cursor", nil)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("List Customers With Limit Out Of Range", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("GET", "/customers?limit=1000", nil)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("List Customers With Empty Age Range", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("GET", "/customers?age_gte=65&age_lt=18", nil)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		// and
+		var problem gateway.Problem
+		err := json.NewDecoder(rr.Body).Decode(&problem)
+		assert.NoError(t, err)
+		assert.Len(t, problem.Errors, 1)
+		assert.Equal(t, "agerange", problem.Errors[0].Rule)
+	})
+
+	t.Run("List Customers With Filter And Sort", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "John", Age: 30})
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "Joanna", Age: 30})
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "Josh", Age: 50})
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "Jordan", Age: 70})
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "Joe", Age: 10})
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "Alice", Age: 40})
+
+		// when
+		listed := []gateway.CustomerApiOutput{}
+		path := "/customers?name_prefix=Jo&age_gte=18&age_lt=65&sort=-age,name&limit=2"
+		for {
+			page := listCustomers(r, path)
+			listed = append(listed, page.Items...)
+			if page.NextCursor == nil {
+				break
+			}
+			path = "/customers?name_prefix=Jo&age_gte=18&age_lt=65&sort=-age,name&limit=2&cursor=" + *page.NextCursor
+		}
+
+		// then
+		names := []string{}
+		for _, customer := range listed {
+			names = append(names, customer.Name)
+		}
+		assert.Equal(t, []string{"Josh", "Joanna", "John"}, names)
+	})
+
+	t.Run("List Customers With Unknown Field", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("GET", "/customers?email=john@example.com", nil)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+// unavailableCustomerRepository fails every read, as a locked database does
+type unavailableCustomerRepository struct {
+	domain.CustomerRepository
+}
+
+func (repository unavailableCustomerRepository) GetCustomer(tenant domain.TenantId, id domain.CustomerId) (domain.Customer, bool, error) {
+	return domain.Customer{}, false, errors.New("database is locked")
+}
+
+func (repository unavailableCustomerRepository) ListCustomers(tenant domain.TenantId, query domain.CustomerQuery, after domain.CustomerCursor, limit int) ([]domain.Customer, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestCustomerRouter_StorageErrors(t *testing.T) {
+	customerService := domain.NewCustomerService(
+		unavailableCustomerRepository{CustomerRepository: infrastructure.NewCustomerInMemoryRepository()},
+		domain.NewIdService(infrastructure.NewIdUuidRepository()),
+		infrastructure.NewIdempotencyInMemoryRepository(),
+		domain.DefaultIdempotencyWindow,
+	)
+	r := chi.NewRouter()
+	r.Use(authenticatedAs(allCustomerScopes...))
+	gateway.CustomerRouter(customerService, r)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "Get", method: "GET", path: "/customers/" + nonExistentCustomerId},
+		{name: "List", method: "GET", path: "/customers"},
+		{name: "Patch", method: "PATCH", path: "/customers/" + nonExistentCustomerId, body: `{"age": 31}`},
+		{name: "Delete", method: "DELETE", path: "/customers/" + nonExistentCustomerId},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("If-Match", "*")
+
+			// when
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			// then
+			assert.Equal(t, http.StatusInternalServerError, rr.Code)
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Body.String(), "/problems/internal-error")
+			assert.NotContains(t, rr.Body.String(), "database is locked", "Internal details should not be leaked")
+		})
+	}
+}
+
+func TestCustomerRouter_Authorization(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		scopes        []string
+		expectedScope string
+	}{
+		{name: "List without read scope", method: "GET", path: "/customers", scopes: []string{gateway.ScopeCustomersWrite}, expectedScope: gateway.ScopeCustomersRead},
+		{name: "Get without read scope", method: "GET", path: "/customers/" + nonExistentCustomerId, expectedScope: gateway.ScopeCustomersRead},
+		{name: "Create with read scope only", method: "POST", path: "/customers", body: `{"name": "John", "age": 30}`, scopes: []string{gateway.ScopeCustomersRead}, expectedScope: gateway.ScopeCustomersWrite},
+		{name: "Update with read scope only", method: "PUT", path: "/customers/" + nonExistentCustomerId, body: `{"name": "John", "age": 30}`, scopes: []string{gateway.ScopeCustomersRead}, expectedScope: gateway.ScopeCustomersWrite},
+		{name: "Patch with read scope only", method: "PATCH", path: "/customers/" + nonExistentCustomerId, body: `{"age": 31}`, scopes: []string{gateway.ScopeCustomersRead}, expectedScope: gateway.ScopeCustomersWrite},
+		{name: "Delete with write scope only", method: "DELETE", path: "/customers/" + nonExistentCustomerId, scopes: []string{gateway.ScopeCustomersWrite}, expectedScope: gateway.ScopeCustomersDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			customerService := app.InitializeInMemoryApp()
+			r := chi.NewRouter()
+			r.Use(authenticatedAs(tt.scopes...))
+			gateway.CustomerRouter(customerService, r)
+
+			// and
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			// when
+			r.ServeHTTP(rr, req)
+
+			// then
+			assert.Equal(t, http.StatusForbidden, rr.Code)
+			assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `scope="`+tt.expectedScope+`"`)
+
+			// and
+			var problem gateway.Problem
+			err := json.NewDecoder(rr.Body).Decode(&problem)
+			assert.NoError(t, err)
+			assert.Equal(t, "/problems/insufficient-scope", problem.Type)
+			assert.Equal(t, "missing scope "+tt.expectedScope, problem.Detail)
+		})
+	}
+
+	t.Run("Without principal", func(t *testing.T) {
+		// given
+		customerService := app.InitializeInMemoryApp()
+		r := chi.NewRouter()
+		gateway.CustomerRouter(customerService, r)
+
+		// and
+		req, _ := http.NewRequest("GET", "/customers", nil)
+		rr := httptest.NewRecorder()
+
+		// when
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestCustomerRouter_TenantIsolation(t *testing.T) {
+	newRouter := func() http.Handler {
+		r := chi.NewRouter()
+		// a principal not bound to a tenant, choosing one with the X-Tenant-ID header
+		r.Use(authenticatedIn("", allCustomerScopes...))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+		return r
+	}
+	requestIn := func(r http.Handler, tenant string, method string, path string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		req.Header.Set("If-Match", `"1"`)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Customer Of Another Tenant", func(t *testing.T) {
+		// given
+		r := newRouter()
+		created := requestIn(r, "acme", "POST", "/customers", `{"name": "John Doe", "age": 30}`)
+		require.Equal(t, http.StatusCreated, created.Code)
+		var apiOutput gateway.CustomerIdApiOutput
+		json.NewDecoder(created.Body).Decode(&apiOutput)
+		path := "/customers/" + apiOutput.Id
+
+		// when
+		get := requestIn(r, "globex", "GET", path, "")
+		list := requestIn(r, "globex", "GET", "/customers", "")
+		update := requestIn(r, "globex", "PUT", path, `{"name": "Jane Doe", "age": 31}`)
+		patch := requestIn(r, "globex", "PATCH", path, `{"age": 31}`)
+		remove := requestIn(r, "globex", "DELETE", path, "")
+
+		// then
+		assert.Equal(t, http.StatusNotFound, get.Code)
+		assert.JSONEq(t, `{"items": [], "next_cursor": null}`, list.Body.String())
+		assert.Equal(t, http.StatusNotFound, update.Code)
+		assert.Equal(t, http.StatusNotFound, patch.Code)
+		assert.Equal(t, http.StatusNotFound, remove.Code)
+
+		// and
+		own := requestIn(r, "acme", "GET", path, "")
+		assert.Equal(t, http.StatusOK, own.Code)
+		assert.Contains(t, own.Body.String(), `"name":"John Doe"`, "Customer should stay untouched")
+	})
+
+	t.Run("Missing Tenant", func(t *testing.T) {
+		// given
+		r := newRouter()
+
+		// when
+		rr := requestIn(r, "", "GET", "/customers", "")
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/problems/tenant-required")
+	})
+
+	t.Run("Invalid Tenant", func(t *testing.T) {
+		// given
+		r := newRouter()
+
+		// when
+		rr := requestIn(r, "Acme Corp", "GET", "/customers", "")
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/problems/invalid-tenant-id")
+	})
+
+	t.Run("Header Naming Another Tenant Than The Principal", func(t *testing.T) {
+		// given
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+
+		// when
+		own := requestIn(r, testTenant, "GET", "/customers", "")
+		other := requestIn(r, "globex", "GET", "/customers", "")
+
+		// then
+		assert.Equal(t, http.StatusOK, own.Code)
+		assert.Equal(t, http.StatusForbidden, other.Code)
+		assert.Contains(t, other.Body.String(), "/problems/tenant-mismatch")
+	})
+}
+
+func TestCustomerRouter_IdempotencyKey(t *testing.T) {
+	newRouter := func() http.Handler {
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+		return r
+	}
+	create := func(r http.Handler, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/customers", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Retry With The Same Body", func(t *testing.T) {
+		// given
+		r := newRouter()
+		first := create(r, "key-1", `{"name": "John Doe", "age": 30}`)
+
+		// when
+		retry := create(r, "key-1", `{"name": "John Doe", "age": 30}`)
+
+		// then
+		assert.Equal(t, http.StatusCreated, first.Code)
+		assert.Equal(t, first.Code, retry.Code)
+		assert.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+
+		// and
+		page := listCustomers(r, "/customers")
+		assert.Len(t, page.Items, 1, "Retry should not create a duplicate")
+	})
+
+	t.Run("Same Key With A Different Body", func(t *testing.T) {
+		// given
+		r := newRouter()
+		create(r, "key-1", `{"name": "John Doe", "age": 30}`)
+
+		// when
+		rr := create(r, "key-1", `{"name": "Jane Doe", "age": 31}`)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/problems/idempotency-key-reused")
+	})
+
+	t.Run("Different Keys", func(t *testing.T) {
+		// given
+		r := newRouter()
+
+		// when
+		first := create(r, "key-1", `{"name": "John Doe", "age": 30}`)
+		second := create(r, "key-2", `{"name": "John Doe", "age": 30}`)
+
+		// then
+		assert.NotEqual(t, first.Header().Get("Location"), second.Header().Get("Location"))
+		assert.Empty(t, second.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("Empty Key", func(t *testing.T) {
+		// given
+		r := newRouter()
+
+		// when
+		rr := create(r, "", `{"name": "John Doe", "age": 30}`)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/problems/invalid-idempotency-key")
+	})
+}
+
+func TestCustomerRouter_OptimisticConcurrency(t *testing.T) {
+	newRouterWithCustomer := func() (http.Handler, string) {
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+		return r, "/customers/" + createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+	}
+	request := func(r http.Handler, method string, path string, ifMatch string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Update With The Current ETag", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+		etag := request(r, "GET", path, "", "").Header().Get("ETag")
+
+		// when
+		rr := request(r, "PUT", path, etag, `{"name": "Jane Doe", "age": 31}`)
+
+		// then
+		assert.Equal(t, `"1"`, etag)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+		assert.Equal(t, `"2"`, request(r, "GET", path, "", "").Header().Get("ETag"))
+	})
+
+	t.Run("Lost Update", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+		etag := request(r, "GET", path, "", "").Header().Get("ETag")
+		request(r, "PATCH", path, etag, `{"age": 31}`)
+
+		// when
+		update := request(r, "PUT", path, etag, `{"name": "Jane Doe", "age": 30}`)
+		patch := request(r, "PATCH", path, etag, `{"name": "Jane Doe"}`)
+		remove := request(r, "DELETE", path, etag, "")
+
+		// then
+		for _, rr := range []*httptest.ResponseRecorder{update, patch, remove} {
+			assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+			assert.Contains(t, rr.Body.String(), "/problems/precondition-failed")
+		}
+		var apiOutput gateway.CustomerApiOutput
+		json.NewDecoder(request(r, "GET", path, "", "").Body).Decode(&apiOutput)
+		assert.Equal(t, "John Doe", apiOutput.Name, "Stale changes should not be applied")
+	})
+
+	t.Run("Any Version", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+
+		// when
+		rr := request(r, "DELETE", path, "*", "")
+
+		// then
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("Missing If-Match", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+
+		// when
+		rr := request(r, "PUT", path, "", `{"name": "Jane Doe", "age": 31}`)
+
+		// then
+		assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/problems/precondition-required")
+	})
+
+	t.Run("Weak ETag", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+
+		// when
+		rr := request(r, "DELETE", path, `W/"1"`, "")
+
+		// then
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code, "If-Match should use the strong comparison")
+	})
+
+	t.Run("ETag Of Another Representation", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+
+		// when
+		rr := request(r, "PATCH", path, `"1+xml"`, `{"age": 31}`)
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("ETag Of Unknown Representation", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+
+		// when
+		rr := request(r, "DELETE", path, `"1+html"`, "")
+
+		// then
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+}
+
+func TestCustomerRouter_ConditionalGet(t *testing.T) {
+	newRouterWithCustomer := func() (http.Handler, string) {
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+		return r, "/customers/" + createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+	}
+	get := func(r http.Handler, path string, header string, value string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Validators", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+
+		// when
+		rr := get(r, path, "", "")
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+		lastModified, err := http.ParseTime(rr.Header().Get("Last-Modified"))
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), lastModified, time.Minute)
+	})
+
+	tests := []struct {
+		name           string
+		header         string
+		value          func(validators http.Header) string
+		expectedStatus int
+	}{
+		{
+			name:           "Current ETag",
+			header:         "If-None-Match",
+			value:          func(validators http.Header) string { return validators.Get("ETag") },
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name:           "Weak Current ETag",
+			header:         "If-None-Match",
+			value:          func(validators http.Header) string { return "W/" + validators.Get("ETag") },
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name:           "ETag List",
+			header:         "If-None-Match",
+			value:          func(validators http.Header) string { return `"7", ` + validators.Get("ETag") },
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name:           "Stale ETag",
+			header:         "If-None-Match",
+			value:          func(validators http.Header) string { return `"0"` },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Not Modified Since",
+			header:         "If-Modified-Since",
+			value:          func(validators http.Header) string { return validators.Get("Last-Modified") },
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name:   "Modified Since",
+			header: "If-Modified-Since",
+			value: func(validators http.Header) string {
+				return time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Malformed Date",
+			header:         "If-Modified-Since",
+			value:          func(validators http.Header) string { return "yesterday" },
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			r, path := newRouterWithCustomer()
+			validators := get(r, path, "", "").Header()
+
+			// when
+			rr := get(r, path, tt.header, tt.value(validators))
+
+			// then
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, validators.Get("ETag"), rr.Header().Get("ETag"))
+			if tt.expectedStatus == http.StatusNotModified {
+				assert.Empty(t, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("If-None-Match Takes Precedence", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+		validators := get(r, path, "", "").Header()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("If-None-Match", `"0"`)
+		req.Header.Set("If-Modified-Since", validators.Get("Last-Modified"))
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code, "If-Modified-Since should be ignored alongside If-None-Match")
+	})
+
+	t.Run("Changed After Update", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+		etag := get(r, path, "", "").Header().Get("ETag")
+		req, _ := http.NewRequest("PATCH", path, strings.NewReader(`{"age": 31}`))
+		req.Header.Set("If-Match", etag)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		// when
+		rr := get(r, path, "If-None-Match", etag)
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("ETag Per Representation", func(t *testing.T) {
+		// given
+		r, path := newRouterWithCustomer()
+		jsonEtag := get(r, path, "", "").Header().Get("ETag")
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/xml")
+		req.Header.Set("If-None-Match", jsonEtag)
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code, "The JSON ETag should not validate the XML representation")
+		assert.Equal(t, `"1+xml"`, rr.Header().Get("ETag"))
+
+		// when
+		req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+	})
+}
+
+func TestCustomerRouter_ContentNegotiation(t *testing.T) {
+	newRouter := func() http.Handler {
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+		return r
+	}
+	request := func(r http.Handler, method string, path string, contentType string, accept string, body []byte) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	john := gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30}
+
+	formats := []struct {
+		mediaType string
+		marshal   func(v any) ([]byte, error)
+		unmarshal func(data []byte, v any) error
+	}{
+		{mediaType: "application/json", marshal: json.Marshal, unmarshal: json.Unmarshal},
+		{mediaType: "application/xml", marshal: xml.Marshal, unmarshal: xml.Unmarshal},
+		{mediaType: "application/yaml", marshal: yaml.Marshal, unmarshal: yaml.Unmarshal},
+		{mediaType: "application/cbor", marshal: cbor.Marshal, unmarshal: cbor.Unmarshal},
+		{
+			mediaType: "application/msgpack",
+			marshal: func(v any) ([]byte, error) {
+				var buffer bytes.Buffer
+				encoder := msgpack.NewEncoder(&buffer)
+				encoder.SetCustomStructTag("json")
+				err := encoder.Encode(v)
+				return buffer.Bytes(), err
+			},
+			unmarshal: func(data []byte, v any) error {
+				decoder := msgpack.NewDecoder(bytes.NewReader(data))
+				decoder.SetCustomStructTag("json")
+				return decoder.Decode(v)
+			},
+		},
+	}
+
+	for _, format := range formats {
+		t.Run(format.mediaType, func(t *testing.T) {
+			// given
+			r := newRouter()
+			body, err := format.marshal(john)
+			require.NoError(t, err)
+
+			// when
+			created := request(r, "POST", "/customers", format.mediaType, format.mediaType, body)
+			fetched := request(r, "GET", created.Header().Get("Location"), "", format.mediaType, nil)
+
+			// then
+			assert.Equal(t, http.StatusCreated, created.Code)
+			assert.Equal(t, format.mediaType, created.Header().Get("Content-Type"))
+			var idApiOutput gateway.CustomerIdApiOutput
+			require.NoError(t, format.unmarshal(created.Body.Bytes(), &idApiOutput))
+			assert.NotEmpty(t, idApiOutput.Id)
+
+			// and
+			assert.Equal(t, http.StatusOK, fetched.Code)
+			assert.Equal(t, format.mediaType, fetched.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", fetched.Header().Get("Vary"))
+			var apiOutput gateway.CustomerApiOutput
+			require.NoError(t, format.unmarshal(fetched.Body.Bytes(), &apiOutput))
+			assert.Equal(t, gateway.CustomerApiOutput{Id: idApiOutput.Id, Name: "John Doe", Age: 30}, apiOutput)
+		})
+	}
+
+	t.Run("Xml Document", func(t *testing.T) {
+		// given
+		r := newRouter()
+		body := []byte(`<customer><name>John Doe</name><age>30</age></customer>`)
+
+		// when
+		created := request(r, "POST", "/customers", "application/xml", "application/xml", body)
+		rr := request(r, "GET", "/customers", "", "application/xml", nil)
+
+		// then
+		var idApiOutput gateway.CustomerIdApiOutput
+		require.NoError(t, xml.Unmarshal(created.Body.Bytes(), &idApiOutput))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "<customerPage><items><customer><id>"+idApiOutput.Id+"</id><name>John Doe</name><age>30</age></customer></items></customerPage>", rr.Body.String())
+	})
+
+	t.Run("Update In Another Format", func(t *testing.T) {
+		// given
+		r := newRouter()
+		path := "/customers/" + createCustomer(r, john)
+		body, _ := yaml.Marshal(gateway.UpdateCustomerApiInput{Name: "Jane Doe", Age: 31})
+
+		// when
+		rr := request(r, "PUT", path, "application/yaml", "application/json", body)
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"id": "`+strings.TrimPrefix(path, "/customers/")+`", "name": "Jane Doe", "age": 31}`, rr.Body.String())
+	})
+
+	t.Run("Unsupported Content-Type", func(t *testing.T) {
+		// given
+		r := newRouter()
+
+		// when
+		rr := request(r, "POST", "/customers", "text/csv", "", []byte("John Doe,30"))
+
+		// then
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/problems/unsupported-media-type")
+		assert.Empty(t, listCustomers(r, "/customers").Items)
+	})
+
+	t.Run("Merge Patch Only", func(t *testing.T) {
+		// given
+		r := newRouter()
+		path := "/customers/" + createCustomer(r, john)
+
+		// when
+		mergePatch := request(r, "PATCH", path, "application/merge-patch+json", "", []byte(`{"age": 31}`))
+		xmlPatch := request(r, "PATCH", path, "application/xml", "", []byte(`<customer><age>32</age></customer>`))
+
+		// then
+		assert.Equal(t, http.StatusOK, mergePatch.Code)
+		assert.Equal(t, http.StatusUnsupportedMediaType, xmlPatch.Code)
+	})
+
+	t.Run("Not Acceptable", func(t *testing.T) {
+		// given
+		r := newRouter()
+		body, _ := json.Marshal(john)
+
+		// when
+		created := request(r, "POST", "/customers", "application/json", "text/csv", body)
+		fetched := request(r, "GET", "/customers", "", "text/html", nil)
+
+		// then
+		assert.Equal(t, http.StatusNotAcceptable, created.Code)
+		assert.Contains(t, created.Body.String(), "/problems/not-acceptable")
+		assert.Empty(t, listCustomers(r, "/customers").Items, "Nothing should be created for a response that cannot be sent")
+		assert.Equal(t, http.StatusNotAcceptable, fetched.Code)
+	})
+}
+
+func TestCustomerRouter_ContractValidation(t *testing.T) {
+	newRouter := func() http.Handler {
+		r := chi.NewRouter()
+		r.Use(authenticatedAs(allCustomerScopes...))
+		r.Use(gateway.ValidateContract(gateway.ContractOptions{ValidateRequests: true}))
+		gateway.CustomerRouter(app.InitializeInMemoryApp(), r)
+		return r
+	}
+
+	t.Run("Shape Violation", func(t *testing.T) {
+		// given
+		r := newRouter()
+		req, _ := http.NewRequest("POST", "/customers", strings.NewReader(`{"name": "John Doe", "age": "30"}`))
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{
+			"type": "/problems/contract-violation",
+			"title": "Contract violation",
+			"status": 400,
+			"detail": "request does not match the OpenAPI document",
+			"instance": "/customers",
+			"errors": [{"field": "body.age", "rule": "type", "detail": "expected integer, got string"}]
+		}`, rr.Body.String())
+		assert.Empty(t, listCustomers(r, "/customers").Items)
+	})
+
+	t.Run("Constraint Violation Keeps The Translated Message", func(t *testing.T) {
+		// given
+		r := newRouter()
+		req, _ := http.NewRequest("POST", "/customers", strings.NewReader(`{"name": "John Doe", "age": 201}`))
+		req.Header.Set("Accept-Language", "pl")
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "age musi być równe 200 lub mniej")
+	})
+
+	filterTests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "Unknown parameter", query: "unknown=1", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Unknown operator", query: "age_foo=1", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Age not a number", query: "age=abc", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Limit not a number", query: "limit=abc", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Limit out of range", query: "limit=0", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Unknown sort", query: "sort=bogus", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Empty age range", query: "age_gte=65&age_lt=18", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Invalid cursor", query: "cursor=not-a-cursor", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range filterTests {
+		t.Run("Filter "+tt.name, func(t *testing.T) {
+			// given
+			r := newRouter()
+			req, _ := http.NewRequest("GET", "/customers?"+tt.query, nil)
+
+			// when
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			// then
+			assert.Equal(t, tt.expectedStatus, rr.Code, rr.Body.String())
+			assert.NotContains(t, rr.Body.String(), "/problems/contract-violation", "Query should be reported by the handler")
+		})
+	}
+
+	t.Run("Valid Request", func(t *testing.T) {
+		// given
+		r := newRouter()
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+
+		// when
+		page := listCustomers(r, "/customers?name_prefix=Jo&limit=10")
+
+		// then
+		assert.Len(t, page.Items, 1)
+	})
+}
+
+// testTenant is the tenant of principals set up by authenticatedAs
+const testTenant = "acme"
+
+// authenticatedAs stands in for gateway.Authenticate with a principal of testTenant granted the given scopes;
+// like authenticatedIn, it also checks every response against the OpenAPI document
+func authenticatedAs(scopes ...string) func(http.Handler) http.Handler {
+	return authenticatedIn(testTenant, scopes...)
+}
+
+func authenticatedIn(tenant string, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		next = checkedResponses(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.Principal{Subject: "test", Tenant: tenant, Scopes: scopes}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// checkedResponses panics on responses that do not match the OpenAPI document, failing the test at hand
+var checkedResponses = gateway.ValidateContract(gateway.ContractOptions{
+	OnResponseViolation: func(r *http.Request, err error) {
+		panic(err)
+	},
+})
+
+func createCustomer(r http.Handler, apiInput gateway.CreateCustomerApiInput) string {
+	body, _ := json.Marshal(apiInput)
+	req, _ := http.NewRequest("POST", "/customers", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	var apiOutput gateway.CustomerIdApiOutput
+	json.NewDecoder(rr.Body).Decode(&apiOutput)
+	return apiOutput.Id
+}
+
+func listCustomers(r http.Handler, path string) gateway.CustomerPageApiOutput {
+	req, _ := http.NewRequest("GET", path, nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	var apiOutput gateway.CustomerPageApiOutput
+	json.NewDecoder(rr.Body).Decode(&apiOutput)
+	return apiOutput
 }
@@ -0,0 +1,334 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-chi-gorilla-wire-workshop/app"
+	"go-chi-gorilla-wire-workshop/app/gateway"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type graphqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []graphqlErrorOutput       `json:"errors"`
+}
+
+type graphqlErrorOutput struct {
+	Message    string `json:"message"`
+	Path       []any  `json:"path"`
+	Extensions struct {
+		Code   string `json:"code"`
+		Type   string `json:"type"`
+		Status int    `json:"status"`
+		Fields []struct {
+			Path    []string `json:"path"`
+			Rule    string   `json:"rule"`
+			Message string   `json:"message"`
+		} `json:"fields"`
+	} `json:"extensions"`
+}
+
+func newGraphqlRouter(scopes ...string) http.Handler {
+	customerService := app.InitializeInMemoryApp()
+	r := chi.NewRouter()
+	r.Use(authenticatedAs(scopes...))
+	gateway.CustomerRouter(customerService, r)
+	gateway.GraphqlRouter(customerService, r)
+	return r
+}
+
+func postGraphql(r http.Handler, body any) *httptest.ResponseRecorder {
+	content, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(content))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func graphql(t *testing.T, r http.Handler, query string, variables map[string]any) graphqlResponse {
+	rr := postGraphql(r, gateway.GraphqlRequest{Query: query, Variables: variables})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response graphqlResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	return response
+}
+
+func TestGraphqlRouter(t *testing.T) {
+	t.Run("Create And Get Customer", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+
+		// when
+		created := graphql(t, r, `mutation($input: CreateCustomerInput!) {
+			createCustomer(input: $input) { customer { id name age version } replayed }
+		}`, map[string]any{"input": map[string]any{"name": "John Doe", "age": 30}})
+
+		// then
+		require.Empty(t, created.Errors)
+		var payload struct {
+			Customer struct {
+				Id      string `json:"id"`
+				Name    string `json:"name"`
+				Age     int    `json:"age"`
+				Version int    `json:"version"`
+			} `json:"customer"`
+			Replayed bool `json:"replayed"`
+		}
+		require.NoError(t, json.Unmarshal(created.Data["createCustomer"], &payload))
+		assert.NotEmpty(t, payload.Customer.Id)
+		assert.Equal(t, "John Doe", payload.Customer.Name)
+		assert.Equal(t, 1, payload.Customer.Version)
+		assert.False(t, payload.Replayed)
+
+		// when
+		fetched := graphql(t, r, `query($id: ID!) { customer(id: $id) { name } }`, map[string]any{"id": payload.Customer.Id})
+
+		// then
+		require.Empty(t, fetched.Errors)
+		assert.JSONEq(t, `{"name": "John Doe"}`, string(fetched.Data["customer"]), "Only the selected fields should be returned")
+	})
+
+	t.Run("Get Non-Existent Customer", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+
+		// when
+		response := graphql(t, r, `query($id: ID!) { customer(id: $id) { name } }`, map[string]any{"id": nonExistentCustomerId})
+
+		// then
+		assert.Empty(t, response.Errors)
+		assert.JSONEq(t, `null`, string(response.Data["customer"]))
+	})
+
+	t.Run("List Customers", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "Jane Doe", Age: 25})
+		createCustomer(r, gateway.CreateCustomerApiInput{Name: "Jack Smith", Age: 40})
+
+		// when
+		first := graphql(t, r, `{ customers(namePrefix: "J", ageGte: 25, sort: "-age", limit: 2) { items { name } nextCursor } }`, nil)
+
+		// then
+		require.Empty(t, first.Errors)
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextCursor *string `json:"nextCursor"`
+		}
+		require.NoError(t, json.Unmarshal(first.Data["customers"], &page))
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, "Jack Smith", page.Items[0].Name)
+		assert.Equal(t, "John Doe", page.Items[1].Name)
+		require.NotNil(t, page.NextCursor)
+
+		// when
+		second := graphql(t, r, `query($cursor: String) { customers(ageGte: 25, sort: "-age", limit: 2, cursor: $cursor) { items { name } nextCursor } }`,
+			map[string]any{"cursor": *page.NextCursor})
+
+		// then
+		require.Empty(t, second.Errors)
+		assert.JSONEq(t, `{"items": [{"name": "Jane Doe"}], "nextCursor": null}`, string(second.Data["customers"]))
+	})
+
+	t.Run("Idempotent Create", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		mutation := `mutation { createCustomer(input: {name: "John Doe", age: 30}, idempotencyKey: "create-john") { customer { id } replayed } }`
+
+		// when
+		first := graphql(t, r, mutation, nil)
+		second := graphql(t, r, mutation, nil)
+
+		// then
+		require.Empty(t, first.Errors)
+		require.Empty(t, second.Errors)
+		var firstPayload, secondPayload struct {
+			Customer struct {
+				Id string `json:"id"`
+			} `json:"customer"`
+			Replayed bool `json:"replayed"`
+		}
+		json.Unmarshal(first.Data["createCustomer"], &firstPayload)
+		json.Unmarshal(second.Data["createCustomer"], &secondPayload)
+		assert.Equal(t, firstPayload.Customer.Id, secondPayload.Customer.Id)
+		assert.True(t, secondPayload.Replayed)
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		customerId := createCustomer(r, gateway.CreateCustomerApiInput{Name: "John Doe", Age: 30})
+
+		// when
+		rr := postGraphql(r, []gateway.GraphqlRequest{
+			{Query: `query($id: ID!) { customer(id: $id) { name } }`, Variables: map[string]any{"id": customerId}},
+			{Query: `{ customers { items { age } } }`},
+		})
+
+		// then
+		require.Equal(t, http.StatusOK, rr.Code)
+		var responses []graphqlResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&responses))
+		require.Len(t, responses, 2)
+		assert.JSONEq(t, `{"name": "John Doe"}`, string(responses[0].Data["customer"]))
+		assert.JSONEq(t, `{"items": [{"age": 30}]}`, string(responses[1].Data["customers"]))
+	})
+
+	t.Run("Batch Too Large", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		batch := make([]gateway.GraphqlRequest, 11)
+		for i := range batch {
+			batch[i] = gateway.GraphqlRequest{Query: `mutation { createCustomer(input: {name: "John Doe", age: 30}) { customer { id } } }`}
+		}
+
+		// when
+		rr := postGraphql(r, batch)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Empty(t, listCustomers(r, "/customers").Items, "No request of the batch should run")
+	})
+
+	t.Run("Too Many Aliased Root Fields", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		var mutation strings.Builder
+		mutation.WriteString("mutation {")
+		for i := range 11 {
+			fmt.Fprintf(&mutation, ` c%d: createCustomer(input: {name: "John Doe", age: 30}) { customer { id } }`, i)
+		}
+		mutation.WriteString(" }")
+
+		// when
+		rr := postGraphql(r, gateway.GraphqlRequest{Query: mutation.String()})
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Empty(t, listCustomers(r, "/customers").Items, "No aliased field should run")
+	})
+
+	t.Run("Too Many Root Fields Across A Batch", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		query := `fragment lists on Query { a: customers { items { id } } b: customers { items { id } } }
+			query { ...lists c: customers { items { id } } d: customers { items { id } } }`
+
+		// when
+		rr := postGraphql(r, []gateway.GraphqlRequest{{Query: query}, {Query: query}, {Query: query}})
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Fields of fragments should count as well")
+	})
+
+	t.Run("Repeated Root Fields Count Once", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		query := `{` + strings.Repeat(` customers { items { id } }`, 11) + ` }`
+
+		// when
+		rr := postGraphql(r, gateway.GraphqlRequest{Query: query})
+
+		// then
+		assert.Equal(t, http.StatusOK, rr.Code, "Fields under the same response key are resolved once")
+	})
+
+	t.Run("Malformed Request", func(t *testing.T) {
+		// given
+		r := newGraphqlRouter(allCustomerScopes...)
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewBufferString(`{"query"`))
+
+		// when
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestGraphqlRouter_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		scopes         []string
+		query          string
+		expectedPath   []any
+		expectedCode   string
+		expectedFields [][]string
+	}{
+		{
+			name:           "Domain validation",
+			scopes:         allCustomerScopes,
+			query:          `mutation { createCustomer(input: {name: "", age: 201}) { customer { id } } }`,
+			expectedPath:   []any{"createCustomer"},
+			expectedCode:   "VALIDATION_FAILED",
+			expectedFields: [][]string{{"input", "name"}, {"input", "age"}},
+		},
+		{
+			name:           "Page validation",
+			scopes:         allCustomerScopes,
+			query:          `{ customers(limit: 1000) { items { id } } }`,
+			expectedPath:   []any{"customers"},
+			expectedCode:   "VALIDATION_FAILED",
+			expectedFields: [][]string{{"limit"}},
+		},
+		{
+			name:         "Invalid sort",
+			scopes:       allCustomerScopes,
+			query:        `{ customers(sort: "email") { items { id } } }`,
+			expectedPath: []any{"customers"},
+			expectedCode: "VALIDATION_FAILED",
+		},
+		{
+			name:         "Invalid cursor",
+			scopes:       allCustomerScopes,
+			query:        `{ customers(cursor: "not-a-cursor") { items { id } } }`,
+			expectedPath: []any{"customers"},
+			expectedCode: "INVALID_CURSOR",
+		},
+		{
+			name:         "Insufficient scope",
+			scopes:       []string{gateway.ScopeCustomersRead},
+			query:        `mutation { createCustomer(input: {name: "John Doe", age: 30}) { customer { id } } }`,
+			expectedPath: []any{"createCustomer"},
+			expectedCode: "INSUFFICIENT_SCOPE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			r := newGraphqlRouter(tt.scopes...)
+
+			// when
+			response := graphql(t, r, tt.query, nil)
+
+			// then
+			require.Len(t, response.Errors, 1)
+			graphqlErr := response.Errors[0]
+			assert.Equal(t, tt.expectedPath, graphqlErr.Path)
+			assert.Equal(t, tt.expectedCode, graphqlErr.Extensions.Code)
+			assert.NotEmpty(t, graphqlErr.Message)
+
+			// and
+			fields := make([][]string, 0, len(graphqlErr.Extensions.Fields))
+			for _, field := range graphqlErr.Extensions.Fields {
+				fields = append(fields, field.Path)
+				assert.NotEmpty(t, field.Message)
+			}
+			assert.ElementsMatch(t, tt.expectedFields, fields)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package test
+
+import (
+	"encoding/json"
+	"go-chi-gorilla-wire-workshop/app/gateway"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenApiRouter(t *testing.T) {
+	// given
+	r := chi.NewRouter()
+	gateway.OpenApiRouter(r)
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+
+	// when
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	// then
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var document struct {
+		OpenApi string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &document))
+	assert.Equal(t, "3.1.0", document.OpenApi)
+	assert.Contains(t, document.Paths, "/customers")
+	assert.Contains(t, document.Paths, "/customers/{id}")
+}